@@ -0,0 +1,205 @@
+package egret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultAssetManifest is the default path of the asset manifest,
+	// relative to the application directory.
+	DefaultAssetManifest = "public/assets.json"
+	// assetHashLength is the number of hex digits of the content hash
+	// inserted into fingerprinted file names.
+	assetHashLength = 12
+)
+
+// AssetManifest maps the paths of the static files, relative to their static
+// root, to their fingerprinted paths, e.g. "css/app.css" to
+// "css/app.5d41402abc4b.css".
+type AssetManifest map[string]string
+
+var (
+	// MainAssets is the asset manifest of the application,
+	// nil when "assets.fingerprint" is disabled.
+	MainAssets AssetManifest
+	// AssetURLPrefix is the URL path the static roots are served under.
+	AssetURLPrefix = "/public/"
+
+	// assetOriginals maps the fingerprinted paths of MainAssets back to the
+	// files served for them by the static handlers of the asset roots.
+	assetOriginals = map[string]string{}
+)
+
+// FingerprintName inserts the hash of content before the extension of name.
+func FingerprintName(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])[:assetHashLength]
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// BuildAssetManifest hashes the files of the given static roots. When several
+// roots contain the same path, the first one wins, like in Static.
+// Precompressed (.br, .gz) siblings and asset manifests are skipped.
+func BuildAssetManifest(roots ...fs.FS) (AssetManifest, error) {
+	manifest := AssetManifest{}
+	for _, root := range roots {
+		err := fs.WalkDir(root, ".", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || manifest[name] != "" {
+				return nil
+			}
+			switch path.Ext(name) {
+			case ".br", ".gz":
+				return nil
+			}
+			if path.Base(name) == path.Base(DefaultAssetManifest) {
+				return nil
+			}
+			content, err := fs.ReadFile(root, name)
+			if err != nil {
+				return err
+			}
+			manifest[name] = FingerprintName(name, content)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// LoadAssetManifest reads an asset manifest written by AssetManifest.Write.
+func LoadAssetManifest(fpath string) (AssetManifest, error) {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := AssetManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Write saves the manifest as JSON to fpath.
+func (m AssetManifest) Write(fpath string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(fpath, content, 0666)
+}
+
+// GenerateAssetManifest builds the manifest of the "assets.roots" static
+// roots of the application located at basePath and writes it to
+// "assets.manifest". This is done by `egret build`, in the copy of the
+// application it builds; the application itself never writes it.
+func GenerateAssetManifest(basePath string) (AssetManifest, error) {
+	manifest, err := BuildAssetManifest(assetRoots(basePath)...)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, manifest.Write(assetManifestPath(basePath))
+}
+
+// assetRoots returns the "assets.roots" static roots of the application
+// located at basePath, the missing ones being skipped.
+func assetRoots(basePath string) []fs.FS {
+	roots := []fs.FS{}
+	for _, rpath := range Config.GetStringSliceDefault("assets.roots", []string{"public"}) {
+		if !filepath.IsAbs(rpath) {
+			rpath = filepath.Join(basePath, rpath)
+		}
+		if _, err := os.Stat(rpath); err != nil {
+			continue
+		}
+		roots = append(roots, os.DirFS(rpath))
+	}
+	return roots
+}
+
+// isAssetRoot returns true if rpath, a root path of Static, is one of the
+// "assets.roots", the fingerprinted names of which it serves.
+func isAssetRoot(rpath string) bool {
+	if Config == nil {
+		return false
+	}
+	for _, root := range Config.GetStringSliceDefault("assets.roots", []string{"public"}) {
+		if filepath.Clean(root) == filepath.Clean(rpath) ||
+			!filepath.IsAbs(root) && filepath.Join(BasePath, root) == filepath.Clean(rpath) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAssetManifest replaces the asset manifest of the application.
+func SetAssetManifest(manifest AssetManifest) {
+	originals := make(map[string]string, len(manifest))
+	for name, hashed := range manifest {
+		originals[hashed] = name
+	}
+	MainAssets = manifest
+	assetOriginals = originals
+}
+
+// AssetURL returns the URL of a static file, fingerprinted if it is part of
+// the asset manifest. It is available in templates as
+//
+//      <link rel="stylesheet" href="{{asset "css/app.css"}}">
+func AssetURL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := MainAssets[name]; ok {
+		name = hashed
+	}
+	return AssetURLPrefix + name
+}
+
+func assetManifestPath(basePath string) string {
+	fpath := Config.GetStringDefault("assets.manifest", DefaultAssetManifest)
+	if !filepath.IsAbs(fpath) {
+		fpath = filepath.Join(basePath, fpath)
+	}
+	return fpath
+}
+
+func initAssets() {
+	AssetURLPrefix = Config.GetStringDefault("assets.url", "/public/")
+	if !strings.HasSuffix(AssetURLPrefix, "/") {
+		AssetURLPrefix += "/"
+	}
+	if !Config.GetBoolDefault("assets.fingerprint", false) {
+		SetAssetManifest(nil)
+		return
+	}
+	// the manifest of egret build, else the one of the files as they are,
+	// which is kept in memory: the application tree is never written to.
+	// The static handlers check the files still match their fingerprint.
+	if !DevMode {
+		if manifest, err := LoadAssetManifest(assetManifestPath(BasePath)); err == nil {
+			SetAssetManifest(manifest)
+			return
+		}
+	}
+	manifest, err := BuildAssetManifest(assetRoots(BasePath)...)
+	if err != nil {
+		Logger.Warn("Failed to build the asset manifest", zap.Error(err))
+	}
+	SetAssetManifest(manifest)
+}
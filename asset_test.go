@@ -0,0 +1,85 @@
+package egret
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBuildAssetManifest(t *testing.T) {
+	manifest, err := BuildAssetManifest(staticTestFS)
+	assert.Nil(t, err)
+	hashed := manifest["docs/readme.txt"]
+	assert.Regexp(t, `^docs/readme\.[0-9a-f]{12}\.txt$`, hashed)
+	assert.True(t, FingerprintPattern.MatchString(hashed))
+	assert.Equal(t, FingerprintName("docs/readme.txt", []byte("0123456789")), hashed)
+	_, ok := manifest["app.3f2a9c1d.js.br"]
+	assert.False(t, ok, "precompressed files are not fingerprinted")
+
+	fpath := filepath.Join(t.TempDir(), "assets.json")
+	assert.Nil(t, manifest.Write(fpath))
+	loaded, err := LoadAssetManifest(fpath)
+	assert.Nil(t, err)
+	assert.Equal(t, manifest, loaded)
+}
+
+func TestAssetURL(t *testing.T) {
+	defer SetAssetManifest(nil)
+	SetAssetManifest(AssetManifest{"css/app.css": "css/app.5d41402abc4b.css"})
+	assert.Equal(t, "/public/css/app.5d41402abc4b.css", AssetURL("css/app.css"))
+	assert.Equal(t, "/public/css/app.5d41402abc4b.css", AssetURL("/css/app.css"))
+	assert.Equal(t, "/public/img/logo.png", AssetURL("img/logo.png"))
+}
+
+func TestStaticFingerprintedAsset(t *testing.T) {
+	Logger = zap.NewNop()
+	defer SetAssetManifest(nil)
+	manifest, _ := BuildAssetManifest(staticTestFS)
+	SetAssetManifest(manifest)
+
+	w := serveStatic(staticTestFS, StaticOptions{"assets": true}, manifest["docs/readme.txt"], nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, ImmutableCacheControl, w.Header().Get("Cache-Control"))
+
+	w = serveStatic(staticTestFS, StaticOptions{"assets": true}, "docs/readme.txt", nil)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Cache-Control"), "only the fingerprinted name is immutable")
+
+	w = serveStatic(staticTestFS, StaticOptions{"assets": true}, "docs/readme.0000000000ab.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "outdated hashes are not served")
+
+	w = serveStatic(staticTestFS, StaticOptions{}, manifest["docs/readme.txt"], nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "only the handlers of the asset roots serve the fingerprinted names")
+
+	// a file changed since the manifest was built isn't cached under its former fingerprint
+	outdated := FingerprintName("docs/readme.txt", []byte("former content"))
+	SetAssetManifest(AssetManifest{"docs/readme.txt": outdated})
+	w = serveStatic(staticTestFS, StaticOptions{"assets": true}, outdated, nil)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+}
+
+func TestInitAssets(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "conf"), 0777))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "public", "css"), 0777))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "conf", "app.yaml"), []byte("assets:\n  fingerprint: true\n"), 0666))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "public", "css", "app.css"), []byte("body{}"), 0666))
+
+	config, basePath := Config, BasePath
+	defer func() { Config, BasePath = config, basePath }()
+	defer SetAssetManifest(nil)
+	Config, _ = conf.LoadContext("app", []string{filepath.Join(dir, "conf")})
+	BasePath = dir
+
+	initAssets()
+	assert.Equal(t, FingerprintName("css/app.css", []byte("body{}")), MainAssets["css/app.css"])
+	_, err := os.Stat(filepath.Join(dir, DefaultAssetManifest))
+	assert.True(t, os.IsNotExist(err), "the manifest isn't written at runtime")
+}
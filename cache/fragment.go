@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/kenorld/egret/core/logging"
+	"go.uber.org/zap"
+)
+
+const fragmentKeyPrefix = "egret.fragment."
+
+// fragmentCache stores the fragments of the cache template actions in Instance,
+// and is set as template.Fragments on start out of dev mode.
+type fragmentCache struct{}
+
+func (fragmentCache) Get(key string) (string, bool) {
+	var fragment string
+	if err := Get(fragmentKeyPrefix+key, &fragment); err != nil {
+		return "", false
+	}
+	return fragment, true
+}
+
+func (fragmentCache) Set(key, fragment string, ttl time.Duration, tags []string) {
+	storageKey := fragmentKeyPrefix + key
+	if err := Set(storageKey, fragment, ttl); err != nil {
+		logging.Logger.Warn("egret/cache: failed to store fragment", zap.String("key", key), zap.Error(err))
+		return
+	}
+	for _, tag := range tags {
+		addToIndex("fragment.tag."+tag, storageKey)
+	}
+}
+
+// PurgeFragment removes the fragment cached under the given key.
+func PurgeFragment(key string) error {
+	if err := Delete(fragmentKeyPrefix + key); err != nil && err != ErrCacheMiss {
+		return err
+	}
+	return nil
+}
+
+// PurgeFragmentTag removes all the fragments cached with the given tag.
+func PurgeFragmentTag(tag string) error {
+	return purgeIndex("fragment.tag." + tag)
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFragmentCache(t *testing.T) {
+	setupResponseCache(t)
+	fragments := fragmentCache{}
+
+	fragments.Set("nav", "<nav></nav>", time.Hour, []string{"menus"})
+	fragments.Set("footer", "<footer></footer>", time.Hour, []string{"menus"})
+	fragments.Set("sidebar", "<aside></aside>", time.Hour, nil)
+	if fragment, ok := fragments.Get("nav"); !ok || fragment != "<nav></nav>" {
+		t.Errorf("Expected the nav fragment, got %q", fragment)
+	}
+
+	if err := PurgeFragment("sidebar"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := fragments.Get("sidebar"); ok {
+		t.Error("Expected the sidebar fragment to be purged")
+	}
+	if err := PurgeFragmentTag("menus"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := fragments.Get("nav"); ok {
+		t.Error("Expected the nav fragment to be purged by tag")
+	}
+	if _, ok := fragments.Get("footer"); ok {
+		t.Error("Expected the footer fragment to be purged by tag")
+	}
+	if err := PurgeFragment("missing"); err != nil {
+		t.Error(err)
+	}
+}
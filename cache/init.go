@@ -1,54 +1,87 @@
 package cache
 
 import (
-	"strings"
 	"time"
 
 	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/core/template"
 )
 
+// Config is the "cache" section of app.yaml.
+type Config struct {
+	// Expires is the default expiration time of the cached items.
+	Expires time.Duration `default:"1h"`
+	// Memcached and Redis.Enabled select the cache servers, the in-memory
+	// cache being used by default.
+	Memcached bool
+	// Hosts lists the memcached servers, or the Redis server.
+	Hosts []string
+	// Redis holds the settings of the Redis client.
+	Redis struct {
+		Enabled bool
+		// Password authenticates to the Redis server.
+		Password string
+		// MaxIdle and MaxActive bound the connections of the pool, and
+		// IdleTimeout, in seconds, closes the idle ones.
+		MaxIdle     int    `conf:"maxidle" default:"5"`
+		MaxActive   int    `conf:"maxactive"`
+		IdleTimeout int    `conf:"idletimeout" default:"240"`
+		Protocol    string `default:"tcp"`
+		// Timeout holds the timeouts of the connections, in milliseconds.
+		Timeout struct {
+			Connect int `default:"10000"`
+			Read    int `default:"5000"`
+			Write   int `default:"5000"`
+		}
+	}
+	// Fragments stores the fragments of the cache template actions in the
+	// cache, out of dev mode.
+	Fragments bool `default:"true"`
+	// HTTP holds the defaults of ResponseHandler.
+	HTTP struct {
+		TTL                  time.Duration `conf:"ttl"`
+		StaleWhileRevalidate time.Duration
+	} `conf:"http"`
+}
+
 func init() {
+	egret.RegisterConfig("cache", Config{})
 	egret.OnAppStart(func() {
-		// Set the default expiration time.
-		defaultExpiration := time.Hour // The default for the default is one hour.
-		if expireStr, found := egret.Config.String("cache.expires"); found {
-			var err error
-			if defaultExpiration, err = time.ParseDuration(expireStr); err != nil {
-				panic("Could not parse default cache expiration duration " + expireStr + ": " + err.Error())
-			}
+		cfg := Config{}
+		if err := egret.Config.Bind("cache", &cfg); err != nil {
+			panic("Invalid cache configuration: " + err.Error())
 		}
 
 		// make sure you aren't trying to use both memcached and redis
-		if egret.Config.BoolDefault("cache.memcached", false) && egret.Config.BoolDefault("cache.redis", false) {
+		if cfg.Memcached && cfg.Redis.Enabled {
 			panic("You've configured both memcached and redis, please only include configuration for one cache!")
 		}
 
-		// Use memcached?
-		if egret.Config.BoolDefault("cache.memcached", false) {
-			hosts := strings.Split(egret.Config.StringDefault("cache.hosts", ""), ",")
-			if len(hosts) == 0 {
+		switch {
+		case cfg.Memcached:
+			if len(cfg.Hosts) == 0 {
 				panic("Memcache enabled but no memcached hosts specified!")
 			}
-
-			Instance = NewMemcachedCache(hosts, defaultExpiration)
-			return
-		}
+			Instance = NewMemcachedCache(cfg.Hosts, cfg.Expires)
 
 		// Use Redis (share same config as memcached)?
-		if egret.Config.BoolDefault("cache.redis", false) {
-			hosts := strings.Split(egret.Config.StringDefault("cache.hosts", ""), ",")
-			if len(hosts) == 0 {
+		case cfg.Redis.Enabled:
+			if len(cfg.Hosts) == 0 {
 				panic("Redis enabled but no Redis hosts specified!")
 			}
-			if len(hosts) > 1 {
+			if len(cfg.Hosts) > 1 {
 				panic("Redis currently only supports one host!")
 			}
-			password := egret.Config.StringDefault("cache.redis.password", "")
-			Instance = NewRedisCache(hosts[0], password, defaultExpiration)
-			return
-		}
+			Instance = NewRedisCache(cfg.Hosts[0], cfg.Redis.Password, cfg.Expires)
 
 		// By default, use the in-memory cache.
-		Instance = NewInMemoryCache(defaultExpiration)
+		default:
+			Instance = NewInMemoryCache(cfg.Expires)
+		}
+
+		// the fragments are rendered on each request in dev mode, to see the changes of the templates
+		if cfg.Fragments && !egret.DevMode {
+			template.Fragments = fragmentCache{}
+		}
 	})
 }
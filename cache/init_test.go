@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kenorld/egret/conf"
+)
+
+func TestConfigRedisSection(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "cache:\n  hosts: [localhost:6379]\n  redis:\n    enabled: true\n    password: secret\n    maxidle: 10\n    timeout:\n      read: 100\n"
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(yaml), 0666); err != nil {
+		t.Fatal(err)
+	}
+	config, err := conf.LoadContext("app", []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected the redis section to be valid, got %s", err)
+	}
+
+	cfg := Config{}
+	if err := config.Bind("cache", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Redis.Enabled || cfg.Redis.Password != "secret" {
+		t.Errorf("Expected the redis client to be enabled with its password, got %+v", cfg.Redis)
+	}
+	if cfg.Redis.MaxIdle != 10 || cfg.Redis.Timeout.Read != 100 || cfg.Redis.Timeout.Write != 5000 {
+		t.Errorf("Expected the redis settings and their defaults, got %+v", cfg.Redis)
+	}
+}
@@ -3,18 +3,22 @@ package cache
 import (
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/kenorld/egret/core/logging"
+	"github.com/patrickmn/go-cache"
 	"go.uber.org/zap"
 )
 
 type InMemoryCache struct {
 	cache.Cache
+	// counterMu makes the read-modify-write of the counters atomic.
+	counterMu *sync.Mutex
 }
 
 func NewInMemoryCache(defaultExpiration time.Duration) InMemoryCache {
-	return InMemoryCache{*cache.New(defaultExpiration, time.Minute)}
+	return InMemoryCache{*cache.New(defaultExpiration, time.Minute), &sync.Mutex{}}
 }
 
 func (c InMemoryCache) Get(key string, ptrValue interface{}) error {
@@ -45,11 +49,10 @@ func (c InMemoryCache) Set(key string, value interface{}, expires time.Duration)
 }
 
 func (c InMemoryCache) Add(key string, value interface{}, expires time.Duration) error {
-	err := c.Cache.Add(key, value, expires)
-	if err == cache.ErrKeyExists {
+	if err := c.Cache.Add(key, value, expires); err != nil {
 		return ErrNotStored
 	}
-	return err
+	return nil
 }
 
 func (c InMemoryCache) Replace(key string, value interface{}, expires time.Duration) error {
@@ -60,26 +63,57 @@ func (c InMemoryCache) Replace(key string, value interface{}, expires time.Durat
 }
 
 func (c InMemoryCache) Delete(key string) error {
-	if found := c.Cache.Delete(key); !found {
+	if _, found := c.Cache.Get(key); !found {
 		return ErrCacheMiss
 	}
+	c.Cache.Delete(key)
 	return nil
 }
 
 func (c InMemoryCache) Increment(key string, n uint64) (newValue uint64, err error) {
-	newValue, err = c.Cache.Increment(key, n)
-	if err == cache.ErrCacheMiss {
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	if _, found := c.Cache.Get(key); !found {
 		return 0, ErrCacheMiss
 	}
-	return
+	// the integers of go-cache wrap around the same way as uint64
+	if err = c.Cache.Increment(key, int64(n)); err != nil {
+		return 0, err
+	}
+	return c.counter(key)
 }
 
 func (c InMemoryCache) Decrement(key string, n uint64) (newValue uint64, err error) {
-	newValue, err = c.Cache.Decrement(key, n)
-	if err == cache.ErrCacheMiss {
+	c.counterMu.Lock()
+	defer c.counterMu.Unlock()
+	value, err := c.counter(key)
+	if err != nil {
+		return 0, err
+	}
+	// capped at 0
+	if n > value {
+		n = value
+	}
+	if err = c.Cache.Decrement(key, int64(n)); err != nil {
+		return 0, err
+	}
+	return value - n, nil
+}
+
+// counter returns the integer stored at key as an uint64.
+func (c InMemoryCache) counter(key string) (uint64, error) {
+	value, found := c.Cache.Get(key)
+	if !found {
 		return 0, ErrCacheMiss
 	}
-	return
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	}
+	return 0, fmt.Errorf("egret/cache: the value of %s is not an integer", key)
 }
 
 func (c InMemoryCache) Flush() error {
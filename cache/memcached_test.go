@@ -16,8 +16,7 @@ var newMemcachedCache = func(t *testing.T, defaultExpiration time.Duration) Cach
 		c.Close()
 		return NewMemcachedCache([]string{testServer}, defaultExpiration)
 	}
-	t.Errorf("couldn't connect to memcached on %s", testServer)
-	t.FailNow()
+	t.Skipf("couldn't connect to memcached on %s", testServer)
 	panic("")
 }
 
@@ -5,14 +5,15 @@ import (
 	"testing"
 	"time"
 
-	egret "github.com/kenorld/egret/core"
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
 )
 
 // These tests require redis server running on localhost:6379 (the default)
 const redisTestServer = "localhost:6379"
 
 var newRedisCache = func(t *testing.T, defaultExpiration time.Duration) Cache {
-	egret.Config = config.NewContext()
+	egret.Config, _ = conf.LoadContext("app", nil)
 
 	c, err := net.Dial("tcp", redisTestServer)
 	if err == nil {
@@ -22,8 +23,7 @@ var newRedisCache = func(t *testing.T, defaultExpiration time.Duration) Cache {
 		redisCache.Flush()
 		return redisCache
 	}
-	t.Errorf("couldn't connect to redis on %s", redisTestServer)
-	t.FailNow()
+	t.Skipf("couldn't connect to redis on %s", redisTestServer)
 	panic("")
 }
 
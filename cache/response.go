@@ -0,0 +1,518 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/core/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	responseKeyPrefix   = "egret.response."
+	responseIndexPrefix = "egret.response.index."
+	responseLockPrefix  = "egret.response.lock."
+	responseVaryPrefix  = "egret.response.vary."
+
+	// responseTagsStoreKey is the Context.Store key used by TagResponse.
+	responseTagsStoreKey = "cache.response.tags"
+	// responseRevalidateStoreKey marks a context replayed in the background
+	// to refresh a stale entry.
+	responseRevalidateStoreKey = "cache.response.revalidate"
+)
+
+// responseRevalidateTimeout bounds the background revalidation of a stale
+// response.
+const responseRevalidateTimeout = 30 * time.Second
+
+// ResponseConfig is the configuration of a response caching handler.
+// Each route may use its own handler, and so its own TTL, key and tags.
+type ResponseConfig struct {
+	// TTL is how long a response stays fresh.
+	// Default value: the value of "cache.http.ttl" or one minute.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long an expired response may still be served
+	// while a fresh one is rendered in the background.
+	// Default value: the value of "cache.http.stale_while_revalidate" or zero.
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders lists the request headers which are part of the cache key,
+	// e.g. "Accept", "Accept-Encoding" or "Accept-Language". The headers of
+	// the Vary header of the responses are added to them.
+	// Default value: ["Accept", "Accept-Encoding"]
+	VaryHeaders []string
+	// KeyFunc returns the base key of the request. The vary header values are
+	// appended to it. The same key is passed to PurgeResponse.
+	// Default value: ResponseKey(method, url)
+	KeyFunc func(*egret.Context) string
+	// Tags are attached to every response cached by this handler, see
+	// PurgeResponseTag. Handlers may add more with TagResponse.
+	Tags []string
+	// Statuses lists the response status codes which may be cached.
+	// Default value: [200]
+	Statuses []int
+}
+
+// CachedResponse is a complete response stored by the response cache.
+type CachedResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+	TTL      time.Duration
+	Stale    time.Duration
+}
+
+// Age returns how long ago the response has been stored.
+func (r *CachedResponse) Age() time.Duration {
+	return time.Since(r.StoredAt)
+}
+
+// IsFresh returns true if the response has not yet reached its TTL.
+func (r *CachedResponse) IsFresh() bool {
+	return r.Age() < r.TTL
+}
+
+// ResponseHandler returns a handler that caches complete responses (status,
+// headers and body) in Instance and serves them on later requests.
+//
+// Only GET and HEAD requests are cached, unless they send credentials, an
+// Authorization or a Cookie header. A request sending "Cache-Control:
+// no-cache" skips the lookup, and "no-store" skips the cache altogether.
+// A response setting a cookie, or sending "Cache-Control: no-store" or
+// "private" or "Vary: *", is not stored. Its "s-maxage", "max-age" and
+// "stale-while-revalidate" directives override the configured durations,
+// and the headers of its Vary header are part of the cache key.
+//
+// Example:
+//
+//      router.Path("/products").Get(cache.ResponseHandler(cache.ResponseConfig{
+//          TTL:  5 * time.Minute,
+//          Tags: []string{"products"},
+//      }), listProducts)
+func ResponseHandler(cfg ...ResponseConfig) egret.HandlerFunc {
+	var c ResponseConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.TTL == 0 {
+		c.TTL = egret.Config.GetDurationDefault("cache.http.ttl", time.Minute)
+	}
+	if c.StaleWhileRevalidate == 0 {
+		c.StaleWhileRevalidate = egret.Config.GetDurationDefault("cache.http.stale_while_revalidate", 0)
+	}
+	if c.VaryHeaders == nil {
+		c.VaryHeaders = []string{"Accept", "Accept-Encoding"}
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = func(ctx *egret.Context) string {
+			return ResponseKey(ctx.Request.Method, ctx.Request.URL.String())
+		}
+	}
+	if len(c.Statuses) == 0 {
+		c.Statuses = []int{http.StatusOK}
+	}
+	return func(ctx *egret.Context) {
+		serveCachedResponse(ctx, &c)
+	}
+}
+
+// ResponseKey returns the default base key of a cached response.
+func ResponseKey(method, url string) string {
+	return method + " " + url
+}
+
+// TagResponse attaches the given tags to the response of the current request,
+// if it gets cached.
+func TagResponse(ctx *egret.Context, tags ...string) {
+	existing, _ := ctx.Get(responseTagsStoreKey).([]string)
+	ctx.Set(responseTagsStoreKey, append(existing, tags...))
+}
+
+// PurgeResponse removes all the cached variants of the response with the
+// given base key.
+func PurgeResponse(key string) error {
+	return purgeIndex("key." + key)
+}
+
+// PurgeResponseTag removes all the cached responses tagged with the given tag.
+func PurgeResponseTag(tag string) error {
+	return purgeIndex("tag." + tag)
+}
+
+func serveCachedResponse(ctx *egret.Context, c *ResponseConfig) {
+	method := ctx.Request.Method
+	if method != http.MethodGet && method != http.MethodHead {
+		ctx.Next()
+		return
+	}
+	directives := parseCacheControl(ctx.GetHeader("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		ctx.Next()
+		return
+	}
+	// the responses to the requests with credentials are private
+	if ctx.GetHeader("Authorization") != "" || ctx.GetHeader("Cookie") != "" {
+		ctx.Next()
+		return
+	}
+
+	baseKey := c.KeyFunc(ctx)
+	var responseVary []string
+	Get(responseVaryKey(baseKey), &responseVary)
+	varyHeaders := mergeVary(c.VaryHeaders, responseVary)
+	storageKey := responseStorageKey(baseKey, ctx.Request.Header, varyHeaders)
+	_, revalidating := ctx.Store[responseRevalidateStoreKey]
+	_, noCache := directives["no-cache"]
+	if !revalidating && !noCache {
+		var entry CachedResponse
+		if err := Get(storageKey, &entry); err == nil {
+			if entry.IsFresh() {
+				writeCachedResponse(ctx, &entry, "HIT")
+				return
+			}
+			if entry.Age() < entry.TTL+entry.Stale {
+				writeCachedResponse(ctx, &entry, "STALE")
+				revalidateResponse(ctx, storageKey)
+				return
+			}
+		}
+	}
+
+	recorder := &responseRecorder{
+		ResponseWriter: ctx.Response.Writer,
+		status:         http.StatusOK,
+		ctx:            ctx,
+		config:         c,
+		baseKey:        baseKey,
+		varyHeaders:    varyHeaders,
+		storageKey:     storageKey,
+	}
+	ctx.Response.Writer = recorder
+	ctx.Response.SetHeader("X-Cache", "MISS")
+	ctx.Next()
+}
+
+// writeCachedResponse replays the stored response and skips the rest of the
+// handlers. ExecuteRender finds the header already written and leaves it as is.
+func writeCachedResponse(ctx *egret.Context, entry *CachedResponse, state string) {
+	header := ctx.Response.Header()
+	for key, values := range entry.Header {
+		header[key] = values
+	}
+	header.Set("Age", strconv.Itoa(int(entry.Age().Seconds())))
+	header.Set("X-Cache", state)
+	ctx.Response.Status = entry.Status
+	ctx.Response.ContentType = entry.Header.Get(egret.ContentType)
+	if ctx.Request.Method == http.MethodHead {
+		ctx.Response.EnsureHeaderWrited()
+	} else {
+		ctx.Response.Write(entry.Body)
+	}
+	ctx.Abort()
+}
+
+// revalidateResponse renders the route again in the background and stores the
+// result. Only one revalidation per entry runs at a time, for at most
+// responseRevalidateTimeout.
+//
+// The handlers run on their own Context and a clone of the request, as they
+// outlive the request which got the stale response.
+func revalidateResponse(ctx *egret.Context, storageKey string) {
+	lockKey := responseLockPrefix + storageKey
+	if err := Add(lockKey, true, responseRevalidateTimeout); err != nil {
+		return
+	}
+	reqCtx, cancel := context.WithTimeout(context.Background(), responseRevalidateTimeout)
+	req := ctx.Request.Request.Clone(reqCtx)
+	handlers := append([]egret.HandlerFunc(nil), ctx.Handlers...)
+	params := make(map[string]string, len(ctx.Params))
+	for name, value := range ctx.Params {
+		params[name] = value
+	}
+	go func() {
+		defer cancel()
+		defer Delete(lockKey)
+		defer func() {
+			if err := recover(); err != nil {
+				logging.Logger.Error("egret/cache: response revalidation panic", zap.Any("error", err))
+			}
+		}()
+		w := &discardResponseWriter{header: http.Header{}}
+		rctx := egret.NewContext(egret.NewRequest(req), egret.NewResponse(w))
+		rctx.Handlers, rctx.Params = handlers, params
+		rctx.Set(responseRevalidateStoreKey, true)
+		rctx.Next()
+		if err := rctx.ExecuteRender(); err != nil {
+			logging.Logger.Warn("egret/cache: response revalidation failed", zap.Error(err))
+		}
+		if closer, ok := rctx.Response.Writer.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}()
+}
+
+// responseStorageKey hashes the base key and the vary header values, so the
+// key fits the 250 bytes limit of memcached.
+func responseStorageKey(baseKey string, header http.Header, varyHeaders []string) string {
+	h := sha1.New()
+	h.Write([]byte(baseKey))
+	for _, name := range varyHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(header[http.CanonicalHeaderKey(name)], ",")))
+	}
+	return responseKeyPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// responseVaryKey returns the key of the headers of the Vary header of the
+// responses with the given base key.
+func responseVaryKey(baseKey string) string {
+	sum := sha1.Sum([]byte(baseKey))
+	return responseVaryPrefix + hex.EncodeToString(sum[:])
+}
+
+// mergeVary returns the canonical names of the headers of varyHeaders,
+// followed by the ones of the Vary header values missing from them.
+func mergeVary(varyHeaders []string, vary []string) []string {
+	merged, seen := []string{}, map[string]bool{}
+	for _, names := range [][]string{varyHeaders, vary} {
+		for _, value := range names {
+			for _, name := range strings.Split(value, ",") {
+				name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+				if name != "" && !seen[name] {
+					seen[name] = true
+					merged = append(merged, name)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// responseIndexKey returns the key of the list of storage keys registered
+// under a base key or a tag.
+func responseIndexKey(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return responseIndexPrefix + hex.EncodeToString(sum[:])
+}
+
+// addToIndex registers a storage key under the given index.
+// The read-modify-write is not atomic; a concurrent update may lose a key,
+// which then simply expires on its own.
+func addToIndex(name, storageKey string) {
+	indexKey := responseIndexKey(name)
+	var keys []string
+	Get(indexKey, &keys)
+	for _, key := range keys {
+		if key == storageKey {
+			return
+		}
+	}
+	if err := Set(indexKey, append(keys, storageKey), FOREVER); err != nil {
+		logging.Logger.Warn("egret/cache: failed to update response index", zap.String("index", name), zap.Error(err))
+	}
+}
+
+func purgeIndex(name string) error {
+	indexKey := responseIndexKey(name)
+	var keys []string
+	if err := Get(indexKey, &keys); err != nil {
+		if err == ErrCacheMiss {
+			return nil
+		}
+		return err
+	}
+	for _, key := range keys {
+		if err := Delete(key); err != nil && err != ErrCacheMiss {
+			return err
+		}
+	}
+	if err := Delete(indexKey); err != nil && err != ErrCacheMiss {
+		return err
+	}
+	return nil
+}
+
+// parseCacheControl returns the directives of a Cache-Control header,
+// lower-cased and mapped to their (possibly empty) values.
+func parseCacheControl(header string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// responseRecorder copies everything written to the client and stores the
+// complete response when it gets closed at the end of the request.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	closed      bool
+
+	ctx         *egret.Context
+	config      *ResponseConfig
+	baseKey     string
+	varyHeaders []string
+	storageKey  string
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.store()
+	if w, ok := r.ResponseWriter.(interface{ Close() error }); ok {
+		return w.Close()
+	}
+	return nil
+}
+
+func (r *responseRecorder) store() {
+	if r.ctx.Error != nil || !containsStatus(r.config.Statuses, r.status) {
+		return
+	}
+	header := r.Header()
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+	if _, ok := directives["private"]; ok {
+		return
+	}
+	if len(header["Set-Cookie"]) > 0 {
+		return
+	}
+	vary := mergeVary(nil, header["Vary"])
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	ttl, stale := r.config.TTL, r.config.StaleWhileRevalidate
+	if d, ok := directiveSeconds(directives, "s-maxage"); ok {
+		ttl = d
+	} else if d, ok := directiveSeconds(directives, "max-age"); ok {
+		ttl = d
+	}
+	if d, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+		stale = d
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	// the headers the response varies on are part of the key of its variants
+	storageKey := r.storageKey
+	if varyHeaders := mergeVary(r.varyHeaders, vary); len(varyHeaders) > len(r.varyHeaders) {
+		storageKey = responseStorageKey(r.baseKey, r.ctx.Request.Header, varyHeaders)
+		if err := Set(responseVaryKey(r.baseKey), varyHeaders, FOREVER); err != nil {
+			logging.Logger.Warn("egret/cache: failed to store response vary headers", zap.String("key", r.baseKey), zap.Error(err))
+			return
+		}
+		addToIndex("key."+r.baseKey, responseVaryKey(r.baseKey))
+	}
+
+	stored := http.Header{}
+	for key, values := range header {
+		switch key {
+		case "Age", "X-Cache", "Date":
+			continue
+		}
+		stored[key] = append([]string(nil), values...)
+	}
+	entry := CachedResponse{
+		Status:   r.status,
+		Header:   stored,
+		Body:     r.body.Bytes(),
+		StoredAt: time.Now(),
+		TTL:      ttl,
+		Stale:    stale,
+	}
+	if err := Set(storageKey, entry, ttl+stale); err != nil {
+		logging.Logger.Warn("egret/cache: failed to store response", zap.String("key", r.baseKey), zap.Error(err))
+		return
+	}
+
+	tags, _ := r.ctx.Get(responseTagsStoreKey).([]string)
+	tags = append(append([]string(nil), r.config.Tags...), tags...)
+	sort.Strings(tags)
+	addToIndex("key."+r.baseKey, storageKey)
+	for i, tag := range tags {
+		if i > 0 && tags[i-1] == tag {
+			continue
+		}
+		addToIndex("tag."+tag, storageKey)
+	}
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// discardResponseWriter is the client of a background revalidation.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
+	"github.com/kenorld/egret/core/logging"
+	"go.uber.org/zap"
+)
+
+func setupResponseCache(t *testing.T) {
+	egret.Config, _ = conf.LoadContext("app", nil)
+	logging.Logger = zap.NewNop()
+	Instance = NewInMemoryCache(time.Hour)
+}
+
+// serveWithResponseCache runs the cache handler followed by a handler writing
+// the given body, the same way the server does: handlers, render, close.
+func serveWithResponseCache(handler egret.HandlerFunc, url string, body string, calls *int) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", url, nil)
+	return serveRequestWithResponseCache(handler, r, func(ctx *egret.Context) {
+		*calls++
+		ctx.Response.ContentType = "text/plain"
+		ctx.Response.Write([]byte(body))
+	})
+}
+
+func serveRequestWithResponseCache(handler egret.HandlerFunc, r *http.Request, render egret.HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx := egret.NewContext(egret.NewRequest(r), egret.NewResponse(w))
+	ctx.Handlers = []egret.HandlerFunc{handler, render}
+	ctx.Next()
+	ctx.ExecuteRender()
+	if closer, ok := ctx.Response.Writer.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+	return w
+}
+
+func TestResponseHandler_CachesResponse(t *testing.T) {
+	setupResponseCache(t)
+	handler := ResponseHandler(ResponseConfig{TTL: time.Minute})
+	calls := 0
+
+	w := serveWithResponseCache(handler, "/items", "first", &calls)
+	if w.Body.String() != "first" || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected a MISS rendering first, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	w = serveWithResponseCache(handler, "/items", "second", &calls)
+	if w.Body.String() != "first" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected a HIT serving first, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", calls)
+	}
+	if w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected the cached content type, got %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestResponseHandler_Purge(t *testing.T) {
+	setupResponseCache(t)
+	handler := ResponseHandler(ResponseConfig{TTL: time.Minute, Tags: []string{"items"}})
+	calls := 0
+
+	serveWithResponseCache(handler, "/items?page=1", "page 1", &calls)
+	serveWithResponseCache(handler, "/items?page=2", "page 2", &calls)
+	if err := PurgeResponse(ResponseKey("GET", "/items?page=1")); err != nil {
+		t.Errorf("Error purging by key: %s", err)
+	}
+	serveWithResponseCache(handler, "/items?page=1", "page 1", &calls)
+	serveWithResponseCache(handler, "/items?page=2", "page 2", &calls)
+	if calls != 3 {
+		t.Errorf("Expected only the purged key to render again, rendered %d times", calls)
+	}
+
+	if err := PurgeResponseTag("items"); err != nil {
+		t.Errorf("Error purging by tag: %s", err)
+	}
+	serveWithResponseCache(handler, "/items?page=1", "page 1", &calls)
+	serveWithResponseCache(handler, "/items?page=2", "page 2", &calls)
+	if calls != 5 {
+		t.Errorf("Expected all the tagged responses to render again, rendered %d times", calls)
+	}
+}
+
+func TestResponseHandler_StaleWhileRevalidate(t *testing.T) {
+	setupResponseCache(t)
+	handler := ResponseHandler(ResponseConfig{TTL: 100 * time.Millisecond, StaleWhileRevalidate: time.Minute})
+	// the revalidation renders in the background
+	var calls int32
+	serve := func(body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/items", nil)
+		return serveRequestWithResponseCache(handler, r, func(ctx *egret.Context) {
+			atomic.AddInt32(&calls, 1)
+			ctx.Response.ContentType = "text/plain"
+			ctx.Response.Write([]byte(body))
+		})
+	}
+
+	serve("old")
+	time.Sleep(200 * time.Millisecond)
+	w := serve("new")
+	if w.Body.String() != "old" || w.Header().Get("X-Cache") != "STALE" {
+		t.Errorf("Expected the stale response, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&calls) < 2 || Get(responseLockPrefix+storageKeyOf("/items"), new(bool)) == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stale response to be revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w = serve("newer")
+	if w.Body.String() != "new" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected the revalidated response, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected the handler to run twice, ran %d times", n)
+	}
+}
+
+// storageKeyOf returns the storage key of the GET response of url with the
+// default vary headers.
+func storageKeyOf(url string) string {
+	r, _ := http.NewRequest("GET", url, nil)
+	return responseStorageKey(ResponseKey("GET", url), r.Header, []string{"Accept", "Accept-Encoding"})
+}
+
+func TestResponseHandler_Private(t *testing.T) {
+	setupResponseCache(t)
+	handler := ResponseHandler(ResponseConfig{TTL: time.Minute})
+
+	for _, header := range []string{"Authorization", "Cookie"} {
+		calls := 0
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "/account", nil)
+			r.Header.Set(header, "secret")
+			serveRequestWithResponseCache(handler, r, func(ctx *egret.Context) {
+				calls++
+				ctx.Response.Write([]byte("account"))
+			})
+		}
+		if calls != 2 {
+			t.Errorf("Expected the requests with an %s header not to be cached, rendered %d times", header, calls)
+		}
+	}
+
+	for name, value := range map[string]string{"Set-Cookie": "session=1", "Cache-Control": "private, max-age=60", "Vary": "*"} {
+		calls := 0
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "/"+name, nil)
+			serveRequestWithResponseCache(handler, r, func(ctx *egret.Context) {
+				calls++
+				ctx.Response.SetHeader(name, value)
+				ctx.Response.Write([]byte("private"))
+			})
+		}
+		if calls != 2 {
+			t.Errorf("Expected the responses with %s: %s not to be cached, rendered %d times", name, value, calls)
+		}
+	}
+}
+
+func TestResponseHandler_ResponseVary(t *testing.T) {
+	setupResponseCache(t)
+	handler := ResponseHandler(ResponseConfig{TTL: time.Minute})
+	calls := 0
+	serve := func(language string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/greeting", nil)
+		r.Header.Set("Accept-Language", language)
+		return serveRequestWithResponseCache(handler, r, func(ctx *egret.Context) {
+			calls++
+			ctx.Response.SetHeader("Vary", "Accept-Language")
+			ctx.Response.Write([]byte("hello " + language))
+		})
+	}
+
+	serve("fr")
+	if w := serve("en"); w.Body.String() != "hello en" || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected the response to vary on Accept-Language, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if w := serve("fr"); w.Body.String() != "hello fr" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected a HIT serving the French variant, got %s %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if calls != 2 {
+		t.Errorf("Expected a render per variant, rendered %d times", calls)
+	}
+
+	if err := PurgeResponse(ResponseKey("GET", "/greeting")); err != nil {
+		t.Errorf("Error purging by key: %s", err)
+	}
+	var vary []string
+	if err := Get(responseVaryKey(ResponseKey("GET", "/greeting")), &vary); err != ErrCacheMiss {
+		t.Errorf("Expected the vary headers to be purged with the responses, got %v", err)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	directives := parseCacheControl(`public, Max-Age=60, no-cache="Set-Cookie"`)
+	if directives["max-age"] != "60" || directives["no-cache"] != "Set-Cookie" {
+		t.Errorf("Unexpected directives %v", directives)
+	}
+	if _, ok := directives["public"]; !ok {
+		t.Errorf("Expected the public directive in %v", directives)
+	}
+}
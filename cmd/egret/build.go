@@ -1,17 +1,24 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/kenorld/egret"
 	"github.com/kenorld/egret/cmd/harness"
 )
 
 var cmdBuild = &Command{
-	UsageLine: "build [import path] [target path] [run mode]",
+	UsageLine: "build [import path] [target path] [run mode] [flags]",
 	Short:     "build a Egret application (e.g. for deployment)",
 	Long: `
 Build the Egret web application named by the given import path.
@@ -22,11 +29,31 @@ apply and may be used to determine logic in the application itself.
 
 Run mode defaults to "dev".
 
+The views of the application are embedded in its binary, which doesn't need
+the views directory to run, along with the other directories of build.embed.
+
+The flags override the build section of app.yaml:
+
+    --goos, --goarch  the platform of the binary, e.g. --goos=linux --goarch=arm64
+    --target          the comma-separated platforms of a build matrix, e.g.
+                      --target=linux/amd64,darwin/arm64,windows/amd64, each
+                      built in its os_arch subdirectory of the target path
+    --tags            build tags added to build.tags
+    --trimpath        remove the paths of the build machine from the binary
+    --static          disable cgo, for a binary without dynamic libraries
+    --ldflags         linker flags added to the ones setting egret.AppVersion
+    --checksums       write the SHA-256 checksums of the binaries to SHA256SUMS
+
+The version of the application is the APP_VERSION environment variable, else
+the output of git describe, and its build time the SOURCE_DATE_EPOCH one, if set.
+
 WARNING: The target path will be completely deleted, if it already exists!
 
 For example:
 
     egret build github.com/kenorld/egret/samples/chat /tmp/chat
+
+    egret build github.com/kenorld/egret/samples/chat /tmp/chat prod --target=linux/amd64,linux/arm64 --trimpath
 `,
 }
 
@@ -34,7 +61,74 @@ func init() {
 	cmdBuild.Run = buildApp
 }
 
+// buildOptions are the flags of egret build and egret package, the build
+// section of app.yaml by default.
+type buildOptions struct {
+	goos, goarch, targets, tags, ldflags string
+	trimpath, checksums, static          bool
+	// outputs the files written by egret package besides the default ones
+	outputs []string
+}
+
+// flagSet returns the flags of the options of the command.
+func (o *buildOptions) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.goos, "goos", "", "the os of the binary")
+	fs.StringVar(&o.goarch, "goarch", "", "the architecture of the binary")
+	fs.StringVar(&o.targets, "target", "", "the comma-separated os/arch platforms of the binaries")
+	fs.StringVar(&o.tags, "tags", "", "build tags added to build.tags")
+	fs.BoolVar(&o.trimpath, "trimpath", false, "remove the paths of the build machine from the binary")
+	fs.BoolVar(&o.static, "static", false, "disable cgo, for a binary without dynamic libraries")
+	fs.StringVar(&o.ldflags, "ldflags", "", "linker flags added to the ones setting the version")
+	fs.BoolVar(&o.checksums, "checksums", false, "write the SHA-256 checksums to SHA256SUMS")
+	return fs
+}
+
+// resolve completes the options with the build section of app.yaml.
+func (o *buildOptions) resolve() {
+	o.trimpath = o.trimpath || egret.Config.GetBoolDefault("build.trimpath", false)
+	o.checksums = o.checksums || egret.Config.GetBoolDefault("build.checksums", false)
+	if o.ldflags == "" {
+		o.ldflags = egret.Config.GetStringDefault("build.ldflags", "")
+	}
+}
+
+// buildTargets returns the platforms to build for, --target else --goos and
+// --goarch, else build.targets, else the platform of the environment.
+func (o *buildOptions) buildTargets() []harness.Target {
+	names := strings.Split(o.targets, ",")
+	if o.targets == "" {
+		if o.goos != "" || o.goarch != "" {
+			return []harness.Target{{GOOS: o.goos, GOARCH: o.goarch}}
+		}
+		names = egret.Config.GetStringSliceDefault("build.targets", nil)
+	}
+	var targets []harness.Target
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		target, err := harness.ParseTarget(name)
+		if err != nil {
+			errorf("Abort: %s", err)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		targets = append(targets, harness.Target{})
+	}
+	return targets
+}
+
+// builtTarget is the build of the application for a target, in its directory.
+type builtTarget struct {
+	target      harness.Target
+	dir, binary string
+}
+
 func buildApp(args []string) {
+	opts := &buildOptions{}
+	args = parseFlags(opts.flagSet("build"), args)
 	if len(args) < 2 {
 		fmt.Fprintf(os.Stderr, "%s\n%s", cmdBuild.UsageLine, cmdBuild.Long)
 		return
@@ -48,19 +142,75 @@ func buildApp(args []string) {
 	if !egret.Initialized {
 		egret.Init(mode, appImportPath, "")
 	}
+	buildTargets(appImportPath, destPath, mode, opts)
+}
+
+// buildTargets builds the application for each target of opts in destPath,
+// or in its os_arch subdirectories for a matrix of targets.
+func buildTargets(appImportPath, destPath, mode string, opts *buildOptions) []builtTarget {
+	opts.resolve()
 
 	// First, verify that it is either already empty or looks like a previous
 	// build (to avoid clobbering anything)
-	if exists(destPath) && !empty(destPath) && !exists(path.Join(destPath, "run.sh")) {
+	if exists(destPath) && !empty(destPath) && !looksLikeBuild(destPath) {
 		errorf("Abort: %s exists and does not look like a build directory.", destPath)
 	}
-
 	os.RemoveAll(destPath)
+
+	targets := opts.buildTargets()
+	var built []builtTarget
+	for _, target := range targets {
+		dir := destPath
+		if len(targets) > 1 {
+			dir = filepath.Join(destPath, target.OS()+"_"+target.Arch())
+		}
+		built = append(built, buildTarget(appImportPath, dir, mode, target, opts))
+	}
+
+	if opts.checksums {
+		var binaries []string
+		for _, b := range built {
+			binaries = append(binaries, b.binary)
+		}
+		mustWriteChecksums(filepath.Join(destPath, "SHA256SUMS"), destPath, binaries)
+	}
+	return built
+}
+
+// looksLikeBuild returns true if dir holds a build, or the builds of a matrix.
+func looksLikeBuild(dir string) bool {
+	for _, pattern := range []string{"run.sh", "run.bat", "*_*/run.sh", "*_*/run.bat"} {
+		if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTarget builds the application for target in destPath.
+func buildTarget(appImportPath, destPath, mode string, target harness.Target, opts *buildOptions) builtTarget {
 	srcPath := path.Join(destPath, "src")
-	mustCopyDir(path.Join(srcPath, filepath.FromSlash(appImportPath)), egret.BasePath, true, nil)
+	appPath := path.Join(srcPath, filepath.FromSlash(appImportPath))
+	mustCopyDir(appPath, egret.BasePath, true, nil)
+	removePackageOutputs(appPath, opts.outputs)
 	os.MkdirAll(destPath, 0777)
 
-	app, eerr := harness.Build(logger)
+	// Ship the asset manifest, so the built app doesn't hash its static files at startup.
+	if egret.Config.GetBoolDefault("assets.fingerprint", false) {
+		_, err := egret.GenerateAssetManifest(appPath)
+		panicOnError(err, "Failed to generate the asset manifest")
+	}
+
+	removeEmbedFile := writeEmbedFile()
+	defer removeEmbedFile()
+	app, eerr := harness.BuildTarget(logger, harness.BuildOptions{
+		Target:   target,
+		Tags:     opts.tags,
+		TrimPath: opts.trimpath,
+		LDFlags:  opts.ldflags,
+		Static:   opts.static,
+	})
+	removeEmbedFile()
 	panicOnError(eerr, "Failed to build")
 
 	// Included are:
@@ -83,15 +233,103 @@ func buildApp(args []string) {
 		"Mode":       mode,
 	}, path.Join(destPath, "run.sh")
 
-	mustRenderTemplate(
-		runShPath,
-		filepath.Join(egret.EgretPath, "cmd", "egret", "package_run.sh.template"),
-		tmplData)
+	// the run scripts of the platform, both of them for the one of the environment
+	if target.IsZero() || target.OS() != "windows" {
+		mustRenderTemplate(
+			runShPath,
+			filepath.Join(egret.EgretPath, "cmd", "egret", "package_run.sh.template"),
+			tmplData)
 
-	mustChmod(runShPath, 0755)
+		mustChmod(runShPath, 0755)
+	}
+
+	if target.IsZero() || target.OS() == "windows" {
+		mustRenderTemplate(
+			filepath.Join(destPath, "run.bat"),
+			filepath.Join(egret.EgretPath, "cmd", "egret", "package_run.bat.template"),
+			tmplData)
+	}
+	return builtTarget{target: target, dir: destPath, binary: destBinaryPath}
+}
 
-	mustRenderTemplate(
-		filepath.Join(destPath, "run.bat"),
-		filepath.Join(egret.EgretPath, "cmd", "egret", "package_run.bat.template"),
-		tmplData)
+// removePackageOutputs removes the archives, images and checksums written by
+// egret package in the directory of the application, and outputs, from its copy
+// in appPath.
+func removePackageOutputs(appPath string, outputs []string) {
+	name := filepath.Base(egret.BasePath)
+	for _, pattern := range []string{"SHA256SUMS", name + ".tar.gz", name + "-*-*.tar.gz", name + "-oci", name + "-oci.tar"} {
+		matches, _ := filepath.Glob(filepath.Join(appPath, pattern))
+		for _, match := range matches {
+			os.RemoveAll(match)
+		}
+	}
+	for _, output := range outputs {
+		abs, err := filepath.Abs(output)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(egret.BasePath, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			os.RemoveAll(filepath.Join(appPath, rel))
+		}
+	}
+}
+
+// embedFileName is the file added to the main package of the application
+// while it is built, to embed its views and the directories of build.embed.
+const embedFileName = "zz_egret_embed.go"
+
+const embedFileContent = `// Code generated by egret build. DO NOT EDIT.
+
+package main
+
+import (
+	"embed"
+
+	"github.com/kenorld/egret"
+)
+
+//go:embed %s
+var egretEmbeddedFS embed.FS
+
+func init() {
+	egret.EmbeddedFS = egretEmbeddedFS
+}
+`
+
+// writeEmbedFile writes the embed file if the application has directories to
+// embed, and returns the function removing it. The file is written in the
+// directory of the application, which the go command builds with its go.mod,
+// and is removed as well if egret is interrupted meanwhile.
+func writeEmbedFile() func() {
+	var dirs []string
+	for _, dir := range egret.Config.GetStringSliceDefault("build.embed", []string{"views"}) {
+		if dir = path.Clean(filepath.ToSlash(dir)); exists(filepath.Join(egret.BasePath, filepath.FromSlash(dir))) {
+			dirs = append(dirs, strconv.Quote(dir))
+		}
+	}
+	if len(dirs) == 0 {
+		return func() {}
+	}
+	fpath := filepath.Join(egret.BasePath, embedFileName)
+	err := ioutil.WriteFile(fpath, []byte(fmt.Sprintf(embedFileContent, strings.Join(dirs, " "))), 0644)
+	panicOnError(err, "Failed to write "+embedFileName)
+
+	interrupted, done := make(chan os.Signal, 1), make(chan struct{})
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-interrupted:
+			os.Remove(fpath)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(interrupted)
+			close(done)
+			os.Remove(fpath)
+		})
+	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
+)
+
+func TestParseFlags(t *testing.T) {
+	opts := &buildOptions{}
+	args := parseFlags(opts.flagSet("build"), []string{
+		"github.com/acme/app", "--tags=netgo", "/tmp/app", "prod", "--trimpath", "--", "--not-a-flag",
+	})
+	if expected := []string{"github.com/acme/app", "/tmp/app", "prod", "--not-a-flag"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected the arguments %v, got %v", expected, args)
+	}
+	if opts.tags != "netgo" || !opts.trimpath || opts.checksums {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+}
+
+func TestMustWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "app"), filepath.Join(dir, "linux_arm64", "app")}
+	os.Mkdir(filepath.Join(dir, "linux_arm64"), 0777)
+	ioutil.WriteFile(paths[0], []byte("binary"), 0755)
+	ioutil.WriteFile(paths[1], []byte("arm binary"), 0755)
+
+	mustWriteChecksums(filepath.Join(dir, "SHA256SUMS"), dir, paths)
+	sums, err := ioutil.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%x  app\n%x  linux_arm64/app\n", sha256.Sum256([]byte("binary")), sha256.Sum256([]byte("arm binary")))
+	if string(sums) != expected {
+		t.Errorf("Expected the checksums\n%s\ngot\n%s", expected, sums)
+	}
+}
+
+func TestMustTarGzDirSourceDateEpoch(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src", "views"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "src", "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "views", "index.html"), []byte("<html></html>"), 0644)
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	f, err := os.Open(mustTarGzDir(filepath.Join(dir, "app.tar.gz"), filepath.Join(dir, "src")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, names := tar.NewReader(gz), []string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		if !header.ModTime.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("Expected %s to have the time of SOURCE_DATE_EPOCH, got %s", header.Name, header.ModTime)
+		}
+	}
+	if expected := []string{"run.sh", "views/index.html"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the entries %v, got %v", expected, names)
+	}
+}
+
+func TestWriteEmbedFile(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "views"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte("build:\n  embed: [views, public]\n"), 0666)
+
+	defer func(basePath string, config *conf.Context) {
+		egret.BasePath, egret.Config = basePath, config
+	}(egret.BasePath, egret.Config)
+	egret.BasePath = dir
+	egret.Config, _ = conf.LoadContext("app", []string{dir})
+
+	remove := writeEmbedFile()
+	content, err := ioutil.ReadFile(filepath.Join(dir, embedFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf(embedFileContent, `"views"`); string(content) != expected {
+		t.Errorf("Expected only the existing directories to be embedded, got\n%s", content)
+	}
+	remove()
+	remove()
+	if exists(filepath.Join(dir, embedFileName)) {
+		t.Errorf("Expected %s to be removed", embedFileName)
+	}
+}
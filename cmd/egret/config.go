@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kenorld/egret"
+)
+
+var cmdConfig = &Command{
+	UsageLine: "config print [run mode] [import path]",
+	Short:     "print the effective configuration of a Egret application",
+	Long: `
+Print the configuration of the Egret application named by the given import
+path, as merged from its configuration files, their includes, the overlay of
+the run mode (e.g. app.prod.yaml) and the EGRET_ environment variables.
+Each key is followed by the file, or the environment variable, setting it.
+
+Run mode defaults to "dev", and import path to the current directory.
+The values of the keys containing "secret", "password" or "token" are masked.
+
+For example:
+
+    egret config print prod github.com/kenorld/egret/samples/chat
+`,
+}
+
+func init() {
+	cmdConfig.Run = configApp
+}
+
+func configApp(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintf(os.Stderr, "%s\n%s", cmdConfig.UsageLine, cmdConfig.Long)
+		return
+	}
+
+	mode, appImportPath := "dev", "."
+	if len(args) >= 2 {
+		mode = args[1]
+	}
+	if len(args) >= 3 {
+		appImportPath = args[2]
+	}
+
+	if !egret.Initialized {
+		egret.Init(mode, appImportPath, "")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, key := range egret.Config.AllKeys() {
+		fmt.Fprintf(w, "%s = %s\t# %s\n", key, formatConfigValue(key, egret.Config.Get(key)), egret.Config.Source(key))
+	}
+	w.Flush()
+}
+
+func formatConfigValue(key string, value interface{}) string {
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, secret := range []string{"secret", "password", "token"} {
+		if strings.Contains(name, secret) {
+			return "******"
+		}
+	}
+	if content, err := json.Marshal(value); err == nil {
+		return string(content)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
+)
+
+func TestConfigPrintEnvKeys(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: sample\n"), 0666)
+	os.Setenv("EGRET_MAIL_HOST", "smtp.example.com")
+	defer os.Unsetenv("EGRET_MAIL_HOST")
+
+	defer func(config *conf.Context, initialized bool) {
+		egret.Config, egret.Initialized = config, initialized
+	}(egret.Config, egret.Initialized)
+	egret.Config, _ = conf.LoadContext("app", []string{dir})
+	egret.Config.SetEnvPrefix(conf.DefaultEnvPrefix)
+	egret.Initialized = true
+
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	configApp([]string{"print"})
+	os.Stdout = stdout
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+
+	for _, line := range []string{
+		`mail.host = "smtp.example.com"  # $EGRET_MAIL_HOST`,
+		`name = "sample"                 # ` + filepath.Join(dir, "app.yaml"),
+	} {
+		if !strings.Contains(string(out), line) {
+			t.Errorf("Expected %q in:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/kenorld/egret"
+)
+
+var cmdGenerate = &Command{
+	UsageLine: "generate [kind] [name] [arguments]",
+	Short:     "generate the code of handlers, routes, views, tests and middleware",
+	Long: `
+Generate the boilerplate of an Egret application, from the directory of the
+application or one of its subdirectories. The existing files are left as they are.
+
+The kinds are:
+
+    handler [name] [action...]
+        the handlers of the actions, "index" by default, their routes, views
+        and tests, e.g. app/handlers/pages.go rendering views/pages/about.html
+        at /pages/about for the "about" action of "pages".
+
+    resource [name] [field:type...]
+        the model of a resource, with an in-memory store, the handlers of its
+        CRUD actions rendering HTML views or JSON, their routes and tests.
+        The types are string, text, int, int64, uint, float and bool.
+
+    middleware [name]
+        a handler running before the next ones of the route, and its test.
+
+    view [path]
+        an HTML view, e.g. views/pages/about.html for "pages/about".
+
+    test [name] [action...]
+        the tests of the handlers of the actions of a handler.
+
+The routes are registered by package app/routes, which the main package of the
+application imports.
+
+For example:
+
+    egret generate resource users name:string email:string age:int admin:bool
+
+    egret generate handler pages index about
+
+    egret generate middleware auth
+`,
+}
+
+func init() {
+	cmdGenerate.Run = generateApp
+}
+
+//go:embed generate/*.template
+var generateTemplates embed.FS
+
+// generateFile is a file generated from a template, its path being a template as well.
+type generateFile struct {
+	path, template string
+}
+
+// scaffoldAction is an action of a generated handler.
+type scaffoldAction struct {
+	Name, Func, Path, View string
+}
+
+// scaffoldField is a field of a generated resource.
+type scaffoldField struct {
+	Name, GoName, Type, Input, Label string
+}
+
+// scaffold is the data of the templates of the generated files.
+type scaffold struct {
+	// ImportPath the import path of the application
+	ImportPath string
+	// Name the name of the generated code, e.g. "users"
+	Name string
+	// Singular and Plural the names of the items of a resource, e.g. "user" and "users"
+	Singular, Plural string
+	// Type and Types the Go names of the items of a resource, e.g. "User" and "Users"
+	Type, Types string
+	Actions     []scaffoldAction
+	Fields      []scaffoldField
+}
+
+var fieldTypes = map[string]scaffoldField{
+	"string": {Type: "string", Input: "text"},
+	"text":   {Type: "string", Input: "textarea"},
+	"int":    {Type: "int", Input: "number"},
+	"int64":  {Type: "int64", Input: "number"},
+	"uint":   {Type: "uint", Input: "number"},
+	"float":  {Type: "float64", Input: "number"},
+	"bool":   {Type: "bool", Input: "checkbox"},
+}
+
+func generateApp(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "%s\n%s", cmdGenerate.UsageLine, cmdGenerate.Long)
+		return
+	}
+
+	appPath := findAppPath()
+	if appPath == "" {
+		errorf("Abort: no Egret application (conf/app.yaml) in the current directory or its parents.")
+	}
+	data := newScaffold(args[1])
+	data.ImportPath = appImportPath(appPath)
+
+	var files []generateFile
+	routes := false
+	switch kind, params := args[0], args[2:]; kind {
+	case "handler":
+		data.Actions = handlerActions(data.Name, params)
+		files = []generateFile{
+			{"app/handlers/[[.Name]].go", "handler.go.template"},
+			{"app/handlers/[[.Name]]_test.go", "handler_test.go.template"},
+			{"app/routes/[[.Name]].go", "handler_routes.go.template"},
+		}
+		routes = true
+		for _, action := range data.Actions {
+			files = append(files, generateFile{"views/" + action.View, "view.html.template"})
+		}
+	case "test":
+		data.Actions = handlerActions(data.Name, params)
+		files = []generateFile{{"app/handlers/[[.Name]]_test.go", "handler_test.go.template"}}
+	case "resource":
+		data.Fields = resourceFields(params)
+		files = []generateFile{
+			{"app/models/[[.Singular]].go", "model.go.template"},
+			{"app/handlers/[[.Plural]].go", "resource.go.template"},
+			{"app/handlers/[[.Plural]]_test.go", "resource_test.go.template"},
+			{"app/routes/[[.Plural]].go", "resource_routes.go.template"},
+			{"views/[[.Plural]]/index.html", "resource_index.html.template"},
+			{"views/[[.Plural]]/show.html", "resource_show.html.template"},
+			{"views/[[.Plural]]/form.html", "resource_form.html.template"},
+		}
+		routes = true
+	case "middleware":
+		files = []generateFile{
+			{"app/middleware/[[.Name]].go", "middleware.go.template"},
+			{"app/middleware/[[.Name]]_test.go", "middleware_test.go.template"},
+		}
+	case "view":
+		data.Name = strings.TrimSuffix(data.Name, ".html")
+		data.Actions = []scaffoldAction{{Name: path.Base(data.Name), View: data.Name + ".html"}}
+		files = []generateFile{{"views/" + data.Actions[0].View, "view.html.template"}}
+	default:
+		errorf("Abort: unknown kind %q.\nRun 'egret help generate' for usage.", kind)
+	}
+
+	for _, file := range files {
+		// the views of the actions are rendered with their action
+		fileData := interface{}(data)
+		for _, action := range data.Actions {
+			if file.path == "views/"+action.View {
+				fileData = struct {
+					scaffold
+					Action scaffoldAction
+				}{data, action}
+			}
+		}
+		mustGenerateFile(appPath, file, fileData)
+	}
+	if routes {
+		fmt.Printf("\nThe routes are registered once the main package imports them:\n\n    import _ %q\n", data.ImportPath+"/app/routes")
+	}
+}
+
+// mustGenerateFile renders the template of file into the application, unless
+// the file already exists.
+func mustGenerateFile(appPath string, file generateFile, data interface{}) {
+	var name bytes.Buffer
+	err := newGenerateTemplate(file.path).Execute(&name, data)
+	panicOnError(err, "Failed to render the path "+file.path)
+	destPath := filepath.Join(appPath, filepath.FromSlash(name.String()))
+	if exists(destPath) {
+		fmt.Println("  exists", name.String())
+		return
+	}
+
+	content, err := generateTemplates.ReadFile("generate/" + file.template)
+	panicOnError(err, "Failed to read the template "+file.template)
+	var out bytes.Buffer
+	err = newGenerateTemplate(string(content)).Execute(&out, data)
+	panicOnError(err, "Failed to render the template "+file.template)
+	result := out.Bytes()
+	if strings.HasSuffix(destPath, ".go") {
+		result, err = format.Source(result)
+		panicOnError(err, "Failed to format "+name.String())
+	}
+
+	err = os.MkdirAll(filepath.Dir(destPath), 0777)
+	panicOnError(err, "Failed to create directory "+filepath.Dir(destPath))
+	err = ioutil.WriteFile(destPath, result, 0644)
+	panicOnError(err, "Failed to write "+destPath)
+	fmt.Println("  create", name.String())
+}
+
+// newGenerateTemplate parses a template of the generated files, delimited by
+// [[ ]] so that the views can hold the {{ }} of their own templates.
+func newGenerateTemplate(text string) *template.Template {
+	return template.Must(template.New("generate").Delims("[[", "]]").Funcs(template.FuncMap{
+		"camel": camelCase,
+		"add":   func(a, b int) int { return a + b },
+	}).Parse(text))
+}
+
+// findAppPath returns the closest directory holding conf/app.yaml, empty if none does.
+func findAppPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if exists(filepath.Join(dir, "conf", "app.yaml")) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// appImportPath returns the import path of the application, the module of its
+// go.mod, else its path in GOPATH.
+func appImportPath(appPath string) string {
+	if exists(filepath.Join(appPath, "go.mod")) {
+		if cwd, err := os.Getwd(); err == nil && os.Chdir(appPath) == nil {
+			modName, err := egret.GetModuleName()
+			os.Chdir(cwd)
+			if err == nil {
+				return modName
+			}
+		}
+	}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(gopath, "src") + string(filepath.Separator)
+		if strings.HasPrefix(appPath, src) {
+			return filepath.ToSlash(appPath[len(src):])
+		}
+	}
+	errorf("Abort: failed to find the import path of %s, which has no go.mod and is outside of GOPATH.", appPath)
+	return ""
+}
+
+func newScaffold(name string) scaffold {
+	name = strings.ToLower(strings.Trim(name, "/"))
+	singular := singularName(name)
+	plural := pluralName(singular)
+	return scaffold{
+		Name:     name,
+		Singular: singular,
+		Plural:   plural,
+		Type:     camelCase(singular),
+		Types:    camelCase(plural),
+	}
+}
+
+// handlerActions returns the actions of a handler, "index" by default.
+func handlerActions(name string, actions []string) []scaffoldAction {
+	if len(actions) == 0 {
+		actions = []string{"index"}
+	}
+	var result []scaffoldAction
+	for _, action := range actions {
+		action = strings.ToLower(action)
+		route := "/" + name
+		if action != "index" {
+			route += "/" + action
+		}
+		result = append(result, scaffoldAction{
+			Name: action,
+			Func: camelCase(name) + camelCase(action),
+			Path: route,
+			View: name + "/" + action + ".html",
+		})
+	}
+	return result
+}
+
+// resourceFields parses the name:type arguments of a resource.
+func resourceFields(params []string) []scaffoldField {
+	var fields []scaffoldField
+	for _, param := range params {
+		parts := strings.SplitN(param, ":", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "string")
+		}
+		field, ok := fieldTypes[strings.ToLower(parts[1])]
+		if !ok {
+			errorf("Abort: unknown type %q of field %s.\nRun 'egret help generate' for usage.", parts[1], parts[0])
+		}
+		field.Name = strings.ToLower(parts[0])
+		field.GoName = camelCase(field.Name)
+		if field.GoName == "ID" {
+			errorf("Abort: the id field of a resource is generated.")
+		}
+		field.Label = strings.Replace(strings.Title(strings.Replace(field.Name, "_", " ", -1)), " Id", " ID", -1)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// camelCase returns the exported Go name of a snake or kebab case name, e.g. UserID for user_id.
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '/' || r == ' ' || r == '.'
+	}) {
+		switch upper := strings.ToUpper(word); upper {
+		case "ID", "URL", "HTTP", "API", "JSON", "HTML", "UUID":
+			b.WriteString(upper)
+		default:
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			b.WriteString(string(runes))
+		}
+	}
+	return b.String()
+}
+
+func singularName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "shes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "xes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+func pluralName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "sh"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "x"):
+		return name + "es"
+	}
+	return name + "s"
+}
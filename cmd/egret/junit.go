@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// testEvent is an event of go test -json, see go doc test2json.
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr,omitempty"`
+	Cases     []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+
+	output strings.Builder
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// junitReport collects the events of go test -json as the test suites of a
+// JUnit report, a suite by package.
+type junitReport struct {
+	suites []*junitTestSuite
+	byName map[string]*junitTestSuite
+	cases  map[string]*junitTestCase
+	// output the output of the packages, outside of their tests
+	output map[string]*strings.Builder
+}
+
+func newJUnitReport() *junitReport {
+	return &junitReport{
+		byName: map[string]*junitTestSuite{},
+		cases:  map[string]*junitTestCase{},
+		output: map[string]*strings.Builder{},
+	}
+}
+
+// add adds an event to the report, returning the suite of its package once
+// the package is done.
+func (r *junitReport) add(e testEvent) *junitTestSuite {
+	suite, ok := r.byName[e.Package]
+	if !ok {
+		suite = &junitTestSuite{Name: e.Package}
+		if !e.Time.IsZero() {
+			suite.Timestamp = e.Time.Format("2006-01-02T15:04:05")
+		}
+		r.byName[e.Package] = suite
+		r.suites = append(r.suites, suite)
+		r.output[e.Package] = &strings.Builder{}
+	}
+
+	if e.Test == "" {
+		switch e.Action {
+		case "output":
+			r.output[e.Package].WriteString(e.Output)
+		case "pass", "fail", "skip":
+			suite.Time = formatSeconds(e.Elapsed)
+			if e.Action == "fail" && suite.Failures == 0 {
+				// the package failed outside of its tests, e.g. it doesn't build
+				output := r.output[e.Package].String()
+				suite.Cases = append(suite.Cases, &junitTestCase{Name: "(package)", Classname: e.Package, Time: suite.Time,
+					Failure: &junitFailure{Message: "package failed", Contents: output}})
+				suite.Tests++
+				suite.Failures++
+			}
+			return suite
+		}
+		return nil
+	}
+
+	key := e.Package + "\x00" + e.Test
+	tc, ok := r.cases[key]
+	if !ok {
+		tc = &junitTestCase{Name: e.Test, Classname: e.Package}
+		r.cases[key] = tc
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+	}
+	switch e.Action {
+	case "output":
+		tc.output.WriteString(e.Output)
+	case "pass":
+		tc.Time = formatSeconds(e.Elapsed)
+	case "fail":
+		tc.Time = formatSeconds(e.Elapsed)
+		tc.Failure = &junitFailure{Message: "test failed", Contents: tc.output.String()}
+		suite.Failures++
+	case "skip":
+		tc.Time = formatSeconds(e.Elapsed)
+		tc.Skipped = &junitSkipped{}
+		tc.SystemOut = tc.output.String()
+		suite.Skipped++
+	}
+	return nil
+}
+
+// failed returns true if a test or a package failed.
+func (r *junitReport) failed() bool {
+	for _, suite := range r.suites {
+		if suite.Failures > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the JUnit XML of the suites holding tests.
+func (r *junitReport) write(w io.Writer) error {
+	report := junitTestSuites{}
+	for _, suite := range r.suites {
+		if len(suite.Cases) == 0 {
+			continue
+		}
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -33,10 +33,12 @@ func (cmd *Command) Name() string {
 
 var commands = []*Command{
 	cmdNew,
+	cmdGenerate,
 	cmdRun,
 	cmdBuild,
 	cmdPackage,
 	cmdTest,
+	cmdConfig,
 	cmdVersion,
 }
 var logger *zap.Logger
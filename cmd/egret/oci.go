@@ -0,0 +1,400 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/cmd/harness"
+)
+
+// The media types of an OCI image layout, see https://github.com/opencontainers/image-spec.
+const (
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// ociAppDir is the directory of the application in the image.
+const ociAppDir = "app"
+
+// ociUsers are the users of the image, the ones of the distroless images.
+const (
+	ociPasswd = "root:x:0:0:root:/root:/sbin/nologin\nnonroot:x:65532:65532:nonroot:/home/nonroot:/sbin/nologin\n"
+	ociGroup  = "root:x:0:\nnonroot:x:65532:\n"
+	// ociNonroot is the uid and gid of the nonroot user
+	ociNonroot = 65532
+)
+
+// ociCACertificates are the paths of the CA certificates of the build machine,
+// added to the image for the HTTPS requests of the application.
+var ociCACertificates = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/cert.pem",
+}
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+type ociIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Manifests     []ociDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociImage struct {
+	Created      string          `json:"created"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       ociImageConfig  `json:"config"`
+	RootFS       ociRootFS       `json:"rootfs"`
+	History      []ociHistoryRow `json:"history"`
+}
+
+type ociImageConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint"`
+	WorkingDir   string              `json:"WorkingDir"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	// Healthcheck isn't part of the OCI specification, but of the Docker one,
+	// which Docker and Podman read from the OCI images as well
+	Healthcheck *ociHealthcheck `json:"Healthcheck,omitempty"`
+}
+
+type ociHealthcheck struct {
+	Test        []string      `json:"Test"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociHistoryRow struct {
+	Created   string `json:"created"`
+	CreatedBy string `json:"created_by"`
+}
+
+// ociOptions are the options of the image, the package.oci section of app.yaml
+// by default.
+type ociOptions struct {
+	name, user string
+}
+
+// resolve completes the options with the package.oci section of app.yaml.
+func (o *ociOptions) resolve() {
+	if o.name == "" {
+		o.name = egret.Config.GetStringDefault("package.oci.name", "")
+	}
+	if o.name == "" {
+		version := invalidTagChars.ReplaceAllString(harness.AppVersion(logger), "-")
+		if version == "" {
+			version = "latest"
+		}
+		o.name = strings.ToLower(egret.AppName) + ":" + version
+	}
+	if o.user == "" {
+		o.user = egret.Config.GetStringDefault("package.oci.user", "65532:65532")
+	}
+}
+
+// mustWriteOCIImage writes the image of the builds to an OCI image layout, in
+// the directory of output, else in its tarball if it ends with ".tar".
+// The image of several targets is a multi-platform image.
+func mustWriteOCIImage(output, appImportPath, mode string, built []builtTarget, opts ociOptions) string {
+	layoutDir := output
+	tarball := strings.HasSuffix(output, ".tar")
+	if tarball {
+		var err error
+		layoutDir, err = ioutil.TempDir("", "egret-oci")
+		panicOnError(err, "Failed to get temp dir")
+		defer os.RemoveAll(layoutDir)
+	} else if exists(layoutDir) {
+		if !empty(layoutDir) && !exists(filepath.Join(layoutDir, "oci-layout")) {
+			errorf("Abort: %s exists and does not look like an OCI image layout.", layoutDir)
+		}
+		os.RemoveAll(layoutDir)
+	}
+	err := os.MkdirAll(filepath.Join(layoutDir, "blobs", "sha256"), 0777)
+	panicOnError(err, "Failed to create directory "+layoutDir)
+
+	created := harness.BuildTime()
+	var manifests []ociDescriptor
+	for _, b := range built {
+		manifests = append(manifests, mustWriteOCIManifest(layoutDir, appImportPath, mode, b, opts, created))
+	}
+
+	refName := map[string]string{ociRefNameAnnotation: opts.name}
+	top := manifests[0]
+	if len(manifests) > 1 {
+		top = mustWriteOCIBlob(layoutDir, ociIndexMediaType, ociIndex{
+			SchemaVersion: 2,
+			MediaType:     ociIndexMediaType,
+			Manifests:     manifests,
+		})
+	}
+	top.Annotations = refName
+	mustWriteOCIJSON(filepath.Join(layoutDir, "index.json"), ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociIndexMediaType,
+		Manifests:     []ociDescriptor{top},
+	})
+	mustWriteOCIJSON(filepath.Join(layoutDir, "oci-layout"), map[string]string{"imageLayoutVersion": "1.0.0"})
+
+	if tarball {
+		os.Remove(output)
+		return mustTarDir(output, layoutDir)
+	}
+	return layoutDir
+}
+
+// mustWriteOCIManifest writes the layer, the configuration and the manifest of
+// the image of a build, and returns the descriptor of the manifest.
+func mustWriteOCIManifest(layoutDir, appImportPath, mode string, b builtTarget, opts ociOptions, created time.Time) ociDescriptor {
+	layer, diffID := mustWriteOCILayer(layoutDir, b, created)
+
+	binary := "/" + path.Join(ociAppDir, filepath.Base(b.binary))
+	config := ociImageConfig{
+		User:       opts.user,
+		Entrypoint: []string{binary, "-importPath", appImportPath, "-srcPath", "/" + path.Join(ociAppDir, "src"), "-runMode", mode},
+		WorkingDir: "/" + ociAppDir,
+		Labels:     egret.Config.GetStringMapStringDefault("package.oci.labels", nil),
+	}
+	if egret.Config.GetStringDefault("serve.network", "tcp") == "tcp" {
+		config.ExposedPorts = map[string]struct{}{strconv.Itoa(egret.HttpPort) + "/tcp": {}}
+	}
+	if test := egret.Config.GetStringSliceDefault("package.oci.healthcheck.test", nil); len(test) > 0 {
+		config.Healthcheck = &ociHealthcheck{
+			Test:        test,
+			Interval:    egret.Config.GetDurationDefault("package.oci.healthcheck.interval", 30*time.Second),
+			Timeout:     egret.Config.GetDurationDefault("package.oci.healthcheck.timeout", 5*time.Second),
+			StartPeriod: egret.Config.GetDurationDefault("package.oci.healthcheck.start_period", 0),
+			Retries:     egret.Config.GetIntDefault("package.oci.healthcheck.retries", 3),
+		}
+	}
+
+	platform := &ociPlatform{Architecture: b.target.Arch(), OS: b.target.OS()}
+	configDesc := mustWriteOCIBlob(layoutDir, ociConfigMediaType, ociImage{
+		Created:      created.Format(time.RFC3339),
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Config:       config,
+		RootFS:       ociRootFS{Type: "layers", DiffIDs: []string{diffID}},
+		History:      []ociHistoryRow{{Created: created.Format(time.RFC3339), CreatedBy: "egret package --format=oci"}},
+	})
+	manifest := mustWriteOCIBlob(layoutDir, ociManifestMediaType, ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        configDesc,
+		Layers:        []ociDescriptor{layer},
+		Annotations: map[string]string{
+			"org.opencontainers.image.created": created.Format(time.RFC3339),
+			"org.opencontainers.image.title":   egret.AppName,
+		},
+	})
+	manifest.Platform = platform
+	return manifest
+}
+
+// mustWriteOCILayer writes the layer of a build, the files of a distroless
+// image along with the binary, the conf and the views of the application in
+// /app, and returns its descriptor and the digest of its uncompressed content.
+func mustWriteOCILayer(layoutDir string, b builtTarget, created time.Time) (ociDescriptor, string) {
+	f, err := ioutil.TempFile(filepath.Join(layoutDir, "blobs", "sha256"), ".layer")
+	panicOnError(err, "Failed to create the layer")
+	defer os.Remove(f.Name())
+
+	digest, diffID := sha256.New(), sha256.New()
+	size := &countingWriter{w: io.MultiWriter(f, digest)}
+	gz := gzip.NewWriter(size)
+	tw := tar.NewWriter(io.MultiWriter(gz, diffID))
+
+	// the entries have the build time, the one of SOURCE_DATE_EPOCH for a reproducible image
+	writeDir := func(name string, mode int64, owner int) {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: mode, Uid: owner, Gid: owner, ModTime: created})
+		panicOnError(err, "Failed to write the layer")
+	}
+	writeFile := func(name string, mode int64, content []byte) {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: mode, Size: int64(len(content)), ModTime: created})
+		panicOnError(err, "Failed to write the layer")
+		_, err = tw.Write(content)
+		panicOnError(err, "Failed to write the layer")
+	}
+
+	writeDir("etc", 0755, 0)
+	writeFile("etc/passwd", 0644, []byte(ociPasswd))
+	writeFile("etc/group", 0644, []byte(ociGroup))
+	for _, fname := range ociCACertificates {
+		if content, err := ioutil.ReadFile(fname); err == nil {
+			writeDir("etc/ssl", 0755, 0)
+			writeDir("etc/ssl/certs", 0755, 0)
+			writeFile("etc/ssl/certs/ca-certificates.crt", 0644, content)
+			break
+		}
+	}
+	writeDir("home", 0755, 0)
+	writeDir("home/nonroot", 0700, ociNonroot)
+	writeDir("tmp", 01777, 0)
+
+	// the build but its run scripts and checksums
+	writeDir(ociAppDir, 0755, 0)
+	var names []string
+	egret.Walk(b.dir, func(srcPath string, info os.FileInfo, err error) error {
+		if err == nil && srcPath != b.dir {
+			names = append(names, srcPath)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	for _, srcPath := range names {
+		rel := filepath.ToSlash(strings.TrimLeft(srcPath[len(b.dir):], string(os.PathSeparator)))
+		if rel == "run.sh" || rel == "run.bat" || rel == "SHA256SUMS" {
+			continue
+		}
+		info, err := os.Stat(srcPath)
+		panicOnError(err, "Failed to read "+srcPath)
+		name := path.Join(ociAppDir, rel)
+		if info.IsDir() {
+			writeDir(name, 0755, 0)
+			continue
+		}
+		content, err := ioutil.ReadFile(srcPath)
+		panicOnError(err, "Failed to read "+srcPath)
+		mode := int64(0644)
+		if srcPath == b.binary {
+			mode = 0755
+		}
+		writeFile(name, mode, content)
+	}
+
+	panicOnError(tw.Close(), "Failed to write the layer")
+	panicOnError(gz.Close(), "Failed to write the layer")
+	panicOnError(f.Close(), "Failed to write the layer")
+
+	hexDigest := hex.EncodeToString(digest.Sum(nil))
+	err = os.Rename(f.Name(), filepath.Join(layoutDir, "blobs", "sha256", hexDigest))
+	panicOnError(err, "Failed to write the layer")
+	return ociDescriptor{MediaType: ociLayerMediaType, Digest: "sha256:" + hexDigest, Size: size.n}, digestOf(diffID)
+}
+
+// mustWriteOCIBlob writes the JSON of v as a blob, and returns its descriptor.
+func mustWriteOCIBlob(layoutDir, mediaType string, v interface{}) ociDescriptor {
+	content, err := json.Marshal(v)
+	panicOnError(err, "Failed to marshal "+mediaType)
+	sum := sha256.Sum256(content)
+	hexDigest := hex.EncodeToString(sum[:])
+	err = ioutil.WriteFile(filepath.Join(layoutDir, "blobs", "sha256", hexDigest), content, 0644)
+	panicOnError(err, "Failed to write "+mediaType)
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + hexDigest, Size: int64(len(content))}
+}
+
+func mustWriteOCIJSON(fname string, v interface{}) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	panicOnError(err, "Failed to marshal "+fname)
+	err = ioutil.WriteFile(fname, append(content, '\n'), 0644)
+	panicOnError(err, "Failed to write "+fname)
+}
+
+// mustTarDir writes the files of srcDir to an uncompressed tarball, the OCI
+// image layout of an image archive.
+func mustTarDir(destFilename, srcDir string) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	var names []string
+	egret.Walk(srcDir, func(srcPath string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			names = append(names, srcPath)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	for _, srcPath := range names {
+		content, err := ioutil.ReadFile(srcPath)
+		panicOnError(err, "Failed to read "+srcPath)
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(strings.TrimLeft(srcPath[len(srcDir):], string(os.PathSeparator))),
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  harness.BuildTime(),
+		})
+		panicOnError(err, "Failed to write tar entry header")
+		_, err = tw.Write(content)
+		panicOnError(err, "Failed to write "+destFilename)
+	}
+	panicOnError(tw.Close(), "Failed to write "+destFilename)
+	err := ioutil.WriteFile(destFilename, buf.Bytes(), 0644)
+	panicOnError(err, "Failed to write "+destFilename)
+	return destFilename
+}
+
+func digestOf(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// describeOCIImage returns a line describing the image, for the output of egret package.
+func describeOCIImage(name string, built []builtTarget) string {
+	var platforms []string
+	for _, b := range built {
+		platforms = append(platforms, b.target.String())
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(platforms, ", "))
+}
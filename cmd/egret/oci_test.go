@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/cmd/harness"
+	"github.com/kenorld/egret/conf"
+)
+
+// readOCIBlob returns the content of the blob of desc, checking its digest and size.
+func readOCIBlob(t *testing.T, layoutDir string, desc ociDescriptor) []byte {
+	content, err := ioutil.ReadFile(filepath.Join(layoutDir, "blobs", "sha256", desc.Digest[len("sha256:"):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(content); "sha256:"+hex.EncodeToString(sum[:]) != desc.Digest {
+		t.Errorf("The content of the %s blob doesn't match its digest %s", desc.MediaType, desc.Digest)
+	}
+	if int64(len(content)) != desc.Size {
+		t.Errorf("Expected the %s blob to have the size %d, got %d", desc.MediaType, desc.Size, len(content))
+	}
+	return content
+}
+
+func TestMustWriteOCIImage(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: sample\n"), 0666)
+	buildDir := filepath.Join(dir, "build")
+	os.MkdirAll(filepath.Join(buildDir, "src", "conf"), 0777)
+	ioutil.WriteFile(filepath.Join(buildDir, "sample"), []byte("binary"), 0755)
+	ioutil.WriteFile(filepath.Join(buildDir, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	ioutil.WriteFile(filepath.Join(buildDir, "src", "conf", "app.yaml"), []byte("name: sample\n"), 0644)
+	built := []builtTarget{{
+		target: harness.Target{GOOS: "linux", GOARCH: "arm64"},
+		dir:    buildDir,
+		binary: filepath.Join(buildDir, "sample"),
+	}}
+
+	defer func(config *conf.Context, name string) { egret.Config, egret.AppName = config, name }(egret.Config, egret.AppName)
+	egret.Config, _ = conf.LoadContext("app", []string{dir})
+	egret.AppName = "sample"
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	layoutDir := mustWriteOCIImage(filepath.Join(dir, "sample-oci"), "github.com/acme/sample", "prod", built, ociOptions{name: "sample:1.0", user: "65532:65532"})
+
+	var index ociIndex
+	content, _ := ioutil.ReadFile(filepath.Join(layoutDir, "index.json"))
+	if err := json.Unmarshal(content, &index); err != nil || len(index.Manifests) != 1 {
+		t.Fatalf("Unexpected index %s: %v", content, err)
+	}
+	if name := index.Manifests[0].Annotations[ociRefNameAnnotation]; name != "sample:1.0" {
+		t.Errorf("Expected the name of the image, got %q", name)
+	}
+	if platform := index.Manifests[0].Platform; platform == nil || platform.OS != "linux" || platform.Architecture != "arm64" {
+		t.Errorf("Unexpected platform %+v", platform)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(readOCIBlob(t, layoutDir, index.Manifests[0]), &manifest); err != nil || len(manifest.Layers) != 1 {
+		t.Fatalf("Unexpected manifest %+v: %v", manifest, err)
+	}
+	var image ociImage
+	if err := json.Unmarshal(readOCIBlob(t, layoutDir, manifest.Config), &image); err != nil {
+		t.Fatal(err)
+	}
+	if image.Created != "2023-11-14T22:13:20Z" || image.Config.User != "65532:65532" || image.Config.Entrypoint[0] != "/app/sample" {
+		t.Errorf("Unexpected image configuration %+v", image)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(readOCIBlob(t, layoutDir, manifest.Layers[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID := sha256.New()
+	tr := tar.NewReader(io.TeeReader(gz, diffID))
+	headers := map[string]*tar.Header{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		headers[header.Name] = header
+	}
+	io.Copy(ioutil.Discard, gz)
+	if len(image.RootFS.DiffIDs) != 1 || image.RootFS.DiffIDs[0] != digestOf(diffID) {
+		t.Errorf("Expected the diff id %s, got %v", digestOf(diffID), image.RootFS.DiffIDs)
+	}
+
+	if home := headers["home/nonroot/"]; home == nil || home.Uid != ociNonroot || home.Gid != ociNonroot || home.Mode != 0700 {
+		t.Errorf("Expected the home of the nonroot user to be its own, got %+v", home)
+	}
+	if binary := headers["app/sample"]; binary == nil || binary.Mode != 0755 {
+		t.Errorf("Expected the executable binary, got %+v", binary)
+	}
+	if headers["app/src/conf/app.yaml"] == nil {
+		t.Errorf("Expected the configuration of the application")
+	}
+	if headers["app/run.sh"] != nil {
+		t.Errorf("Expected the run scripts to be left out")
+	}
+	if !exists(filepath.Join(layoutDir, "oci-layout")) {
+		t.Errorf("Expected the oci-layout file")
+	}
+}
@@ -5,25 +5,49 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/kenorld/egret"
 )
 
 var cmdPackage = &Command{
-	UsageLine: "package [import path] [run mode]",
+	UsageLine: "package [import path] [run mode] [flags]",
 	Short:     "package a Egret application (e.g. for deployment)",
 	Long: `
 Package the Egret web application named by the given import path.
 This allows it to be deployed and run on a machine that lacks a Go installation.
+The views of the application are embedded in its binary.
 
 The run mode is used to select which set of app.yaml configuration should
 apply and may be used to determine logic in the application itself.
 
 Run mode defaults to "dev".
 
+The flags are the ones of egret build, see "egret help build". Each target of
+--target, --goos and --goarch, or build.targets, has its archive, named after
+its os and arch, e.g. chat-linux-arm64.tar.gz, and --checksums writes their
+SHA-256 checksums to SHA256SUMS. The entries of the archives have the time
+of the SOURCE_DATE_EPOCH environment variable, if set.
+
+With --format=oci, or package.format, the application is packaged as an OCI
+image instead, without a Docker daemon: a distroless-like image of its static
+linux binary, its conf and views, running as package.oci.user and exposing
+serve.port, with the health check of package.oci.healthcheck. The image of
+several targets is a multi-platform one. The other flags are:
+
+    --output  the directory of the OCI image layout, chat-oci by default, or
+              its tarball if it ends with .tar, e.g. for skopeo or podman load
+    --name    the reference of the image, package.oci.name by default, else
+              the name and the version of the application, e.g. chat:1.0
+    --user    the user the application runs as, package.oci.user by default
+
 For example:
 
     egret package github.com/kenorld/egret/samples/chat
+
+    egret package github.com/kenorld/egret/samples/chat prod --target=linux/amd64,darwin/arm64 --trimpath --checksums
+
+    egret package github.com/kenorld/egret/samples/chat prod --format=oci --output=chat.tar
 `,
 }
 
@@ -32,6 +56,14 @@ func init() {
 }
 
 func packageApp(args []string) {
+	opts, image := &buildOptions{}, ociOptions{}
+	var format, output string
+	fs := opts.flagSet("package")
+	fs.StringVar(&format, "format", "", "the format of the package, tar or oci")
+	fs.StringVar(&output, "output", "", "the directory or the tarball of the OCI image layout")
+	fs.StringVar(&image.name, "name", "", "the reference of the OCI image")
+	fs.StringVar(&image.user, "user", "", "the user of the OCI image")
+	args = parseFlags(fs, args)
 	if len(args) == 0 {
 		fmt.Fprint(os.Stderr, cmdPackage.Long)
 		return
@@ -45,19 +77,71 @@ func packageApp(args []string) {
 
 	appImportPath := args[0]
 	egret.Init(mode, appImportPath, "")
-
-	// Remove the archive if it already exists.
-	destFile := filepath.Base(egret.BasePath) + ".tar.gz"
-	os.Remove(destFile)
+	if format == "" {
+		format = egret.Config.GetStringDefault("package.format", "tar")
+	}
+	if format != "tar" && format != "oci" {
+		errorf("Abort: unknown format %q.\nRun 'egret help package' for usage.", format)
+	}
+	if format == "oci" {
+		// the images run static linux binaries, without the libc of the build machine
+		opts.static = true
+		if opts.targets == "" && opts.goos == "" && len(egret.Config.GetStringSliceDefault("build.targets", nil)) == 0 {
+			opts.goos = "linux"
+		}
+		if output != "" {
+			opts.outputs = append(opts.outputs, output)
+		}
+		for _, target := range opts.buildTargets() {
+			if target.OS() != "linux" {
+				errorf("Abort: the OCI images run linux binaries, not %s ones.", target)
+			}
+		}
+	}
 
 	// Collect stuff in a temp directory.
 	tmpDir, err := ioutil.TempDir("", filepath.Base(egret.BasePath))
 	panicOnError(err, "Failed to get temp dir")
+	defer os.RemoveAll(tmpDir)
 
-	buildApp([]string{args[0], tmpDir, mode})
+	built := buildTargets(appImportPath, tmpDir, mode, opts)
+	if format == "oci" {
+		packageImage(appImportPath, mode, built, output, image, opts.checksums)
+		return
+	}
 
-	// Create the zip file.
-	archiveName := mustTarGzDir(destFile, tmpDir)
+	// Create an archive by target.
+	var archives []string
+	for _, b := range built {
+		destFile := filepath.Base(egret.BasePath)
+		if len(built) > 1 || !b.target.IsZero() {
+			destFile += "-" + b.target.OS() + "-" + b.target.Arch()
+		}
+		destFile += ".tar.gz"
+
+		// Remove the archive if it already exists.
+		os.Remove(destFile)
+		archives = append(archives, mustTarGzDir(destFile, b.dir))
+	}
+	if opts.checksums {
+		mustWriteChecksums("SHA256SUMS", ".", archives)
+	}
 
-	fmt.Println("Your archive is ready:", archiveName)
+	for _, archive := range archives {
+		fmt.Println("Your archive is ready:", archive)
+	}
+}
+
+// packageImage writes the OCI image of the builds to output.
+func packageImage(appImportPath, mode string, built []builtTarget, output string, image ociOptions, checksums bool) {
+	if output == "" {
+		output = filepath.Base(egret.BasePath) + "-oci"
+	}
+	image.resolve()
+
+	output = mustWriteOCIImage(output, appImportPath, mode, built, image)
+	if checksums && strings.HasSuffix(output, ".tar") {
+		mustWriteChecksums("SHA256SUMS", ".", []string{output})
+	}
+	fmt.Println("Your image is ready:", describeOCIImage(image.name, built), "in", output)
 }
@@ -2,9 +2,13 @@ package main
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -12,6 +16,7 @@ import (
 	"text/template"
 
 	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/cmd/harness"
 )
 
 // Use a wrapper to differentiate logged panics from unexpected ones.
@@ -73,7 +78,7 @@ func mustCopyDir(destDir, srcDir string, skipGoFile bool, data map[string]interf
 		destPath := path.Join(destDir, relSrcPath)
 
 		// Skip dot files and dot directories.
-		if strings.HasPrefix(relSrcPath, ".") {
+		if strings.HasPrefix(info.Name(), ".") && relSrcPath != "" {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -120,11 +125,16 @@ func mustTarGzDir(destFilename, srcDir string) string {
 		panicOnError(err, "Failed to read source file")
 		defer srcFile.Close()
 
+		// the entries of a reproducible build have the time of SOURCE_DATE_EPOCH
+		modTime := info.ModTime()
+		if os.Getenv("SOURCE_DATE_EPOCH") != "" {
+			modTime = harness.BuildTime()
+		}
 		err = tarWriter.WriteHeader(&tar.Header{
-			Name:    strings.TrimLeft(srcPath[len(srcDir):], string(os.PathSeparator)),
+			Name:    filepath.ToSlash(strings.TrimLeft(srcPath[len(srcDir):], string(os.PathSeparator))),
 			Size:    info.Size(),
 			Mode:    int64(info.Mode()),
-			ModTime: info.ModTime(),
+			ModTime: modTime,
 		})
 		panicOnError(err, "Failed to write tar entry header")
 
@@ -137,6 +147,43 @@ func mustTarGzDir(destFilename, srcDir string) string {
 	return zipFile.Name()
 }
 
+// mustWriteChecksums writes the SHA-256 checksums of files, in the format of
+// sha256sum, their names being relative to dir.
+func mustWriteChecksums(destFilename, dir string, files []string) {
+	var sums bytes.Buffer
+	for _, fname := range files {
+		f, err := os.Open(fname)
+		panicOnError(err, "Failed to open "+fname)
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		panicOnError(err, "Failed to read "+fname)
+
+		name, err := filepath.Rel(dir, fname)
+		panicOnError(err, "Failed to find "+fname)
+		fmt.Fprintf(&sums, "%x  %s\n", h.Sum(nil), filepath.ToSlash(name))
+	}
+	err := ioutil.WriteFile(destFilename, sums.Bytes(), 0644)
+	panicOnError(err, "Failed to write "+destFilename)
+}
+
+// parseFlags parses the flags of fs wherever they are in args, e.g. after the
+// import path, and returns the other arguments.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var rest []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest
+		}
+		if args[0] == "--" {
+			return append(rest, args[1:]...)
+		}
+		rest, args = append(rest, args[0]), args[1:]
+	}
+}
+
 func exists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil
@@ -45,18 +45,91 @@ func getModuleNameFromModfile(fpath string) (string, error) {
 	return "", errors.New("parse module file unknown error")
 }
 
+// Target is a platform the app is cross-compiled for, e.g. linux/amd64.
+// The zero Target is the platform of the GOOS and GOARCH environment
+// variables, else the one of egret itself.
+type Target struct {
+	GOOS, GOARCH string
+}
+
+// ParseTarget parses a target written as os/arch, e.g. "linux/arm64".
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Target{}, fmt.Errorf("invalid target %q, expected os/arch, e.g. linux/amd64", s)
+	}
+	return Target{GOOS: parts[0], GOARCH: parts[1]}, nil
+}
+
+// IsZero returns true for the target of the environment.
+func (t Target) IsZero() bool {
+	return t.GOOS == "" && t.GOARCH == ""
+}
+
+// OS returns the os of the target, the one of the environment by default.
+func (t Target) OS() string {
+	if t.GOOS != "" {
+		return t.GOOS
+	}
+	if goos := os.Getenv("GOOS"); goos != "" {
+		return goos
+	}
+	return runtime.GOOS
+}
+
+// Arch returns the architecture of the target, the one of the environment by default.
+func (t Target) Arch() string {
+	if t.GOARCH != "" {
+		return t.GOARCH
+	}
+	if goarch := os.Getenv("GOARCH"); goarch != "" {
+		return goarch
+	}
+	return runtime.GOARCH
+}
+
+func (t Target) String() string {
+	return t.OS() + "/" + t.Arch()
+}
+
+// BuildOptions are the options of the go build of the app.
+type BuildOptions struct {
+	Target Target
+	// Tags the build tags added to the ones of build.tags
+	Tags string
+	// TrimPath removes the paths of the build machine from the binary
+	TrimPath bool
+	// LDFlags the linker flags added to the ones setting the version
+	LDFlags string
+	// Output the path of the binary, the one of egret run if empty
+	Output string
+	// Static disables cgo, for a binary without dynamic libraries, e.g. in a container image
+	Static bool
+	// Flags the other flags of go build
+	Flags []string
+}
+
 // Build the app:
 // 1. Generate the the main.go file.
 // 2. Run the appropriate "go build" command.
 // Requires that egret.Init has been called previously.
 // Returns the path to the built binary, and an error if there was a problem building it.
 func Build(logger *zap.Logger, buildFlags ...string) (app *App, compileError *egret.Error) {
-	if compileError != nil {
-		return nil, compileError
-	}
+	return BuildTarget(logger, BuildOptions{Flags: buildFlags})
+}
 
+// BuildTarget builds the app with the given options, e.g. for another platform.
+// The version of the app, see AppVersion, and its build time are set in
+// egret.AppVersion and egret.AppBuildTime.
+func BuildTarget(logger *zap.Logger, opts BuildOptions) (app *App, compileError *egret.Error) {
 	// Read build config.
 	buildTags := egret.Config.GetStringDefault("build.tags", "")
+	if opts.Tags != "" {
+		if buildTags != "" {
+			buildTags += ","
+		}
+		buildTags += opts.Tags
+	}
 
 	// Build the user program (all code under app).
 	// It relies on the user having "go" installed.
@@ -65,22 +138,15 @@ func Build(logger *zap.Logger, buildFlags ...string) (app *App, compileError *eg
 		logger.Fatal("Go executable not found in PATH")
 	}
 
-	// pkg, err := build.Default.Import(egret.ImportPath, "", build.FindOnly)
-	// if err != nil {
-	// 	logger.Warn("Failure importing", zap.String("import_path", egret.ImportPath))
-	// }
-	// // Binary path is a combination of $GOBIN/egret.d directory, app's import path and its name.
-	// binName := filepath.Join(pkg.BinDir, "egret.d", egret.ImportPath, filepath.Base(egret.BasePath))
-
-	binName := ""
-	if egret.IsGoModule {
+	binName := opts.Output
+	if binName == "" && egret.IsGoModule {
 		if modName, err := egret.GetModuleName(); err == nil {
 			binName = filepath.Join(egret.BasePath, "bin", ".tmp", filepath.Base(modName))
 			logger.Info("App is build in go modules mode")
 		} else {
 			logger.Fatal("Failed to get module name")
 		}
-	} else {
+	} else if binName == "" {
 		for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
 			if strings.HasPrefix(egret.BasePath, gopath) {
 				binName = filepath.Join(gopath, "bin", "egret.d", egret.ImportPath, filepath.Base(egret.BasePath))
@@ -91,36 +157,48 @@ func Build(logger *zap.Logger, buildFlags ...string) (app *App, compileError *eg
 	}
 
 	// Change binary path for Windows build
-	goos := runtime.GOOS
-	if goosEnv := os.Getenv("GOOS"); goosEnv != "" {
-		goos = goosEnv
-	}
-	if goos == "windows" {
+	if opts.Target.OS() == "windows" && !strings.HasSuffix(binName, ".exe") {
 		binName += ".exe"
 	}
 
+	env := os.Environ()
+	if !opts.Target.IsZero() {
+		env = append(env, "GOOS="+opts.Target.OS(), "GOARCH="+opts.Target.Arch())
+	}
+	// cgo doesn't cross-compile without a C cross-compiler
+	if opts.Static || os.Getenv("CGO_ENABLED") == "" && (opts.Target.OS() != runtime.GOOS || opts.Target.Arch() != runtime.GOARCH) {
+		env = append(env, "CGO_ENABLED=0")
+	}
+
 	gotten := make(map[string]struct{})
 	for {
-		appVersion := getAppVersion(logger)
-		buildTime := time.Now().UTC().Format(time.RFC3339)
-		versionLinkerFlags := fmt.Sprintf("-X %s/app.AppVersion=%s -X %s/app.BuildTime=%s",
-			egret.ImportPath, appVersion, egret.ImportPath, buildTime)
+		appVersion := AppVersion(logger)
+		buildTime := BuildTime().Format(time.RFC3339)
+		versionLinkerFlags := fmt.Sprintf("-X %s/app.AppVersion=%s -X %s/app.BuildTime=%s -X %s.AppVersion=%s -X %s.AppBuildTime=%s",
+			egret.ImportPath, appVersion, egret.ImportPath, buildTime,
+			egret.EgretImportPath, appVersion, egret.EgretImportPath, buildTime)
+		if opts.LDFlags != "" {
+			versionLinkerFlags += " " + opts.LDFlags
+		}
 
 		flags := []string{
 			"build",
-			"-i",
 			"-ldflags", versionLinkerFlags,
 			"-tags", buildTags,
 			"-o", binName}
+		if opts.TrimPath {
+			flags = append(flags, "-trimpath")
+		}
 
 		// Add in build flags
-		flags = append(flags, buildFlags...)
+		flags = append(flags, opts.Flags...)
 
 		// The main path
 		flags = append(flags, path.Join(egret.ImportPath))
 
 		buildCmd := exec.Command(goPath, flags...)
-		logger.Info("Exec command", zap.Strings("args", buildCmd.Args))
+		buildCmd.Env = env
+		logger.Info("Exec command", zap.String("target", opts.Target.String()), zap.Strings("args", buildCmd.Args))
 		output, err := buildCmd.CombinedOutput()
 
 		// If the build succeeded, we're done.
@@ -157,13 +235,25 @@ func Build(logger *zap.Logger, buildFlags ...string) (app *App, compileError *eg
 	return nil, nil
 }
 
-// Try to define a version string for the compiled app
+// BuildTime returns the time the app is built at, the one of the
+// SOURCE_DATE_EPOCH environment variable for the reproducible builds,
+// see https://reproducible-builds.org/specs/source-date-epoch/.
+func BuildTime() time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if seconds, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// AppVersion tries to define a version string for the compiled app
 // The following is tried (first match returns):
 // - Read a version explicitly specified in the APP_VERSION environment
 //   variable
 // - Read the output of "git describe" if the source is in a git repository
 // If no version can be determined, an empty string is returned.
-func getAppVersion(logger *zap.Logger) string {
+func AppVersion(logger *zap.Logger) string {
 	if version := os.Getenv("APP_VERSION"); version != "" {
 		return version
 	}
@@ -5,16 +5,37 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
 )
 
-var compressionTypes = [...]string{
+// compressionTypes lists the supported encodings by order of preference,
+// used to break ties between the encodings a client accepts equally.
+var compressionTypes = []string{
+	"br",
+	"zstd",
 	"gzip",
 	"deflate",
 }
 
+// defaultCompressionLevels are the levels used unless "compress.level.<encoding>"
+// is set. They favor speed, as responses are compressed on the fly.
+var defaultCompressionLevels = map[string]int{
+	"br":      4,
+	"zstd":    int(zstd.SpeedDefault),
+	"gzip":    gzip.DefaultCompression,
+	"deflate": zlib.DefaultCompression,
+}
+
+// DefaultCompressionMinSize is the size under which responses are sent
+// uncompressed unless "compress.min_size" is set.
+const DefaultCompressionMinSize = 1024
+
 var compressableMimes = []string{
 	"text/plain",
 	"text/html",
@@ -35,14 +56,31 @@ type WriteFlusher interface {
 	Flush() error
 }
 
+// resetWriteFlusher is a WriteFlusher which can be reused for another
+// destination, so it can be pooled.
+type resetWriteFlusher interface {
+	WriteFlusher
+	Reset(w io.Writer)
+}
+
+// encoderPools holds a *sync.Pool of encoders per "encoding:level".
+var encoderPools sync.Map
+
 type CompressResponseWriter struct {
 	http.ResponseWriter
-	compressWriter  WriteFlusher
-	compressionType string
-	headersWritten  bool
-	closeNotify     chan bool
-	parentNotify    <-chan bool
-	closed          bool
+	compressWriter   WriteFlusher
+	compressionType  string
+	compressionLevel int
+	// minSize is the size of the body under which it is sent uncompressed,
+	// buffered until it is reached.
+	minSize        int
+	buffer         []byte
+	status         int
+	prepared       bool
+	headersWritten bool
+	closeNotify    chan bool
+	parentNotify   <-chan bool
+	closed         bool
 }
 
 func appendMime(slice []string, i string) []string {
@@ -61,8 +99,14 @@ func CompressHandler(ctx *Context) {
 			compressableMimes = appendMime(compressableMimes, mime)
 		}
 
-		if ctx.Response.Status != http.StatusNoContent && ctx.Response.Status != http.StatusNotModified {
-			writer := CompressResponseWriter{ctx.Response.Writer, nil, "", false, make(chan bool, 1), nil, false}
+		// the responses to HEAD requests have no body to compress
+		if ctx.Request.Method != http.MethodHead && bodyAllowed(ctx.Response.Status) {
+			writer := CompressResponseWriter{
+				ResponseWriter: ctx.Response.Writer,
+				minSize:        Config.GetIntDefault("compress.min_size", DefaultCompressionMinSize),
+				status:         http.StatusOK,
+				closeNotify:    make(chan bool, 1),
+			}
 			writer.DetectCompressionType(ctx.Request, ctx.Response)
 			w, ok := ctx.Response.Writer.(http.CloseNotifier)
 			if ok {
@@ -81,6 +125,11 @@ func (c CompressResponseWriter) CloseNotify() <-chan bool {
 }
 
 func (c *CompressResponseWriter) prepareHeaders() {
+	c.prepared = true
+	if !bodyAllowed(c.status) {
+		// e.g. the 304 Not Modified of ETagResponseWriter
+		c.compressionType = ""
+	}
 	if c.compressionType != "" {
 		responseMime := c.Header().Get("Content-Type")
 		responseMime = strings.TrimSpace(strings.SplitN(responseMime, ";", 2)[0])
@@ -90,12 +139,19 @@ func (c *CompressResponseWriter) prepareHeaders() {
 			for _, compressableMime := range compressableMimes {
 				if responseMime == compressableMime {
 					shouldEncode = true
-					c.Header().Set("Content-Encoding", c.compressionType)
-					c.Header().Del("Content-Length")
+					c.Header().Add(varyHeaderKey, AcceptEncodingHeader)
+					// the encodings of the body aren't byte-for-byte equal
+					if etag := c.Header().Get(ETagHeader); etag != "" && !strings.HasPrefix(etag, "W/") {
+						c.Header().Set(ETagHeader, "W/"+etag)
+					}
 					break
 				}
 			}
 		}
+		// Don't wait for the body when its length is known to be too small.
+		if length, err := strconv.Atoi(c.Header().Get("Content-Length")); err == nil && length < c.minSize {
+			shouldEncode = false
+		}
 
 		if !shouldEncode {
 			c.compressWriter = nil
@@ -104,15 +160,83 @@ func (c *CompressResponseWriter) prepareHeaders() {
 	}
 }
 
-func (c *CompressResponseWriter) WriteHeader(status int) {
+// bodyAllowed returns false for the statuses of the responses without body,
+// 1xx, 204 No Content and 304 Not Modified.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// writeHeaders sends the status and headers to the parent writer, with the
+// body compressed if compress is true, then the buffered body.
+func (c *CompressResponseWriter) writeHeaders(compress bool) error {
 	c.headersWritten = true
+	if compress {
+		c.Header().Set("Content-Encoding", c.compressionType)
+		c.Header().Del("Content-Length")
+		c.compressWriter = getEncoder(c.compressionType, c.compressionLevel, c.ResponseWriter)
+	} else {
+		c.compressionType = ""
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buffer := c.buffer
+	c.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if compress {
+		_, err = c.compressWriter.Write(buffer)
+	} else {
+		_, err = c.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+func (c *CompressResponseWriter) WriteHeader(status int) {
+	if c.headersWritten {
+		return
+	}
+	c.status = status
 	c.prepareHeaders()
-	c.ResponseWriter.WriteHeader(status)
+	// The headers of compressable responses are held back until the body
+	// reaches the minimum size.
+	if c.compressionType == "" || c.minSize <= 0 {
+		c.writeHeaders(c.compressionType != "")
+	}
+}
+
+// Flush sends the buffered body, compressed if it can be, and flushes the
+// encoder and the parent writer.
+func (c *CompressResponseWriter) Flush() {
+	if !c.prepared {
+		c.prepareHeaders()
+	}
+	if !c.headersWritten {
+		c.writeHeaders(c.compressionType != "")
+	}
+	if c.compressionType != "" {
+		_ = c.compressWriter.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 func (c *CompressResponseWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	if !c.prepared {
+		c.prepareHeaders()
+	}
+	if !c.headersWritten {
+		// The whole body is smaller than the minimum size.
+		c.writeHeaders(false)
+	}
 	if c.compressionType != "" {
 		_ = c.compressWriter.Close()
+		putEncoder(c.compressionType, c.compressionLevel, c.compressWriter)
+		c.compressWriter = nil
 	}
 	if w, ok := c.ResponseWriter.(io.Closer); ok {
 		_ = w.Close()
@@ -140,9 +264,23 @@ func (c *CompressResponseWriter) Write(b []byte) (int, error) {
 	if c.closed {
 		return 0, io.ErrClosedPipe
 	}
-	if !c.headersWritten {
+	if !c.prepared {
 		c.prepareHeaders()
-		c.headersWritten = true
+	}
+	if !c.headersWritten {
+		if c.compressionType == "" || c.minSize <= 0 {
+			if err := c.writeHeaders(c.compressionType != ""); err != nil {
+				return 0, err
+			}
+		} else {
+			c.buffer = append(c.buffer, b...)
+			if len(c.buffer) >= c.minSize {
+				if err := c.writeHeaders(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(b), nil
+		}
 	}
 
 	if c.compressionType != "" {
@@ -155,76 +293,124 @@ func (c *CompressResponseWriter) Write(b []byte) (int, error) {
 // DetectCompressionType method detects the comperssion type
 // from header "Accept-Encoding"
 func (c *CompressResponseWriter) DetectCompressionType(req *Request, resp *Response) {
-	acceptedEncodings := strings.Split(req.Request.Header.Get("Accept-Encoding"), ",")
-	largestQ := 0.0
-	chosenEncoding := len(compressionTypes)
-
-	// I have fixed one edge case for issue #914
-	// But it's better to cover all possible edge cases or
-	// Adapt to https://github.com/golang/gddo/blob/master/httputil/header/header.go#L172
-	for _, encoding := range acceptedEncodings {
-		encoding = strings.TrimSpace(encoding)
-		encodingParts := strings.SplitN(encoding, ";", 2)
-
-		// If we are the format "gzip;q=0.8"
-		if len(encodingParts) > 1 {
-			q := strings.TrimSpace(encodingParts[1])
-			if len(q) == 0 || !strings.HasPrefix(q, "q=") {
-				continue
-			}
+	encodings := supportedEncodings(Config.GetStringSliceDefault("compress.encodings", compressionTypes))
+	c.compressionType = NegotiateEncoding(req.Request.Header.Get(AcceptEncodingHeader), encodings)
+	if c.compressionType != "" {
+		c.compressionLevel = Config.GetIntDefault("compress.level."+c.compressionType, defaultCompressionLevels[c.compressionType])
+	}
+}
 
-			// Strip off the q=
-			num, err := strconv.ParseFloat(q[2:], 32)
-			if err != nil {
-				continue
-			}
+// NegotiateEncoding returns the encoding of supported with the highest
+// quality value in an Accept-Encoding header, the first one of supported
+// among equals, or "" if none is acceptable.
+func NegotiateEncoding(header string, supported []string) string {
+	chosen, largestQ := "", 0.0
+	for _, encoding := range supported {
+		if q := encodingQuality(header, encoding); q > largestQ {
+			chosen, largestQ = encoding, q
+		}
+	}
+	return chosen
+}
 
-			if num >= largestQ && num > 0 {
-				if encodingParts[0] == "*" {
-					chosenEncoding = 0
-					largestQ = num
-					continue
-				}
-				for i, encoding := range compressionTypes {
-					if encoding == encodingParts[0] {
-						if i < chosenEncoding {
-							largestQ = num
-							chosenEncoding = i
-						}
-						break
-					}
+// encodingQuality returns the quality value given to encoding by an
+// Accept-Encoding header, or by its "*" entry if encoding is not listed.
+// An unacceptable encoding has a quality of 0.
+func encodingQuality(header string, encoding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				num, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					num = 0
 				}
+				q = num
 			}
-		} else {
-			// If we can accept anything, chose our preferred method.
-			if encodingParts[0] == "*" {
-				chosenEncoding = 0
-				largestQ = 1
+		}
+		if name == encoding {
+			return q
+		}
+		wildcard = q
+	}
+	return wildcard
+}
+
+func getEncoder(encoding string, level int, w io.Writer) WriteFlusher {
+	key := encoding + ":" + strconv.Itoa(level)
+	pool, _ := encoderPools.LoadOrStore(key, &sync.Pool{New: func() interface{} {
+		return newEncoder(encoding, level)
+	}})
+	encoder := pool.(*sync.Pool).Get().(resetWriteFlusher)
+	encoder.Reset(w)
+	return encoder
+}
+
+// unknownEncodings holds the encodings of "compress.encodings" without an
+// encoder which were logged.
+var unknownEncodings sync.Map
+
+// supportedEncodings returns the encodings among compressionTypes, the other
+// ones being logged once and left out of the negotiation, as their responses
+// would be labeled with them but not encoded.
+func supportedEncodings(encodings []string) []string {
+	supported := make([]string, 0, len(encodings))
+	for _, encoding := range encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		known := false
+		for _, name := range compressionTypes {
+			if encoding == name {
+				known = true
 				break
 			}
-			// This is for just plain "gzip"
-			for i, encoding := range compressionTypes {
-				if encoding == encodingParts[0] {
-					if i < chosenEncoding {
-						largestQ = 1.0
-						chosenEncoding = i
-					}
-					break
-				}
-			}
+		}
+		if known {
+			supported = append(supported, encoding)
+		} else if _, logged := unknownEncodings.LoadOrStore(encoding, true); !logged {
+			Logger.Warn("Unknown encoding in compress.encodings is ignored", zap.String("encoding", encoding), zap.Strings("supported", compressionTypes))
 		}
 	}
+	return supported
+}
 
-	if largestQ == 0 {
-		return
+func putEncoder(encoding string, level int, encoder WriteFlusher) {
+	if pool, ok := encoderPools.Load(encoding + ":" + strconv.Itoa(level)); ok {
+		pool.(*sync.Pool).Put(encoder)
 	}
+}
 
-	c.compressionType = compressionTypes[chosenEncoding]
-
-	switch c.compressionType {
-	case "gzip":
-		c.compressWriter = gzip.NewWriter(resp.Writer)
+// newEncoder creates an encoder, with the default level if level is invalid.
+func newEncoder(encoding string, level int) resetWriteFlusher {
+	switch encoding {
+	case "br":
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			level = defaultCompressionLevels[encoding]
+		}
+		return brotli.NewWriterLevel(nil, level)
+	case "zstd":
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		}
+		return encoder
 	case "deflate":
-		c.compressWriter = zlib.NewWriter(resp.Writer)
+		encoder, err := zlib.NewWriterLevel(nil, level)
+		if err != nil {
+			encoder = zlib.NewWriter(nil)
+		}
+		return encoder
+	default:
+		encoder, err := gzip.NewWriterLevel(nil, level)
+		if err != nil {
+			encoder = gzip.NewWriter(nil)
+		}
+		return encoder
 	}
 }
@@ -0,0 +1,113 @@
+package egret
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/kenorld/egret/conf"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func serveCompressed(acceptEncoding string, body string) *httptest.ResponseRecorder {
+	Config, _ = conf.LoadContext("app", nil)
+	initSerializer()
+	req, _ := http.NewRequest("GET", "/posts", nil)
+	req.Header.Set(AcceptEncodingHeader, acceptEncoding)
+	return serveHandlers(req, CompressHandler, func(c *Context) { c.RenderText(body) })
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "br", NegotiateEncoding("gzip, deflate, br", compressionTypes))
+	assert.Equal(t, "gzip", NegotiateEncoding("gzip;q=1.0, br;q=0.5", compressionTypes))
+	assert.Equal(t, "zstd", NegotiateEncoding("br;q=0, *", compressionTypes))
+	assert.Equal(t, "deflate", NegotiateEncoding("DEFLATE", compressionTypes))
+	assert.Equal(t, "", NegotiateEncoding("identity", compressionTypes))
+	assert.Equal(t, "", NegotiateEncoding("*;q=0", compressionTypes))
+	assert.Equal(t, "", NegotiateEncoding("", compressionTypes))
+}
+
+func TestCompressHandler(t *testing.T) {
+	body := strings.Repeat("egret ", 1000)
+
+	w := serveCompressed("br", body)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, AcceptEncodingHeader, w.Header().Get("Vary"))
+	content, _ := ioutil.ReadAll(brotli.NewReader(w.Body))
+	assert.Equal(t, body, string(content))
+
+	w = serveCompressed("zstd", body)
+	assert.Equal(t, "zstd", w.Header().Get("Content-Encoding"))
+	decoder, _ := zstd.NewReader(w.Body)
+	content, _ = ioutil.ReadAll(decoder)
+	assert.Equal(t, body, string(content))
+
+	w = serveCompressed("gzip", body)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	reader, _ := gzip.NewReader(w.Body)
+	content, _ = ioutil.ReadAll(reader)
+	assert.Equal(t, body, string(content))
+
+	w = serveCompressed("gzip, br", "small")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"), "bodies under compress.min_size are not compressed")
+	assert.Equal(t, "small", w.Body.String())
+}
+
+func TestCompressHandlerWithoutBody(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("compress:\n  min_size: 0\n"), 0666))
+	config := Config
+	defer func() { Config = config }()
+	Config, _ = conf.LoadContext("app", []string{dir})
+	initSerializer()
+
+	serve := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/posts", nil)
+		req.Header.Set(AcceptEncodingHeader, "gzip")
+		req.Header.Set(IfNoneMatchHeader, ifNoneMatch)
+		return serveHandlers(req, ETagHandler, CompressHandler, func(c *Context) { c.RenderText("hello") })
+	}
+
+	w := serve("GET", "")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"), "min_size 0 compresses any body")
+
+	w = serve("GET", NewETag([]byte("hello"), false))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"), "a 304 has no body to encode")
+	assert.Equal(t, 0, w.Body.Len())
+
+	w = serve("HEAD", "")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"), "a HEAD response has no body to encode")
+}
+
+func TestCompressHandlerUnknownEncodings(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("compress:\n  min_size: 0\n  encodings: [lz4, gzip]\n"), 0666))
+	config := Config
+	defer func() { Config = config }()
+	Config, _ = conf.LoadContext("app", []string{dir})
+	Logger = zap.NewNop()
+	initSerializer()
+
+	serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/posts", nil)
+		req.Header.Set(AcceptEncodingHeader, acceptEncoding)
+		return serveHandlers(req, CompressHandler, func(c *Context) { c.RenderText("hello") })
+	}
+
+	w := serve("lz4")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"), "an encoding without an encoder is not negotiated")
+	assert.Equal(t, "hello", w.Body.String())
+
+	w = serve("lz4, gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"gzip"}, supportedEncodings([]string{"lz4", " GZIP "}))
+}
@@ -0,0 +1,446 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	strcase "github.com/stoewer/go-strcase"
+)
+
+// KeyError describes an invalid configuration key.
+type KeyError struct {
+	Key     string
+	Message string
+}
+
+func (e *KeyError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// KeyErrors lists the invalid keys of a configuration.
+type KeyErrors []*KeyError
+
+func (e KeyErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[string]reflect.Type{}
+
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Register declares the keys of a configuration section, "" being the root,
+// with a struct as accepted by Bind. Validate checks the configuration
+// against the registered sections. It is meant to be called by the init
+// functions of the packages reading the configuration:
+//
+//      func init() {
+//          conf.Register("cache", CacheConfig{})
+//      }
+func Register(section string, schema interface{}) {
+	t := reflect.TypeOf(schema)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic("conf: the schema of section " + section + " is not a struct")
+	}
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[section] = t
+}
+
+// Bind decodes the keys of a section into the struct target points to, and
+// validates them. The key of a field is its `conf` tag, or its name in
+// snake case; `conf:"-"` skips it. Keys are looked up like with Get, so the
+// mode section and the environment overrides apply. Fields can have
+//   - a `default` tag, holding the value used when the key is not set,
+//     otherwise the field is left untouched,
+//   - a `validate` tag, a comma separated list of rules among "required",
+//     "min=N", "max=N" (values for numbers, lengths for strings and slices)
+//     and "oneof=a b c".
+//
+// For example:
+//
+//      type ServeConfig struct {
+//          Network string `default:"tcp" validate:"oneof=tcp unix"`
+//          Port    int    `default:"9000" validate:"min=1,max=65535"`
+//          Timeout time.Duration `conf:"timeout" default:"30s"`
+//      }
+//      cfg := ServeConfig{}
+//      err := Config.Bind("serve", &cfg)
+//
+// The returned error, if any, is a KeyErrors.
+func (c *Context) Bind(section string, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return KeyErrors{{Key: section, Message: "can't bind to a non struct pointer"}}
+	}
+	errs := c.bindStruct(section, v.Elem(), KeyErrors{})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Context) bindStruct(section string, v reflect.Value, errs KeyErrors) KeyErrors {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldKey(field)
+		if name == "" {
+			continue
+		}
+		key := joinKey(section, name)
+		fv := v.Field(i)
+		if isSection(field.Type) {
+			if field.Type.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			errs = c.bindStruct(key, fv, errs)
+			continue
+		}
+
+		raw, ok := c.lookup(key)
+		if !ok {
+			if def, hasDefault := field.Tag.Lookup("default"); hasDefault {
+				raw, ok = def, true
+			}
+		}
+		if ok {
+			if err := setField(fv, raw); err != nil {
+				errs = append(errs, &KeyError{Key: key, Message: err.Error()})
+				continue
+			}
+		}
+		if msg := validateField(fv, ok, field.Tag.Get("validate")); msg != "" {
+			errs = append(errs, &KeyError{Key: key, Message: msg})
+		}
+	}
+	return errs
+}
+
+// Validate checks the configuration against the sections declared with
+// Register: the values must have the expected types and pass the validation
+// rules, and the keys of registered sections must be declared. Keys of
+// unregistered sections are accepted, unless "config.strict" is set.
+func (c *Context) Validate() error {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	errs := KeyErrors{}
+	known, sections, open := map[string]bool{}, map[string]bool{}, []string{}
+	for section, t := range schemas {
+		errs = c.bindStruct(section, reflect.New(t).Elem(), errs)
+		sections[section] = true
+		open = schemaKeys(section, t, known, sections, open)
+	}
+
+	strict := c.GetBoolDefault("config.strict", false)
+	unknown := map[string]bool{}
+	for _, v := range c.loaded() {
+		for _, key := range v.AllKeys() {
+			if strings.HasPrefix(key, "[") {
+				// Drop the mode section
+				if i := strings.Index(key, "]."); i != -1 {
+					key = key[i+2:]
+				}
+			}
+			if known[key] || hasPrefix(key, open) {
+				continue
+			}
+			if strict || inSection(key, sections) {
+				unknown[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(unknown))
+	for key := range unknown {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		errs = append(errs, &KeyError{Key: key, Message: "unknown key"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// registeredKeys returns the keys of the values declared by the registered
+// sections, without the sections themselves.
+func registeredKeys() []string {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	known, sections := map[string]bool{}, map[string]bool{}
+	for section, t := range schemas {
+		schemaKeys(section, t, known, sections, nil)
+	}
+	keys := []string{}
+	for key := range known {
+		if !sections[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// schemaKeys adds the keys declared by t to known, its sub sections to
+// sections, and returns open with the prefixes of the map fields, whose keys
+// are free.
+func schemaKeys(section string, t reflect.Type, known map[string]bool, sections map[string]bool, open []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldKey(field)
+		if name == "" {
+			continue
+		}
+		key := joinKey(section, name)
+		known[key] = true
+		switch {
+		case isSection(field.Type):
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			sections[key] = true
+			open = schemaKeys(key, ft, known, sections, open)
+		case field.Type.Kind() == reflect.Map || field.Type.Kind() == reflect.Interface:
+			open = append(open, key+".")
+		}
+	}
+	return open
+}
+
+// inSection reports whether key belongs to one of sections, the root
+// section excepted.
+func inSection(key string, sections map[string]bool) bool {
+	for i := strings.LastIndex(key, "."); i != -1; i = strings.LastIndex(key, ".") {
+		key = key[:i]
+		if sections[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldKey(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := field.Tag.Get("conf")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = strcase.SnakeCase(field.Name)
+	}
+	return name
+}
+
+func joinKey(section string, name string) string {
+	if section == "" {
+		return name
+	}
+	return section + "." + name
+}
+
+func isSection(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+func setField(fv reflect.Value, raw interface{}) error {
+	switch fv.Type() {
+	case durationType:
+		d, err := cast.ToDurationE(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case timeType:
+		tm, err := cast.ToTimeE(raw)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		s, err := cast.ToStringE(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := cast.ToBoolE(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := cast.ToInt64E(raw)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := cast.ToUint64E(raw)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := cast.ToFloat64E(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		if s, ok := raw.(string); ok {
+			items = toStringSlice(s)
+		} else {
+			values, err := cast.ToSliceE(raw)
+			if err != nil {
+				if items, err = cast.ToStringSliceE(raw); err != nil {
+					return err
+				}
+			} else {
+				for _, value := range values {
+					items = append(items, cast.ToString(value))
+				}
+			}
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setField(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+	case reflect.Map:
+		if fv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", fv.Type())
+		}
+		values, err := cast.ToStringMapE(raw)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(fv.Type(), len(values))
+		for key, value := range values {
+			item := reflect.New(fv.Type().Elem()).Elem()
+			if err := setField(item, value); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(key), item)
+		}
+		fv.Set(m)
+	case reflect.Interface:
+		fv.Set(reflect.ValueOf(raw))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// validateField applies the validation rules to a field and returns the
+// message describing the first broken one.
+func validateField(fv reflect.Value, set bool, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i != -1 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		// The other rules apply to the values which are set.
+		if !set && name != "required" {
+			continue
+		}
+		switch name {
+		case "required":
+			if !set {
+				return "required key is not set"
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return "invalid rule " + rule
+			}
+			size, what := fieldSize(fv)
+			if (name == "min" && size < limit) || (name == "max" && size > limit) {
+				return fmt.Sprintf("%s %v breaks the rule %s", what, size, rule)
+			}
+		case "oneof":
+			value := fmt.Sprint(fv.Interface())
+			found := false
+			for _, option := range strings.Fields(arg) {
+				if option == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Sprintf("%q is not one of %s", value, arg)
+			}
+		default:
+			return "unknown validation rule " + name
+		}
+	}
+	return ""
+}
+
+func fieldSize(fv reflect.Value) (float64, string) {
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(fv.Len()), "length"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), "value"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), "value"
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), "value"
+	}
+	return 0, "value"
+}
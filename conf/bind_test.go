@@ -0,0 +1,102 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testDBConfig struct {
+	Driver   string `default:"postgres" validate:"oneof=postgres mysql"`
+	URL      string `conf:"url" validate:"required"`
+	PoolSize int    `validate:"min=1,max=100"`
+	Timeout  time.Duration
+	Replicas []string
+	Options  map[string]string
+	TLS      struct {
+		Enabled bool
+	} `conf:"tls"`
+}
+
+func loadBindContext(t *testing.T, content string) *Context {
+	dir, err := ioutil.TempDir("", "egret-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(content), 0666)
+	ctx, err := LoadContext("app", []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetSection("dev")
+	return ctx
+}
+
+func TestBind(t *testing.T) {
+	ctx := loadBindContext(t, `
+db:
+  url: postgres://localhost/test
+  pool_size: 5
+  timeout: 3s
+  replicas: ["a", "b"]
+  options: {sslmode: disable}
+  tls:
+    enabled: true
+"[dev]":
+  db:
+    pool_size: 2
+`)
+	cfg := testDBConfig{}
+	if err := ctx.Bind("db", &cfg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if cfg.Driver != "postgres" || cfg.URL != "postgres://localhost/test" || cfg.PoolSize != 2 ||
+		cfg.Timeout != 3*time.Second || len(cfg.Replicas) != 2 || cfg.Options["sslmode"] != "disable" || !cfg.TLS.Enabled {
+		t.Errorf("Unexpected binding %+v", cfg)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	ctx := loadBindContext(t, `
+db:
+  driver: sqlite
+  pool_size: many
+`)
+	err := ctx.Bind("db", &testDBConfig{})
+	errs, ok := err.(KeyErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", err)
+	}
+	for i, key := range []string{"db.driver", "db.url", "db.pool_size"} {
+		if errs[i].Key != key {
+			t.Errorf("Expected an error for %s, got %s", key, errs[i])
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer func() {
+		schemasMu.Lock()
+		delete(schemas, "db")
+		schemasMu.Unlock()
+	}()
+	Register("db", testDBConfig{})
+	ctx := loadBindContext(t, `
+db:
+  url: postgres://localhost/test
+  pool_sise: 5
+  options: {anything: goes}
+  tls:
+    enabld: true
+mail:
+  host: localhost
+`)
+	err := ctx.Validate()
+	errs, ok := err.(KeyErrors)
+	if !ok || len(errs) != 2 || errs[0].Key != "db.pool_sise" || errs[1].Key != "db.tls.enabld" {
+		t.Errorf("Expected the unknown keys of db, got %v", err)
+	}
+}
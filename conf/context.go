@@ -4,66 +4,197 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
+// Extensions lists the supported configuration formats, by order of precedence.
+var Extensions = []string{".yaml", ".yml", ".toml", ".json"}
+
+// IncludeKey is the key listing the files a configuration file includes,
+// relative to its directory. An included file has a lower precedence than
+// the file including it.
+const IncludeKey = "include"
+
 // Context structure handles the parsing of app.yaml
 // It has a "preferred" section that is checked first for option queries.
 // If the preferred section does not have the option, the DEFAULT section is
 // checked fallback.
+// Every key can be overridden by an environment variable (see SetEnvPrefix),
+// and values can reference environment variables as ${NAME:default}.
 type Context struct {
-	vipers  []*viper.Viper
-	section string
+	// vipers holds the []*viper.Viper of the loaded files, swapped by Reload.
+	vipers atomic.Value
+	// secrets holds the *sync.Map of the content of the secret files by path,
+	// read along with the files.
+	secrets   atomic.Value
+	name      string
+	paths     []string
+	mode      string
+	section   string
+	envPrefix string
 }
 
+// LoadContext loads the configuration files named confName in confPaths,
+// earlier paths taking precedence, in any of the supported Extensions,
+// e.g. app.yaml or app.toml. The secret files they name are read as well.
 func LoadContext(confName string, confPaths []string) (*Context, error) {
-	ctx := &Context{vipers: []*viper.Viper{}}
-	for _, confPath := range confPaths {
-		path := filepath.Join(confPath, confName+".yaml")
+	ctx := &Context{name: confName, paths: confPaths}
+	vipers, secrets, err := ctx.load()
+	if err != nil {
+		return nil, err
+	}
+	ctx.store(vipers, secrets)
+	return ctx, nil
+}
+
+// load reads the configuration files found in the configuration paths, the
+// files they include, and the secret files they and the environment name.
+func (c *Context) load() ([]*viper.Viper, *sync.Map, error) {
+	vipers, err := c.loadFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets, err := c.readSecrets(vipers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vipers, secrets, nil
+}
+
+// store replaces the loaded files and secrets.
+func (c *Context) store(vipers []*viper.Viper, secrets *sync.Map) {
+	c.vipers.Store(vipers)
+	c.secrets.Store(secrets)
+}
+
+// loadFiles reads the configuration files found in the configuration paths,
+// and the files they include.
+func (c *Context) loadFiles() ([]*viper.Viper, error) {
+	vipers := []*viper.Viper{}
+	seen := map[string]bool{}
+	for _, path := range c.candidates() {
 		if _, err := os.Stat(path); err == nil {
-			v := viper.New()
-			v.SetConfigType("yaml")
-			v.SetConfigName(confName)
-			v.AddConfigPath(confPath)
-			err := v.ReadInConfig() // Find and read the config file
-			if err != nil {         // Handle errors reading the config file
-				panic(fmt.Errorf("Fatal error config file: %s \n", err))
+			if vipers, err = loadFile(path, vipers, seen); err != nil {
+				return nil, err
 			}
-			ctx.vipers = append(ctx.vipers, v)
 		}
 	}
-
-	return ctx, nil
+	return vipers, nil
 }
 
-func (c *Context) SetSection(section string) {
-	c.section = "[" + section + "]"
+func loadFile(path string, vipers []*viper.Viper, seen map[string]bool) ([]*viper.Viper, error) {
+	path = filepath.Clean(path)
+	if seen[path] {
+		return vipers, nil
+	}
+	seen[path] = true
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil { // Find and read the config file
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	vipers = append(vipers, v)
+	for _, include := range toStringSlice(ExpandEnv(v.Get(IncludeKey))) {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		var err error
+		if vipers, err = loadFile(include, vipers, seen); err != nil {
+			return nil, err
+		}
+	}
+	return vipers, nil
 }
 
-func (c *Context) Get(key string) interface{} {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.Get(c.section + "." + key)
+// candidates returns the paths of the configuration files which are read
+// if they exist, by order of precedence: in each configuration path, the
+// overlay of the mode, e.g. app.prod.yaml, then the base file.
+func (c *Context) candidates() []string {
+	paths := []string{}
+	for _, confPath := range c.paths {
+		if c.mode != "" {
+			for _, ext := range Extensions {
+				paths = append(paths, filepath.Join(confPath, c.name+"."+c.mode+ext))
+			}
 		}
-		if v.IsSet(key) {
-			return v.Get(key)
+		for _, ext := range Extensions {
+			paths = append(paths, filepath.Join(confPath, c.name+ext))
 		}
 	}
+	return paths
+}
+
+// loaded returns the vipers of the loaded configuration files.
+func (c *Context) loaded() []*viper.Viper {
+	vipers, _ := c.vipers.Load().([]*viper.Viper)
+	return vipers
+}
+
+// Files returns the paths of the loaded configuration files.
+func (c *Context) Files() []string {
+	files := []string{}
+	for _, v := range c.loaded() {
+		files = append(files, v.ConfigFileUsed())
+	}
+	return files
+}
+
+// Watches reports whether a change of the file at fpath, created or not,
+// affects the configuration.
+func (c *Context) Watches(fpath string) bool {
+	fpath = filepath.Clean(fpath)
+	for _, candidate := range append(c.candidates(), c.Files()...) {
+		if filepath.Clean(candidate) == fpath {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload reads the configuration files again and, if they are valid (see
+// Validate), atomically replaces the configuration with them. On error, the
+// current configuration is kept.
+func (c *Context) Reload() error {
+	vipers, secrets, err := c.load()
+	if err != nil {
+		return err
+	}
+	fresh := &Context{name: c.name, paths: c.paths, mode: c.mode, section: c.section, envPrefix: c.envPrefix}
+	fresh.store(vipers, secrets)
+	if err := fresh.Validate(); err != nil {
+		return err
+	}
+	c.store(vipers, secrets)
 	return nil
 }
+
+// SetSection selects the mode: its "[mode]" section is checked first, and
+// its overlay files, e.g. app.prod.yaml, are loaded over the base files.
+func (c *Context) SetSection(section string) {
+	c.section = "[" + section + "]"
+	c.mode = section
+	vipers, secrets, err := c.load()
+	if err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	c.store(vipers, secrets)
+}
+
+func (c *Context) Get(key string) interface{} {
+	v, _ := c.lookup(key)
+	return v
+}
 func (c *Context) GetBool(key string) bool {
 	return c.GetBoolDefault(key, false)
 }
 func (c *Context) GetBoolDefault(key string, value bool) bool {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetBool(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetBool(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToBool(v)
 	}
 	return value
 }
@@ -71,13 +202,8 @@ func (c *Context) GetFloat64(key string) float64 {
 	return c.GetFloat64Default(key, 0)
 }
 func (c *Context) GetFloat64Default(key string, value float64) float64 {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetFloat64(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetFloat64(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToFloat64(v)
 	}
 	return value
 }
@@ -85,13 +211,8 @@ func (c *Context) GetInt(key string) int {
 	return c.GetIntDefault(key, 0)
 }
 func (c *Context) GetIntDefault(key string, value int) int {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetInt(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetInt(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToInt(v)
 	}
 	return value
 }
@@ -99,13 +220,8 @@ func (c *Context) GetString(key string) string {
 	return c.GetStringDefault(key, "")
 }
 func (c *Context) GetStringDefault(key string, value string) string {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetString(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetString(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToString(v)
 	}
 	return value
 }
@@ -113,13 +229,8 @@ func (c *Context) GetStringMap(key string) map[string]interface{} {
 	return c.GetStringMapDefault(key, map[string]interface{}{})
 }
 func (c *Context) GetStringMapDefault(key string, value map[string]interface{}) map[string]interface{} {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetStringMap(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetStringMap(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToStringMap(v)
 	}
 	return value
 }
@@ -127,13 +238,8 @@ func (c *Context) GetStringMapString(key string) map[string]string {
 	return c.GetStringMapStringDefault(key, map[string]string{})
 }
 func (c *Context) GetStringMapStringDefault(key string, value map[string]string) map[string]string {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetStringMapString(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetStringMapString(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToStringMapString(v)
 	}
 	return value
 }
@@ -141,13 +247,8 @@ func (c *Context) GetStringSlice(key string) []string {
 	return c.GetStringSliceDefault(key, []string{})
 }
 func (c *Context) GetStringSliceDefault(key string, value []string) []string {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetStringSlice(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetStringSlice(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return toStringSlice(v)
 	}
 	return value
 }
@@ -155,13 +256,8 @@ func (c *Context) GetTime(key string) time.Time {
 	return c.GetTimeDefault(key, time.Now())
 }
 func (c *Context) GetTimeDefault(key string, value time.Time) time.Time {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetTime(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetTime(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToTime(v)
 	}
 	return value
 }
@@ -169,24 +265,12 @@ func (c *Context) GetDuration(key string) time.Duration {
 	return c.GetDurationDefault(key, time.Duration(0))
 }
 func (c *Context) GetDurationDefault(key string, value time.Duration) time.Duration {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return v.GetDuration(c.section + "." + key)
-		}
-		if v.IsSet(key) {
-			return v.GetDuration(key)
-		}
+	if v, ok := c.lookup(key); ok {
+		return cast.ToDuration(v)
 	}
 	return value
 }
 func (c *Context) IsSet(key string) bool {
-	for _, v := range c.vipers {
-		if v.IsSet(c.section + "." + key) {
-			return true
-		}
-		if v.IsSet(key) {
-			return true
-		}
-	}
-	return false
+	_, ok := c.lookup(key)
+	return ok
 }
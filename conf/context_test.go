@@ -0,0 +1,199 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+name: ${TEST_APP_NAME:sample}
+secret: secret_file:${TEST_SECRET_DIR}/secret
+log_file: /var/log/egret.log
+serve:
+  port: 9000
+  hosts: ["${TEST_HOST:localhost}", "example.com"]
+"[prod]":
+  serve:
+    port: 80
+`
+
+func loadTestContext(t *testing.T) (*Context, string) {
+	dir, err := ioutil.TempDir("", "egret-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(testConfig), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("s3cr3t\n"), 0600)
+	os.Setenv("TEST_SECRET_DIR", dir)
+	ctx, err := LoadContext("app", []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetSection("prod")
+	ctx.SetEnvPrefix("EGRETTEST")
+	return ctx, dir
+}
+
+func TestContextInterpolation(t *testing.T) {
+	ctx, dir := loadTestContext(t)
+	defer os.RemoveAll(dir)
+
+	if name := ctx.GetString("name"); name != "sample" {
+		t.Errorf("Expected the default value, got %q", name)
+	}
+	os.Setenv("TEST_APP_NAME", "chat")
+	defer os.Unsetenv("TEST_APP_NAME")
+	if name := ctx.GetString("name"); name != "chat" {
+		t.Errorf("Expected the environment value, got %q", name)
+	}
+	if hosts := ctx.GetStringSlice("serve.hosts"); len(hosts) != 2 || hosts[0] != "localhost" {
+		t.Errorf("Expected interpolated slice items, got %v", hosts)
+	}
+	if secret := ctx.GetString("secret"); secret != "s3cr3t" {
+		t.Errorf("Expected the secret file content, got %q", secret)
+	}
+}
+
+func TestContextEnvOverrides(t *testing.T) {
+	ctx, dir := loadTestContext(t)
+	defer os.RemoveAll(dir)
+
+	if port := ctx.GetInt("serve.port"); port != 80 {
+		t.Errorf("Expected the mode section value, got %d", port)
+	}
+	os.Setenv("EGRETTEST_SERVE_PORT", "8080")
+	defer os.Unsetenv("EGRETTEST_SERVE_PORT")
+	if port := ctx.GetInt("serve.port"); port != 8080 {
+		t.Errorf("Expected the environment override, got %d", port)
+	}
+
+	os.Setenv("EGRETTEST_SERVE_HOSTS", "a.com, b.com")
+	defer os.Unsetenv("EGRETTEST_SERVE_HOSTS")
+	if hosts := ctx.GetStringSlice("serve.hosts"); len(hosts) != 2 || hosts[1] != "b.com" {
+		t.Errorf("Expected a comma separated list, got %v", hosts)
+	}
+
+	os.Setenv("EGRETTEST_DB_PASSWORD", SecretFilePrefix+filepath.Join(dir, "secret"))
+	defer os.Unsetenv("EGRETTEST_DB_PASSWORD")
+	if password := ctx.GetString("db.password"); password != "s3cr3t" {
+		t.Errorf("Expected the secret file content, got %q", password)
+	}
+	if !ctx.IsSet("db.password") {
+		t.Errorf("Expected db.password to be set by the environment")
+	}
+}
+
+func TestContextLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egret-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"app.yaml":       "include: [shared/db.toml]\nname: sample\nserve:\n  port: 9000\n",
+		"app.prod.json":  `{"serve": {"port": 80}}`,
+		"shared/db.toml": "name = \"shared\"\n[db]\nurl = \"postgres://localhost\"\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0777)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666)
+	}
+	ctx, _ := LoadContext("app", []string{dir})
+	ctx.SetSection("prod")
+
+	if port := ctx.GetInt("serve.port"); port != 80 {
+		t.Errorf("Expected the overlay value, got %d", port)
+	}
+	if name := ctx.GetString("name"); name != "sample" {
+		t.Errorf("Expected the including file to take precedence, got %q", name)
+	}
+	if url := ctx.GetString("db.url"); url != "postgres://localhost" {
+		t.Errorf("Expected the included value, got %q", url)
+	}
+	if source := ctx.Source("db.url"); source != filepath.Join(dir, "shared", "db.toml") {
+		t.Errorf("Unexpected source %q", source)
+	}
+	if source := ctx.Source("serve.port"); source != filepath.Join(dir, "app.prod.json") {
+		t.Errorf("Unexpected source %q", source)
+	}
+	keys := ctx.AllKeys()
+	if len(keys) != 3 || keys[0] != "db.url" || keys[1] != "name" || keys[2] != "serve.port" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if !ctx.Watches(filepath.Join(dir, "app.prod.yaml")) || !ctx.Watches(filepath.Join(dir, "shared", "db.toml")) {
+		t.Errorf("Expected the overlays and included files to be watched")
+	}
+}
+
+func TestContextSecretFiles(t *testing.T) {
+	ctx, dir := loadTestContext(t)
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	ioutil.WriteFile(secret, []byte("changed\n"), 0600)
+	if value := ctx.GetString("secret"); value != "s3cr3t" {
+		t.Errorf("Expected the secret read by the load, got %q", value)
+	}
+	if err := ctx.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if value := ctx.GetString("secret"); value != "changed" {
+		t.Errorf("Expected the secret read by the reload, got %q", value)
+	}
+
+	os.Remove(secret)
+	if err := ctx.Reload(); err == nil {
+		t.Errorf("Expected a missing secret file to be rejected")
+	}
+	if value := ctx.GetString("secret"); value != "changed" {
+		t.Errorf("Expected the running secret to be kept, got %q", value)
+	}
+	if _, err := LoadContext("app", []string{dir}); err == nil {
+		t.Errorf("Expected a missing secret file to fail the load")
+	}
+
+	os.Setenv("EGRETTEST_DB_PASSWORD", SecretFilePrefix+filepath.Join(dir, "missing"))
+	defer os.Unsetenv("EGRETTEST_DB_PASSWORD")
+	if ctx.IsSet("db.password") {
+		t.Errorf("Expected an unreadable secret file to leave its key unset")
+	}
+
+	os.Unsetenv("EGRETTEST_DB_PASSWORD")
+
+	// only the marked values name secret files
+	if value := ctx.GetString("log_file"); value != "/var/log/egret.log" {
+		t.Errorf("Expected a key ending in _file to be a plain value, got %q", value)
+	}
+	os.Setenv("EGRETTEST_PID_FILE", filepath.Join(dir, "missing.pid"))
+	defer os.Unsetenv("EGRETTEST_PID_FILE")
+	ioutil.WriteFile(secret, []byte("s3cr3t\n"), 0600)
+	if err := ctx.Reload(); err != nil {
+		t.Errorf("Expected the unmarked paths not to be read, got %s", err)
+	}
+	if value := ctx.GetString("pid_file"); value != filepath.Join(dir, "missing.pid") {
+		t.Errorf("Expected the environment value, got %q", value)
+	}
+}
+
+func TestContextEnvKeys(t *testing.T) {
+	ctx, dir := loadTestContext(t)
+	defer os.RemoveAll(dir)
+
+	Register("serve", struct{ ReadTimeout int }{})
+	defer delete(schemas, "serve")
+	for name, value := range map[string]string{
+		"EGRETTEST_SERVE_PORT":         "8080",
+		"EGRETTEST_SERVE_READ_TIMEOUT": "5",
+		"EGRETTEST_DB_PASSWORD":        SecretFilePrefix + filepath.Join(dir, "secret"),
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	keys := strings.Join(ctx.AllKeys(), " ")
+	if keys != "db.password log_file name secret serve.hosts serve.port serve.read_timeout" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+}
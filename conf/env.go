@@ -0,0 +1,285 @@
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultEnvPrefix is the prefix of the environment variables overriding
+	// the keys of the app.yaml configuration, e.g. EGRET_SERVE_PORT.
+	DefaultEnvPrefix = "EGRET"
+	// SecretFilePrefix marks the values read from a file, e.g.
+	// `secret: secret_file:/run/secrets/egret`, or
+	// EGRET_SECRET=secret_file:/run/secrets/egret.
+	SecretFilePrefix = "secret_file:"
+)
+
+// envPattern matches the ${NAME} and ${NAME:default} references to
+// environment variables in configuration values.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// SetEnvPrefix enables the overriding of every key by an environment
+// variable, named after the key with the given prefix: "serve.port" is
+// overridden by PREFIX_SERVE_PORT. An empty prefix disables the overrides.
+// The secret files of the environment are read by the next load, e.g. by
+// SetSection or Reload.
+func (c *Context) SetEnvPrefix(prefix string) {
+	c.envPrefix = prefix
+}
+
+// EnvName returns the name of the environment variable overriding key.
+func (c *Context) EnvName(key string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(key)
+	return strings.ToUpper(c.envPrefix + "_" + name)
+}
+
+// lookup finds the value of key. Environment variables come first, then
+// each configuration file, with its mode section before its root. The values
+// prefixed by SecretFilePrefix are read from the file they name.
+func (c *Context) lookup(key string) (interface{}, bool) {
+	value, _, ok := c.find(key)
+	return value, ok
+}
+
+// Source returns where the value of key comes from: an environment variable,
+// as "$NAME", or a configuration file, suffixed by the mode section if it
+// sets the key. It returns "" if key is not set.
+func (c *Context) Source(key string) string {
+	_, source, _ := c.find(key)
+	return source
+}
+
+func (c *Context) find(key string) (interface{}, string, bool) {
+	if c.envPrefix != "" {
+		name := c.EnvName(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if value, ok := c.resolve(value); ok {
+				return value, "$" + name, true
+			}
+		}
+	}
+	for _, v := range c.loaded() {
+		for _, k := range []string{c.section + "." + key, key} {
+			source := v.ConfigFileUsed()
+			if k != key {
+				source += " " + c.section
+			}
+			if v.IsSet(k) {
+				if value, ok := c.resolve(ExpandEnv(v.Get(k))); ok {
+					return value, source, true
+				}
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// resolve returns value, or the content of the secret file it names.
+func (c *Context) resolve(value interface{}) (interface{}, bool) {
+	fpath, ok := secretFilePath(value)
+	if !ok {
+		return value, true
+	}
+	return c.secret(fpath)
+}
+
+// secretFilePath returns the path of the secret file named by value, if it
+// is prefixed by SecretFilePrefix.
+func secretFilePath(value interface{}) (string, bool) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, SecretFilePrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(s[len(SecretFilePrefix):]), true
+}
+
+// AllKeys returns the sorted keys set by the configuration files for the
+// current mode, and by the environment variables. The variables are mapped to the keys of the files
+// and the registered sections, the others to keys split at the underscores,
+// e.g. PREFIX_DB_PASSWORD to "db.password".
+func (c *Context) AllKeys() []string {
+	set := map[string]bool{}
+	for _, v := range c.loaded() {
+		for _, key := range v.AllKeys() {
+			if strings.HasPrefix(key, "[") {
+				if !strings.HasPrefix(key, c.section+".") {
+					continue
+				}
+				key = key[len(c.section)+1:]
+			}
+			if key == IncludeKey {
+				continue
+			}
+			set[key] = true
+		}
+	}
+	if c.envPrefix != "" {
+		keys := map[string]string{}
+		for _, key := range registeredKeys() {
+			keys[c.EnvName(key)] = key
+		}
+		for key := range set {
+			keys[c.EnvName(key)] = key
+		}
+		for _, env := range os.Environ() {
+			name := env[:strings.IndexByte(env, '=')]
+			if !strings.HasPrefix(name, c.envPrefix+"_") {
+				continue
+			}
+			if key, ok := keys[name]; ok {
+				set[key] = true
+			} else if name = name[len(c.envPrefix)+1:]; name != "" {
+				set[strings.ToLower(strings.Replace(name, "_", ".", -1))] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExpandEnv replaces the ${NAME} and ${NAME:default} references to
+// environment variables in the strings of value, recursively for maps and
+// slices. An unset variable without default is replaced by "".
+func ExpandEnv(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "${") {
+			return v
+		}
+		return envPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			match := envPattern.FindStringSubmatch(ref)
+			if env, ok := os.LookupEnv(match[1]); ok {
+				return env
+			}
+			return match[2]
+		})
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded[i] = ExpandEnv(item)
+		}
+		return expanded
+	case []string:
+		expanded := make([]string, len(v))
+		for i, item := range v {
+			expanded[i] = ExpandEnv(item).(string)
+		}
+		return expanded
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			expanded[k] = ExpandEnv(item)
+		}
+		return expanded
+	case map[interface{}]interface{}:
+		expanded := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			expanded[k] = ExpandEnv(item)
+		}
+		return expanded
+	}
+	return value
+}
+
+// secret returns the content of the secret file at fpath, as read by the
+// last load. The files named by environment variables set since then are
+// read once, the unreadable ones leaving their key unset.
+func (c *Context) secret(fpath string) (string, bool) {
+	secrets, _ := c.secrets.Load().(*sync.Map)
+	if secrets == nil {
+		return "", false
+	}
+	if secret, ok := secrets.Load(fpath); ok {
+		return secret.(string), true
+	}
+	secret, err := readSecretFile(fpath)
+	if err != nil {
+		return "", false
+	}
+	secrets.Store(fpath, secret)
+	return secret, true
+}
+
+// readSecrets reads the secret files named by the values of the
+// configuration files, and of the environment variables, prefixed by
+// SecretFilePrefix. Like a broken configuration file, a missing secret fails
+// the load.
+func (c *Context) readSecrets(vipers []*viper.Viper) (*sync.Map, error) {
+	secrets := &sync.Map{}
+	read := func(name, fpath string) error {
+		secret, err := readSecretFile(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		secrets.Store(fpath, secret)
+		return nil
+	}
+	for _, v := range vipers {
+		for _, key := range v.AllKeys() {
+			// the secrets of the other modes may not exist here
+			if strings.HasPrefix(key, "[") && !strings.HasPrefix(key, c.section+".") {
+				continue
+			}
+			fpath, ok := secretFilePath(ExpandEnv(v.Get(key)))
+			if !ok {
+				continue
+			}
+			if err := read(v.ConfigFileUsed()+": "+key, fpath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.envPrefix != "" {
+		for _, env := range os.Environ() {
+			parts := strings.SplitN(env, "=", 2)
+			if !strings.HasPrefix(parts[0], c.envPrefix+"_") {
+				continue
+			}
+			if fpath, ok := secretFilePath(parts[1]); ok {
+				if err := read("$"+parts[0], fpath); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// readSecretFile returns the content of a secret file, without the trailing
+// newline.
+func readSecretFile(fpath string) (string, error) {
+	content, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// toStringSlice is cast.ToStringSlice, except that strings, as set by
+// environment variables, are comma separated lists.
+func toStringSlice(value interface{}) []string {
+	if s, ok := value.(string); ok {
+		if strings.TrimSpace(s) == "" {
+			return []string{}
+		}
+		items := strings.Split(s, ",")
+		for i, item := range items {
+			items[i] = strings.TrimSpace(item)
+		}
+		return items
+	}
+	return cast.ToStringSlice(value)
+}
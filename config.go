@@ -0,0 +1,293 @@
+package egret
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+)
+
+var (
+	configMu            sync.Mutex
+	configSubscriptions []configSubscription
+	configWatchOnce     sync.Once
+
+	// logLevel is the level of Logger, changed when "logger.level" is.
+	logLevel = zap.NewAtomicLevel()
+)
+
+type configSubscription struct {
+	key string
+	fn  func(old, new interface{})
+}
+
+// coreConfig declares the keys of app.yaml read by Egret and its command
+// line tools, so Init can reject misspelled keys and values of the wrong type.
+// Modules declare their own sections with RegisterConfig.
+type coreConfig struct {
+	Name         string            `conf:"name"`
+	Secret       string            `conf:"secret"`
+	Root         string            `conf:"root"`
+	DevMode      bool              `conf:"dev_mode"`
+	UnixFileMode int               `conf:"unix_file_mode"`
+	Module       map[string]string `conf:"module"`
+	Include      []string          `conf:"include"`
+	Logger       map[string]interface{}
+
+	Config struct {
+		Strict bool
+		Watch  bool
+	}
+	App struct {
+		Behind struct {
+			Proxy bool
+		}
+	}
+	Serve struct {
+		Network string `validate:"oneof=tcp unix"`
+		Addr    string
+		Port    int `validate:"min=0,max=65535"`
+		TLS     struct {
+			Enabled bool
+			Cert    string
+			Key     string
+		} `conf:"tls"`
+		Letsencrypt struct {
+			Enabled  bool
+			CacheDir string
+		}
+	}
+	HTTP struct {
+		MaxRequestSize int `validate:"min=0"`
+	} `conf:"http"`
+	Timeout struct {
+		Read  int `validate:"min=0"`
+		Write int `validate:"min=0"`
+	}
+	Cookie struct {
+		HTTPOnly bool `conf:"http_only"`
+		Prefix   string
+		Secure   bool
+		Domain   string
+		Expires  string
+	}
+	Session struct {
+		Expires time.Duration
+	}
+	Format struct {
+		Date     string
+		Datetime string
+	}
+	I18n struct {
+		DefaultLocale string
+		Cookie        string
+	} `conf:"i18n"`
+	Template struct {
+		Delimiters string
+		Native     struct {
+			Enabled    bool
+			Extensions string
+			Root       string
+			Layout     string
+		}
+	}
+	Read struct {
+		JSON struct {
+			DisallowUnknownFields bool
+			UseNumber             bool
+			MaxDepth              int `validate:"min=0"`
+			MaxSize               int `validate:"min=0"`
+		} `conf:"json"`
+	}
+	Render struct {
+		Chunked       bool
+		ChunkSize     int `validate:"min=0"`
+		FlushInterval time.Duration
+		Fields        string
+		Include       string
+		Compressed    bool
+		Pretty        bool
+		Etag          struct {
+			Weak bool
+		}
+	}
+	Compress struct {
+		Encodings []string
+		Mimes     string
+		MinSize   int            `validate:"min=0"`
+		Level     map[string]int `conf:"level"`
+	}
+	Assets struct {
+		Fingerprint bool
+		Roots       []string
+		URL         string `conf:"url"`
+		Manifest    string
+	}
+	Watch struct {
+		Enabled   bool
+		Mode      string `validate:"oneof=normal eager"`
+		Code      bool
+		Templates bool
+		Gopath    bool
+	}
+	Build struct {
+		Tags      string
+		Targets   []string
+		Trimpath  bool
+		Ldflags   string
+		Embed     []string
+		Checksums bool
+	}
+	Package struct {
+		Format string `validate:"oneof=tar oci"`
+		OCI    struct {
+			Name        string
+			User        string
+			Labels      map[string]string
+			Healthcheck struct {
+				Test        []string
+				Interval    time.Duration
+				Timeout     time.Duration
+				StartPeriod time.Duration
+				Retries     int `validate:"min=0"`
+			}
+		} `conf:"oci"`
+	}
+	Harness struct {
+		Port int `validate:"min=0,max=65535"`
+	}
+	Error struct {
+		Link string
+	}
+}
+
+func init() {
+	RegisterConfig("", coreConfig{})
+}
+
+// RegisterConfig declares the keys of a section of app.yaml, "" being the
+// root, with a struct as accepted by conf.Context.Bind. Init validates the
+// configuration against the registered sections, and fails on unknown keys
+// of these sections, values of the wrong type and missing required values.
+func RegisterConfig(section string, schema interface{}) {
+	conf.Register(section, schema)
+}
+
+func init() {
+	OnConfigChange("logger.level", func(old, new interface{}) {
+		if err := logLevel.UnmarshalText([]byte(cast.ToString(new))); err != nil {
+			Logger.Error("Invalid logger level", zap.Any("level", new), zap.Error(err))
+			return
+		}
+		Logger.Info("Logger level changed", zap.Stringer("level", logLevel.Level()))
+	})
+}
+
+// OnConfigChange registers a function called with the old and new values of
+// key when a reload of the configuration changes it. The key can be a
+// section, e.g. "mail", to be notified of the changes of any of its keys.
+// Egret reconfigures the logger level this way, and the cors module the
+// handlers of cors.Configured. The applications and modules subscribe to the
+// keys they can apply without a restart:
+//
+//      egret.OnConfigChange("mail.maintenance", func(old, new interface{}) {
+//          mailer.Pause(cast.ToBool(new))
+//      })
+//
+// Keys read by every request, like the "render" and "compress" sections, need
+// no subscription: the new values are used as soon as they are loaded.
+func OnConfigChange(key string, fn func(old, new interface{})) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	configSubscriptions = append(configSubscriptions, configSubscription{key, fn})
+}
+
+// ReloadConfig reads the configuration files again and, if they are valid,
+// swaps them with the current ones then calls the OnConfigChange functions of
+// the changed keys. Invalid files are rejected, keeping the running
+// configuration. The functions are called once the reload is done, so they
+// can subscribe or reload in turn.
+func ReloadConfig() error {
+	type change struct {
+		fn       func(old, new interface{})
+		old, new interface{}
+	}
+	changes, err := func() ([]change, error) {
+		configMu.Lock()
+		defer configMu.Unlock()
+
+		olds := make([]interface{}, len(configSubscriptions))
+		for i, sub := range configSubscriptions {
+			olds[i] = Config.Get(sub.key)
+		}
+		if err := Config.Reload(); err != nil {
+			return nil, err
+		}
+		Logger.Info("Configuration reloaded", zap.Strings("files", Config.Files()))
+		changes := []change{}
+		for i, sub := range configSubscriptions {
+			if value := Config.Get(sub.key); !reflect.DeepEqual(olds[i], value) {
+				changes = append(changes, change{sub.fn, olds[i], value})
+			}
+		}
+		return changes, nil
+	}()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		c.fn(c.old, c.new)
+	}
+	return nil
+}
+
+// configListener reloads the configuration when its files change.
+type configListener struct{}
+
+func (configListener) Refresh() *Error {
+	if err := ReloadConfig(); err != nil {
+		Logger.Error("Failed to reload the configuration", zap.Error(err))
+	}
+	return nil
+}
+
+func (configListener) WatchDir(info os.FileInfo) bool {
+	return true
+}
+
+func (configListener) WatchFile(fpath string) bool {
+	return Config.Watches(fpath)
+}
+
+// watchConfig reloads the configuration on SIGHUP and, if "config.watch" is
+// set, when its files change.
+func watchConfig() {
+	configWatchOnce.Do(func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				Logger.Info("SIGHUP received, reloading the configuration")
+				configListener{}.Refresh()
+			}
+		}()
+
+		if !Config.GetBoolDefault("config.watch", false) {
+			return
+		}
+		dirs := []string{}
+		for _, confPath := range ConfPaths {
+			if info, err := os.Stat(confPath); err == nil && info.IsDir() {
+				dirs = append(dirs, filepath.Clean(confPath))
+			}
+		}
+		NewWatcher().ListenEagerly(configListener{}, dirs...)
+	})
+}
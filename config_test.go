@@ -0,0 +1,73 @@
+package egret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	for _, mode := range []string{"dev", "prod"} {
+		ctx, err := conf.LoadContext("app", []string{"core/conf"})
+		assert.Nil(t, err)
+		ctx.SetSection(mode)
+		assert.Nil(t, ctx.Validate(), "the %s mode of core/conf/app.yaml", mode)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-reload")
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "app.yaml")
+	ioutil.WriteFile(fpath, []byte("logger:\n  level: info\nrender:\n  pretty: false\n"), 0666)
+
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", []string{dir})
+	assert.True(t, Config.Watches(fpath))
+
+	var old, new interface{}
+	OnConfigChange("render.pretty", func(o, n interface{}) {
+		old, new = o, n
+	})
+	defer func() { configSubscriptions = configSubscriptions[:len(configSubscriptions)-1] }()
+
+	ioutil.WriteFile(fpath, []byte("logger:\n  level: debug\nrender:\n  pretty: true\n"), 0666)
+	assert.Nil(t, ReloadConfig())
+	assert.Equal(t, false, old)
+	assert.Equal(t, true, new)
+	assert.True(t, Config.GetBool("render.pretty"))
+	assert.Equal(t, "debug", logLevel.Level().String())
+
+	ioutil.WriteFile(fpath, []byte("render:\n  pretty: yes please\n"), 0666)
+	assert.NotNil(t, ReloadConfig(), "invalid files are rejected")
+	assert.True(t, Config.GetBool("render.pretty"), "the running configuration is kept")
+}
+
+func TestReloadConfigReentrant(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-reload")
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "app.yaml")
+	ioutil.WriteFile(fpath, []byte("render:\n  pretty: false\n"), 0666)
+
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", []string{dir})
+	subscriptions := len(configSubscriptions)
+	defer func() { configSubscriptions = configSubscriptions[:subscriptions] }()
+
+	reloads := 0
+	OnConfigChange("render.pretty", func(old, new interface{}) {
+		reloads++
+		OnConfigChange("render.chunked", func(old, new interface{}) {})
+		assert.Nil(t, ReloadConfig(), "the functions can reload")
+	})
+
+	ioutil.WriteFile(fpath, []byte("render:\n  pretty: true\n"), 0666)
+	assert.Nil(t, ReloadConfig())
+	assert.Equal(t, 1, reloads, "the nested reload changes nothing")
+	assert.Equal(t, subscriptions+2, len(configSubscriptions))
+}
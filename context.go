@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/kenorld/egret/core/serializer"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
 )
@@ -230,8 +232,9 @@ func (c *Context) ReverseURL(name string, pairs ...map[string]interface{}) (stri
 
 // Read populates the given struct variable with the store from the current request.
 // If the request is NOT a GET request, it will check the "Content-Type" header
-// and find a matching reader from DataReaders to read the request store.
-// If there is no match or if the request is a GET request, it will use DefaultFormDataReader
+// and find a matching reader from DataReaders to read the request store, or a
+// SerializerDataReader with the serializer.Deserializer of MainSerializerManager
+// for the content type, e.g. the JSON:API one. If there is no match or if the request is a GET request, it will use DefaultFormDataReader
 // to read the request store.
 func (c *Context) Read(store interface{}) error {
 	if c.Request.Method != "GET" {
@@ -239,12 +242,20 @@ func (c *Context) Read(store interface{}) error {
 		if reader, ok := DataReaders[t]; ok {
 			return reader.Read(c.Request, store)
 		}
+		if MainSerializerManager != nil {
+			if d := MainSerializerManager.Deserializer(t); d != nil {
+				return (&SerializerDataReader{Deserializer: d}).Read(c.Request, store)
+			}
+		}
 	}
 
 	return DefaultFormDataReader.Read(c.Request, store)
 }
 
 /* Response */
+
+// RenderTemplate renders the template at path, the "stream" option
+// replacing "render.chunked" to stream the template, see templateWriter.
 func (c *Context) RenderTemplate(path string, o interface{}, options map[string]interface{}) *Context {
 	c.RenderArgs["Entity"] = o
 	c.RenderArgs["template.path"] = path
@@ -252,7 +263,64 @@ func (c *Context) RenderTemplate(path string, o interface{}, options map[string]
 	return c
 }
 
+// Rendering is what ExecuteRender renders for a context, described without
+// rendering it, for the tests of the handlers.
+type Rendering struct {
+	// Status the status of the response.
+	Status int
+	// Error the error rendered as an error page, if any.
+	Error error
+	// RedirectURL the URL redirected to, if any.
+	RedirectURL string
+	// Format the content type of the serialized Entity, e.g. ContentJSON,
+	// empty for the templates.
+	Format string
+	// Entity the serialized object, or the object of the template.
+	Entity interface{}
+	// TemplatePath the path of the rendered template, if any.
+	TemplatePath    string
+	TemplateOptions map[string]interface{}
+	// Binary the file or the reader sent, if any.
+	Binary *Binary
+}
+
+// Rendering returns what ExecuteRender would render, following the same
+// order: the error, the redirect, the serialized object, the binary and then
+// the template.
+func (c *Context) Rendering() Rendering {
+	r := Rendering{Status: c.Response.Status}
+	switch {
+	case c.Error != nil:
+		r.Error, r.Status = c.Error, http.StatusInternalServerError
+		if e, ok := c.Error.(*Error); ok && e.Status != 0 {
+			r.Status = e.Status
+		}
+		return r
+	case cast.ToString(c.RenderArgs["redirectURL"]) != "":
+		r.RedirectURL = cast.ToString(c.RenderArgs["redirectURL"])
+		if r.Status = cast.ToInt(c.RenderArgs["httpStatus"]); r.Status == 0 {
+			r.Status = http.StatusFound
+		}
+		return r
+	case cast.ToString(c.RenderArgs["serialize.format"]) != "":
+		r.Format = cast.ToString(c.RenderArgs["serialize.format"])
+		r.Entity = c.RenderArgs["Entity"]
+	case c.Binary != nil:
+		r.Binary = c.Binary
+	default:
+		r.Entity = c.RenderArgs["Entity"]
+		r.TemplatePath = cast.ToString(c.RenderArgs["template.path"])
+		r.TemplateOptions = cast.ToStringMap(c.RenderArgs["template.options"])
+	}
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	return r
+}
+
 func (c *Context) ExecuteRender() error {
+	// the pages, error pages included, are in the locale of the request
+	c.RenderArgs[CurrentLocaleRenderArg] = c.Request.Locale
 	if c.Error != nil {
 		viewPath := "errors/500." + c.Request.Format
 		if _, ok := c.Error.(*Error); !ok {
@@ -266,25 +334,40 @@ func (c *Context) ExecuteRender() error {
 		e, _ := c.Error.(*Error)
 		c.Response.Status = e.Status
 		c.SetStatusCodeIfNil(500)
-		c.Response.SetFormat(c.Request.Format)
+		// the errors of the formats without templates, e.g. of a JSON:API document, stay in their format
+		format := c.Request.Format
+		if f := cast.ToString(c.RenderArgs["serialize.format"]); errorSerializer(f) != nil {
+			format = f
+		}
+		c.Response.SetFormat(format)
 		c.Response.EnsureHeaderWrited()
 
 		if c.Response.Status != 0 {
 			viewPath = "errors/" + cast.ToString(c.Response.Status) + "." + c.Request.Format
 		}
+		if es := errorSerializer(c.Response.ContentType); es != nil {
+			result, err := es.SerializeError(e.Status, e.Name, e.Title, e.Summary)
+			if err != nil {
+				return err
+			}
+			_, err = c.Response.Write(result)
+			return err
+		}
 		//if DevMode {
 		//fmt.Println("Server Error: ", c.Error)
 		//}
 		return MainTemplateManager.ExecuteWriter(c.Response.Writer, viewPath, map[string]interface{}{
-			"DevMode": DevMode,
-			"RunMode": RunMode,
-			"Error":   c.Error,
+			"DevMode":              DevMode,
+			"RunMode":              RunMode,
+			"Error":                c.Error,
+			CurrentLocaleRenderArg: c.Request.Locale,
 		}, nil)
 	} else if url := cast.ToString(c.RenderArgs["redirectURL"]); url != "" {
 		status := cast.ToInt(c.RenderArgs["httpStatus"])
 		if status == 0 {
 			status = http.StatusFound
 		}
+		c.Response.runBeforeWrite()
 		http.Redirect(c.Response.Writer, c.Request.Request, url, status)
 		return nil
 	} else if format := cast.ToString(c.RenderArgs["serialize.format"]); format != "" {
@@ -295,9 +378,13 @@ func (c *Context) ExecuteRender() error {
 			c.Response.Write([]byte(html))
 			return nil
 		}
-		bytes, err := MainSerializerManager.Serialize(format, c.RenderArgs["Entity"], cast.ToStringMap(c.RenderArgs["serializer.options"]))
-		c.Response.ContentType = format + "; charset=utf-8"
-		c.Response.Write(bytes)
+		c.Response.SetFormat(format)
+		err := MainSerializerManager.SerializeTo(c.Response, format, c.RenderArgs["Entity"], c.serializerOptions())
+		// once written, the status is sent and the body can only be cut short
+		if err != nil && !c.Response.headerWrited {
+			c.Error = err
+			return c.ExecuteRender()
+		}
 		return err
 	} else if c.Binary != nil {
 		c.SetStatusCodeIfNil(http.StatusOK)
@@ -309,10 +396,27 @@ func (c *Context) ExecuteRender() error {
 		format = "text/html"
 	}
 	c.Response.ContentType = format + "; charset=utf-8"
-	c.Response.EnsureHeaderWrited()
 	if viewPath != "" {
-		return MainTemplateManager.ExecuteWriter(c.Response.Writer, viewPath, c.RenderArgs, options)
+		stream, ok := options["stream"]
+		if !ok {
+			stream = Config.GetBoolDefault("render.chunked", false)
+		}
+		w := newTemplateWriter(c.Response, cast.ToBool(stream))
+		if err := MainTemplateManager.ExecuteWriter(w, viewPath, c.RenderArgs, options); err != nil {
+			// once flushed, the status is sent and the page can only be cut short
+			if w.flushed {
+				return err
+			}
+			e := newTemplateError(err)
+			if e.Path == "" {
+				e.Path = viewPath
+			}
+			c.Error = e
+			return c.ExecuteRender()
+		}
+		return w.Flush()
 	}
+	c.Response.EnsureHeaderWrited()
 	return nil
 	// if err != nil {
 	// 	return err
@@ -320,12 +424,22 @@ func (c *Context) ExecuteRender() error {
 	// return MainTemplateManager.ExecuteRaw(viewPath, c.Response.Writer, c.Entity)
 }
 
+// errorSerializer returns the serializer.ErrorSerializer of MainSerializerManager for a content type,
+// nil for the formats rendering their errors with the error templates.
+func errorSerializer(contentType string) serializer.ErrorSerializer {
+	if MainSerializerManager == nil || contentType == "" {
+		return nil
+	}
+	return MainSerializerManager.ErrorSerializer(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
 func sendBinary(req *Request, resp *Response, r *Binary) (err error) {
 	disposition := string(r.Delivery)
 	if r.Name != "" {
 		disposition += fmt.Sprintf(`; filename="%s"`, r.Name)
 	}
 	resp.SetHeader(contentDispositionHeaderKey, disposition)
+	resp.runBeforeWrite()
 
 	// If we have a ReadSeeker, delegate to http.ServeContent
 	if rs, ok := r.Reader.(io.ReadSeeker); ok {
@@ -351,13 +465,34 @@ func sendBinary(req *Request, resp *Response, r *Binary) (err error) {
 	return nil
 }
 
-// Uses encoding/json.Marshal to return JSON to the client.
+// Uses encoding/json.Marshal to return JSON to the client, the items of a
+// channel or a stream.Iterator being written as a JSON array as they are produced.
 func (c *Context) RenderJSON(o interface{}) *Context {
 	c.RenderArgs["serialize.format"] = ContentJSON
 	c.RenderArgs["Entity"] = o
 	return c
 }
 
+// RenderNDJSON renders each item of a collection as a line of JSON, the items
+// of a channel or a stream.Iterator being written as they are produced.
+func (c *Context) RenderNDJSON(o interface{}) *Context {
+	c.RenderArgs["serialize.format"] = ContentNDJSON
+	c.RenderArgs["Entity"] = o
+	return c
+}
+
+// RenderCSV renders each item of a collection as a CSV record, the items of a
+// channel or a stream.Iterator being written as they are produced. The
+// columns of the maps and structs can be given, in order.
+func (c *Context) RenderCSV(o interface{}, columns ...string) *Context {
+	c.RenderArgs["serialize.format"] = ContentCSV
+	c.RenderArgs["Entity"] = o
+	if len(columns) > 0 {
+		c.RenderArgs["serializer.options"] = map[string]interface{}{"columns": columns}
+	}
+	return c
+}
+
 // Renders a JSONP result using encoding/json.Marshal
 func (c *Context) RenderJSONP(o interface{}, callback string) *Context {
 	c.RenderArgs["serialize.format"] = ContentJavascript
@@ -372,6 +507,39 @@ func (c *Context) RenderXML(o interface{}) *Context {
 	return c
 }
 
+// RenderMsgpack renders the object as MessagePack.
+func (c *Context) RenderMsgpack(o interface{}) *Context {
+	c.RenderArgs["serialize.format"] = ContentMsgpack
+	c.RenderArgs["Entity"] = o
+	return c
+}
+
+// RenderCBOR renders the object as CBOR.
+func (c *Context) RenderCBOR(o interface{}) *Context {
+	c.RenderArgs["serialize.format"] = ContentCBOR
+	c.RenderArgs["Entity"] = o
+	return c
+}
+
+// RenderJSONAPI renders a resource, a collection or a resource.Page as a
+// JSON:API document, see package resource for the resources and their links.
+// The related resources given by the "render.include" query parameter, e.g.
+// ?include=author, are included in the document.
+func (c *Context) RenderJSONAPI(o interface{}) *Context {
+	c.RenderArgs["serialize.format"] = ContentJSONAPI
+	c.RenderArgs["Entity"] = o
+	return c
+}
+
+// RenderHAL renders a resource, a collection or a resource.Page as a HAL
+// document, the related resources given by the "render.include" query
+// parameter being embedded in it.
+func (c *Context) RenderHAL(o interface{}) *Context {
+	c.RenderArgs["serialize.format"] = ContentHAL
+	c.RenderArgs["Entity"] = o
+	return c
+}
+
 // Render plaintext in response, printf style.
 func (c *Context) RenderText(text string, objs ...interface{}) *Context {
 	finalText := text
@@ -476,6 +644,23 @@ func (c *Context) Todo() *Context {
 	return c
 }
 
+// BadRequest returns an HTTP 400 Bad Request response whose body is the
+// formatted string of msg and objs.
+func (c *Context) BadRequest(msg string, objs ...interface{}) *Context {
+	finalText := msg
+	if len(objs) > 0 {
+		finalText = fmt.Sprintf(msg, objs...)
+	}
+	c.Response.Status = http.StatusBadRequest
+	c.Error = &Error{
+		Status:  400,
+		Name:    "bad_request",
+		Title:   "Bad Request",
+		Summary: finalText,
+	}
+	return c
+}
+
 // NotFound returns an HTTP 404 Not Found response whose body is the
 // formatted string of msg and objs.
 func (c *Context) NotFound(msg string, objs ...interface{}) *Context {
@@ -509,3 +694,20 @@ func (c *Context) Forbidden(msg string, objs ...interface{}) *Context {
 	}
 	return c
 }
+
+// PreconditionFailed returns an HTTP 412 Precondition Failed response whose
+// body is the formatted string of msg and objs.
+func (c *Context) PreconditionFailed(msg string, objs ...interface{}) *Context {
+	finalText := msg
+	if len(objs) > 0 {
+		finalText = fmt.Sprintf(msg, objs...)
+	}
+	c.Response.Status = http.StatusPreconditionFailed
+	c.Error = &Error{
+		Status:  412,
+		Name:    "precondition_failed",
+		Title:   "Precondition Failed",
+		Summary: finalText,
+	}
+	return c
+}
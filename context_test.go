@@ -0,0 +1,365 @@
+package egret
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/kenorld/egret/conf"
+	"github.com/kenorld/egret/core/serializer"
+	ejson "github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/resource"
+	"github.com/kenorld/egret/core/serializer/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+type testBooking struct {
+	ID     int    `csv:"id" json:"id"`
+	Hotel  string `csv:"hotel" json:"hotel"`
+	Secret string `csv:"-" json:"-"`
+}
+
+func renderSerialized(render func(c *Context)) (*httptest.ResponseRecorder, error) {
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", nil)
+	MainSerializerManager = serializer.NewManager()
+	serializer.RegisterDefaults(MainSerializerManager)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/bookings", nil)
+	c := NewContext(NewRequest(r), NewResponse(w))
+	render(c)
+	return w, c.ExecuteRender()
+}
+
+// serveHandlers runs the handlers and renders their result for req, as the
+// router does, closing the writers they wrap the response writer with.
+func serveHandlers(req *http.Request, handlers ...HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c := NewContext(NewRequest(req), NewResponse(w))
+	c.Handlers = handlers
+	c.Next()
+	c.ExecuteRender()
+	if closer, ok := c.Response.Writer.(io.Closer); ok {
+		closer.Close()
+	}
+	return w
+}
+
+func bookings(n int) stream.Iterator {
+	return func(yield func(interface{}) error) error {
+		for i := 1; i <= n; i++ {
+			if err := yield(testBooking{i, "Hilton", "x"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestRenderStreams(t *testing.T) {
+	w, err := renderSerialized(func(c *Context) { c.RenderNDJSON(bookings(2)) })
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", w.Header().Get(ContentType))
+	assert.Equal(t, "{\"id\":1,\"hotel\":\"Hilton\"}\n{\"id\":2,\"hotel\":\"Hilton\"}\n", w.Body.String())
+
+	ch := make(chan testBooking, 2)
+	ch <- testBooking{1, "Hilton", "x"}
+	ch <- testBooking{2, "Ritz", "x"}
+	close(ch)
+	w, err = renderSerialized(func(c *Context) { c.RenderJSON(ch) })
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"id":1,"hotel":"Hilton"},{"id":2,"hotel":"Ritz"}]`, w.Body.String())
+
+	w, err = renderSerialized(func(c *Context) { c.RenderJSON(stream.Iterator(func(func(interface{}) error) error { return nil })) })
+	assert.Nil(t, err)
+	assert.Equal(t, `[]`, w.Body.String())
+
+	w, err = renderSerialized(func(c *Context) { c.RenderCSV(bookings(2)) })
+	assert.Nil(t, err)
+	assert.Equal(t, "id,hotel\n1,Hilton\n2,Hilton\n", w.Body.String())
+
+	rows := []map[string]interface{}{{"name": "Hilton", "stars": 5}, {"name": "Ritz, Paris"}}
+	w, err = renderSerialized(func(c *Context) { c.RenderCSV(rows, "stars", "name") })
+	assert.Nil(t, err)
+	assert.Equal(t, "stars,name\n5,Hilton\n,\"Ritz, Paris\"\n", w.Body.String())
+
+	w, err = renderSerialized(func(c *Context) { c.RenderCSV([]map[int]string{{2: "b", 10: "j"}}) })
+	assert.Nil(t, err)
+	assert.Equal(t, "10,2\nj,b\n", w.Body.String(), "the keys of any type name the columns")
+
+	w, err = renderSerialized(func(c *Context) { c.RenderCSV(bookings(150)) })
+	assert.Nil(t, err)
+	assert.True(t, w.Flushed, "the records of a stream are flushed as they are written")
+	assert.Equal(t, 151, strings.Count(w.Body.String(), "\n"))
+
+	w, err = renderSerialized(func(c *Context) { c.RenderNDJSON(bookings(150)) })
+	assert.Nil(t, err)
+	assert.True(t, w.Flushed, "the lines of a stream are flushed as they are written")
+	assert.Equal(t, 150, strings.Count(w.Body.String(), "\n"))
+
+	w, err = renderSerialized(func(c *Context) { c.RenderJSON(bookings(150)) })
+	assert.Nil(t, err)
+	assert.True(t, w.Flushed, "the items of a stream are flushed as they are written")
+	assert.Equal(t, 150, strings.Count(w.Body.String(), `"hotel"`))
+}
+
+func TestRenderStreamErrors(t *testing.T) {
+	failing := stream.Iterator(func(yield func(interface{}) error) error {
+		return errors.New("connection lost")
+	})
+	// the error page replaces the body, whatever the template engines
+	w, _ := renderSerialized(func(c *Context) { c.RenderNDJSON(failing) })
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	failing = func(yield func(interface{}) error) error {
+		yield(testBooking{1, "Hilton", "x"})
+		return errors.New("connection lost")
+	}
+	w, err := renderSerialized(func(c *Context) { c.RenderNDJSON(failing) })
+	assert.EqualError(t, err, "connection lost")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"id\":1,\"hotel\":\"Hilton\"}\n", w.Body.String())
+}
+
+func TestRenderBinaryFormats(t *testing.T) {
+	booking := map[string]interface{}{"id": 1, "hotel": "Hilton"}
+	w, err := renderSerialized(func(c *Context) { c.RenderMsgpack(booking) })
+	assert.Nil(t, err)
+	assert.Equal(t, ContentMsgpack, w.Header().Get(ContentType))
+	var decoded map[string]interface{}
+	assert.Nil(t, msgpack.Unmarshal(w.Body.Bytes(), &decoded))
+	assert.Equal(t, "Hilton", decoded["hotel"])
+
+	w, err = renderSerialized(func(c *Context) { c.RenderCBOR(booking) })
+	assert.Nil(t, err)
+	assert.Equal(t, ContentCBOR, w.Header().Get(ContentType))
+	decoded = nil
+	assert.Nil(t, cbor.Unmarshal(w.Body.Bytes(), &decoded))
+	assert.Equal(t, "Hilton", decoded["hotel"])
+
+	// the error page of a client accepting CBOR only
+	w, err = renderSerialized(func(c *Context) {
+		c.Request.Format = ResolveFormat(&http.Request{Header: http.Header{"Accept": {"application/cbor"}}})
+		c.NotFound("no booking %d", 2)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentCBOR, w.Header().Get(ContentType))
+	var page struct{ Error struct{ Status int } }
+	assert.Nil(t, cbor.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, http.StatusNotFound, page.Error.Status)
+}
+
+func TestResolveFormat(t *testing.T) {
+	tests := map[string]string{
+		"":                                   "html",
+		"text/html,application/xhtml+xml":    "html",
+		"application/json":                   "json",
+		"application/msgpack":                "msgpack",
+		"application/x-msgpack":              "msgpack",
+		"application/cbor, application/json": "cbor",
+		"application/vnd.api+json":           "jsonapi",
+		"application/hal+json":               "hal",
+		"application/xml":                    "xml",
+		"text/plain":                         "txt",
+	}
+	for accept, expected := range tests {
+		assert.Equal(t, expected, ResolveFormat(&http.Request{Header: http.Header{"Accept": {accept}}}), accept)
+	}
+}
+
+func TestRenderFields(t *testing.T) {
+	type hotel struct {
+		ID      int    `json:"id" xml:"id"`
+		Name    string `json:"name" xml:"name"`
+		Address string `json:"address" xml:"address" view:"admin"`
+		Revenue int    `json:"revenue" xml:"revenue" role:"manager"`
+	}
+	render := func(url string, render func(c *Context)) string {
+		Config, _ = conf.LoadContext("app", nil)
+		MainSerializerManager = serializer.NewManager()
+		serializer.RegisterDefaults(MainSerializerManager)
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", url, nil)
+		c := NewContext(NewRequest(r), NewResponse(w))
+		render(c)
+		assert.Nil(t, c.ExecuteRender())
+		return w.Body.String()
+	}
+	h := hotel{1, "Hilton", "Paris", 1000}
+
+	assert.Equal(t, `{"id":1,"name":"Hilton"}`, render("/hotels/1?fields=id,name", func(c *Context) { c.RenderJSON(h) }))
+	assert.Equal(t, `<hotel><name>Hilton</name></hotel>`, render("/hotels/1?fields=name", func(c *Context) { c.RenderXML(h) }))
+	assert.Equal(t, `{"id":1,"name":"Hilton","revenue":1000}`, render("/hotels/1", func(c *Context) { c.SetView("public").RenderJSON(h) }))
+
+	OmitField = func(c *Context, field reflect.StructField) bool {
+		return field.Tag.Get("role") != "" && c.Get("role") != field.Tag.Get("role")
+	}
+	defer func() { OmitField = nil }()
+	assert.Equal(t, `{"id":1,"name":"Hilton","address":"Paris"}`, render("/hotels/1", func(c *Context) { c.RenderJSON(h) }))
+	assert.Equal(t, "{\"name\":\"Hilton\",\"revenue\":1000}\n", render("/hotels?fields=name,revenue", func(c *Context) {
+		c.Set("role", "manager")
+		c.RenderNDJSON([]hotel{h})
+	}))
+}
+
+type countingCodec struct {
+	ejson.StdCodec
+	marshaled, decoded int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshaled++
+	return c.StdCodec.Marshal(v)
+}
+
+func (c *countingCodec) NewDecoder(r io.Reader) ejson.Decoder {
+	c.decoded++
+	return c.StdCodec.NewDecoder(r)
+}
+
+func TestJSONCodec(t *testing.T) {
+	codec := &countingCodec{}
+	ejson.DefaultCodec = codec
+	defer func() { ejson.DefaultCodec = ejson.StdCodec{} }()
+
+	w, err := renderSerialized(func(c *Context) { c.RenderJSON(bookings(2)) })
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"id":1,"hotel":"Hilton"},{"id":2,"hotel":"Hilton"}]`, w.Body.String())
+	assert.Equal(t, 2, codec.marshaled)
+
+	var booking testBooking
+	r, _ := http.NewRequest("POST", "/bookings", strings.NewReader(`{"id": 3}`))
+	r.Header.Set(ContentType, ContentJSON)
+	assert.Nil(t, NewContext(NewRequest(r), nil).Read(&booking))
+	assert.Equal(t, 3, booking.ID)
+	assert.Equal(t, 1, codec.decoded)
+}
+
+type testHotel struct {
+	ID   int    `json:"id" resource:"id,hotels" route:"hotel"`
+	Name string `json:"name"`
+}
+
+type testReservation struct {
+	ID    int        `json:"id" resource:"id,reservations" route:"reservation"`
+	Hotel *testHotel `json:"hotel" resource:"rel"`
+}
+
+func TestRenderHypermedia(t *testing.T) {
+	router := NewRouter()
+	router.Path("/hotels/<id>").Get(handler0).Name("hotel")
+	router.Path("/reservations/<id>").Get(handler0).Name("reservation")
+	router.Path("/reservations").Get(handler0).Name("reservations")
+	defer func() { routers = routers[:len(routers)-1] }()
+
+	reservation := testReservation{7, &testHotel{3, "Hilton"}}
+	w, err := renderSerialized(func(c *Context) {
+		initSerializer()
+		c.Request.URL.RawQuery = "include=hotel"
+		c.RenderJSONAPI(reservation)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ContentJSONAPI, w.Header().Get(ContentType))
+	assert.Equal(t, `{"data":{"type":"reservations","id":"7","relationships":{"hotel":{"data":{"type":"hotels","id":"3"}}},`+
+		`"links":{"self":"/reservations/7"}},"included":[{"type":"hotels","id":"3","attributes":{"name":"Hilton"},`+
+		`"links":{"self":"/hotels/3"}}],"links":{"self":"/reservations/7"}}`, w.Body.String())
+
+	w, err = renderSerialized(func(c *Context) {
+		initSerializer()
+		c.RenderHAL(resource.Page{Items: []testReservation{reservation}, Number: 1, Size: 1, Total: 2, Route: "reservations"})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/hal+json; charset=utf-8", w.Header().Get(ContentType))
+	assert.Equal(t, `{"_embedded":{"reservations":[{"_links":{"hotel":{"href":"/hotels/3"},"self":{"href":"/reservations/7"}},"id":7}]},`+
+		`"_links":{"first":{"href":"/reservations?page=1\u0026size=1"},"last":{"href":"/reservations?page=2\u0026size=1"},`+
+		`"next":{"href":"/reservations?page=2\u0026size=1"},"self":{"href":"/reservations?page=1\u0026size=1"}},"total":2}`, w.Body.String())
+
+	// the sparse fieldsets select the attributes, the ids and relations are kept
+	w, err = renderSerialized(func(c *Context) {
+		initSerializer()
+		c.Request.URL.RawQuery = "fields=hotel&include=hotel"
+		c.RenderJSONAPI(reservation)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"data":{"type":"reservations","id":"7","relationships":{"hotel":{"data":{"type":"hotels","id":"3"}}},`+
+		`"links":{"self":"/reservations/7"}},"included":[{"type":"hotels","id":"3","attributes":{"name":"Hilton"},`+
+		`"links":{"self":"/hotels/3"}}],"links":{"self":"/reservations/7"}}`, w.Body.String())
+
+	w, err = renderSerialized(func(c *Context) {
+		initSerializer()
+		c.Request.URL.RawQuery = "fields=name"
+		c.RenderHAL([]testHotel{{3, "Hilton"}})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"_embedded":{"hotels":[{"_links":{"self":{"href":"/hotels/3"}},"name":"Hilton"}]}}`, w.Body.String())
+
+	// the errors of a JSON:API document are a JSON:API errors document
+	w, _ = renderSerialized(func(c *Context) {
+		initSerializer()
+		c.RenderJSONAPI(testBooking{1, "Hilton", "x"})
+	})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, ContentJSONAPI, w.Header().Get(ContentType))
+	assert.Contains(t, w.Body.String(), `{"errors":[{"status":"500"`)
+
+	w, _ = renderSerialized(func(c *Context) {
+		c.Request.Format = "jsonapi"
+		c.Error = &Error{Status: http.StatusNotFound, Name: "not_found", Title: "Not Found", Summary: "no such reservation"}
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"errors":[{"status":"404","code":"not_found","title":"Not Found","detail":"no such reservation"}]}`, w.Body.String())
+
+	w, _ = renderSerialized(func(c *Context) {
+		c.Request.Format = "hal"
+		c.Error = &Error{Status: http.StatusNotFound, Name: "not_found", Title: "Not Found", Summary: "no such hotel"}
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"name":"not_found","status":404,"summary":"no such hotel","title":"Not Found"}}`, w.Body.String())
+}
+
+func TestRendering(t *testing.T) {
+	newContext := func() *Context {
+		r, _ := http.NewRequest("GET", "/bookings", nil)
+		return NewContext(NewRequest(r), NewResponse(httptest.NewRecorder()))
+	}
+
+	c := newContext()
+	c.RenderTemplate("bookings/list.html", []int{1}, map[string]interface{}{"layout": "main"})
+	r := c.Rendering()
+	assert.Equal(t, 200, r.Status)
+	assert.Equal(t, "bookings/list.html", r.TemplatePath)
+	assert.Equal(t, []int{1}, r.Entity)
+	assert.Equal(t, "main", r.TemplateOptions["layout"])
+	assert.Equal(t, "", r.Format)
+
+	c = newContext()
+	c.RenderJSON(testBooking{1, "Hilton", "x"})
+	r = c.Rendering()
+	assert.Equal(t, ContentJSON, r.Format)
+	assert.Equal(t, testBooking{1, "Hilton", "x"}, r.Entity)
+
+	c = newContext()
+	c.Redirect("/bookings/1", http.StatusSeeOther)
+	r = c.Rendering()
+	assert.Equal(t, http.StatusSeeOther, r.Status)
+	assert.Equal(t, "/bookings/1", r.RedirectURL)
+
+	c = newContext()
+	c.Error = errors.New("boom")
+	r = c.Rendering()
+	assert.Equal(t, 500, r.Status)
+	assert.EqualError(t, r.Error, "boom")
+
+	c = newContext()
+	c.NotFound("No booking")
+	assert.Equal(t, 404, c.Rendering().Status)
+}
@@ -0,0 +1,61 @@
+package cbor
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "application/cbor"
+)
+
+// Serializer the serializer which renders a CBOR 'object', the fields being named after their cbor
+// or json tag
+type Serializer struct {
+	config Config
+	mode   cbor.EncMode
+}
+
+// New returns a new cbor serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	options := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}
+	if c.Canonical {
+		options = cbor.CanonicalEncOptions()
+	}
+	mode, err := options.EncMode()
+	if err != nil {
+		panic("cbor: " + err.Error())
+	}
+	return &Serializer{config: c, mode: mode}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	return e.mode.Marshal(val)
+}
+
+// SerializeError returns the representation of an error, its status, name, title and summary in "error"
+// implements the serializer.ErrorSerializer interface
+func (e *Serializer) SerializeError(status int, name, title, summary string) ([]byte, error) {
+	return e.Serialize(map[string]interface{}{
+		"error": map[string]interface{}{"status": status, "name": name, "title": title, "summary": summary},
+	})
+}
+
+// SerializeTo writes the CBOR representation of the 'object'
+// implements the serializer.StreamSerializer interface
+func (e *Serializer) SerializeTo(w io.Writer, val interface{}, options ...map[string]interface{}) error {
+	return e.mode.NewEncoder(w).Encode(val)
+}
@@ -0,0 +1,8 @@
+package cbor
+
+// Config is the configuration for this serializer
+type Config struct {
+	// Canonical sorts the keys of the maps, so equal values are encoded the same,
+	// see RFC 7049 Section 3.9
+	Canonical bool
+}
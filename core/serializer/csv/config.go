@@ -0,0 +1,20 @@
+package csv
+
+import "github.com/kenorld/egret/core/serializer/stream"
+
+// Config is the configuration for this serializer
+type Config struct {
+	// Comma is the field delimiter, ',' by default
+	Comma rune
+	// Columns the columns of the maps and structs, and their order.
+	// By default the keys of the first map, sorted, or the fields of the first struct
+	Columns []string
+	// NoHeader disables the header row of the maps and structs
+	NoHeader bool
+	// FlushRows the number of records of a stream after which they are flushed to the client,
+	// DefaultFlushRows by default. A negative value flushes them at the end only
+	FlushRows int
+}
+
+// DefaultFlushRows the default FlushRows
+const DefaultFlushRows = stream.DefaultFlushItems
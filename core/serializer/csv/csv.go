@@ -0,0 +1,183 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/kenorld/egret/core/serializer/stream"
+	"github.com/spf13/cast"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "text/csv"
+)
+
+// Serializer the serializer which renders each item of a collection as a record,
+// see stream.Each for the collections accepted. An item is a []string, a []interface{},
+// a map, its keys naming the columns, or a struct, the "csv" tag of a field naming its column:
+//
+//      type Booking struct {
+//          ID     int    `csv:"id"`
+//          Hotel  string `csv:"hotel"`
+//          Secret string `csv:"-"`
+//      }
+//
+// The "columns" option replaces the Columns of the config.
+type Serializer struct {
+	config Config
+}
+
+// New returns a new csv serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Comma == 0 {
+		c.Comma = ','
+	}
+	if c.FlushRows == 0 {
+		c.FlushRows = DefaultFlushRows
+	}
+	return &Serializer{config: c}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := e.SerializeTo(buf, val, options...)
+	return buf.Bytes(), err
+}
+
+// SerializeTo writes the records of the items as they are produced, flushing them every FlushRows
+// records of a stream, along with w if it is an http.Flusher
+// implements the serializer.StreamSerializer interface
+func (e *Serializer) SerializeTo(w io.Writer, val interface{}, options ...map[string]interface{}) error {
+	columns := e.config.Columns
+	if len(options) > 0 && options[0]["columns"] != nil {
+		columns = cast.ToStringSlice(options[0]["columns"])
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = e.config.Comma
+	first, rows, flushRows := true, 0, 0
+	if stream.IsStream(val) {
+		flushRows = e.config.FlushRows
+	}
+	err := stream.Each(val, func(item interface{}) error {
+		v := reflect.Indirect(reflect.ValueOf(item))
+		var record []string
+		switch v.Kind() {
+		case reflect.Map:
+			// the keys of any type name their column as they are formatted
+			values := make(map[string]interface{}, v.Len())
+			for iter := v.MapRange(); iter.Next(); {
+				values[format(iter.Key().Interface())] = iter.Value().Interface()
+			}
+			if first && len(columns) == 0 {
+				for column := range values {
+					columns = append(columns, column)
+				}
+				sort.Strings(columns)
+			}
+			record = make([]string, len(columns))
+			for i, column := range columns {
+				if value, ok := values[column]; ok {
+					record[i] = format(value)
+				}
+			}
+		case reflect.Struct:
+			fields := structFields(v.Type())
+			if first && len(columns) == 0 {
+				for _, f := range fields {
+					columns = append(columns, f.column)
+				}
+			}
+			record = make([]string, len(columns))
+			for i, column := range columns {
+				for _, f := range fields {
+					if f.column == column {
+						record[i] = format(v.Field(f.index).Interface())
+						break
+					}
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			record = make([]string, v.Len())
+			for i := range record {
+				record[i] = format(v.Index(i).Interface())
+			}
+		default:
+			return fmt.Errorf("csv: can't write a record of %T", item)
+		}
+
+		if first && !e.config.NoHeader && (v.Kind() == reflect.Map || v.Kind() == reflect.Struct) {
+			if err := cw.Write(columns); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		if rows++; flushRows > 0 && rows%flushRows == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			stream.Flush(w)
+		}
+		return nil
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+type field struct {
+	index  int
+	column string
+}
+
+// structFields returns the exported fields of t, and their column
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i, n := 0, t.NumField(); i < n; i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		column := f.Tag.Get("csv")
+		if column == "-" {
+			continue
+		}
+		if column == "" {
+			column = f.Name
+		}
+		fields = append(fields, field{index: i, column: column})
+	}
+	return fields
+}
+
+func format(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, err := cast.ToStringE(value); err == nil {
+		return s
+	}
+	return fmt.Sprint(value)
+}
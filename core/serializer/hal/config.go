@@ -0,0 +1,18 @@
+package hal
+
+import (
+	"github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/resource"
+)
+
+// Config is the configuration for this serializer
+type Config struct {
+	// Codec marshals the documents, json.DefaultCodec if nil
+	Codec json.Codec
+	// Link builds the links of the resources and the pages, none are if nil
+	Link resource.LinkFunc
+	// PageParam and SizeParam the query parameters of the page links,
+	// "page" and "size" if empty
+	PageParam string
+	SizeParam string
+}
@@ -0,0 +1,211 @@
+// Package hal renders the resources described by package resource as HAL documents,
+// https://tools.ietf.org/html/draft-kelly-json-hal.
+//
+// A resource is rendered as its json fields along with its self link and the links of its relations
+// in "_links", the resources of the relations given by the "include" option, e.g. "author,comments.author",
+// being embedded in "_embedded". A collection or a resource.Page embeds its resources under their type,
+// a page adding the links of the pages around it and its total. The other values are rendered as they are.
+package hal
+
+import (
+	"fmt"
+	"reflect"
+
+	ejson "github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/resource"
+	"github.com/kenorld/egret/core/serializer/shape"
+	"github.com/kenorld/egret/core/serializer/stream"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "application/hal+json"
+)
+
+type link struct {
+	Href string `json:"href"`
+}
+
+// Serializer the serializer which renders a HAL document
+type Serializer struct {
+	config Config
+}
+
+// New returns a new hal serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Codec == nil {
+		c.Codec = ejson.DefaultCodec
+	}
+	if c.PageParam == "" {
+		c.PageParam = "page"
+	}
+	if c.SizeParam == "" {
+		c.SizeParam = "size"
+	}
+	return &Serializer{config: c}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// ShapesObjects tells that the serializer shapes the attributes of the resources itself, their ids and
+// relations being kept whatever the fieldset
+func (e *Serializer) ShapesObjects() {}
+
+// SerializeError returns the document of an error, its status, name, title and summary in "error"
+// implements the serializer.ErrorSerializer interface
+func (e *Serializer) SerializeError(status int, name, title, summary string) ([]byte, error) {
+	return e.config.Codec.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"status": status, "name": name, "title": title, "summary": summary},
+	})
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	b := resource.Builder{Codec: e.config.Codec, Link: e.config.Link}
+	if len(options) > 0 {
+		if o := shape.OptionsOf(options[0]); !o.IsZero() {
+			b.Shaper = shape.New(o)
+		}
+	}
+	include := resource.Include(options...)
+	items, page := val, (*resource.Page)(nil)
+	switch p := val.(type) {
+	case resource.Page:
+		items, page = p.Items, &p
+	case *resource.Page:
+		items, page = p.Items, p
+	}
+
+	if page == nil && !isCollection(items) {
+		r, err := b.Resource(items)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			return e.config.Codec.Marshal(val)
+		}
+		doc, err := e.resource(b, r, include)
+		if err != nil {
+			return nil, err
+		}
+		return e.config.Codec.Marshal(doc)
+	}
+
+	name, embedded := "items", []interface{}{}
+	if err := stream.Each(items, func(item interface{}) error {
+		r, err := b.Resource(item)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			return fmt.Errorf("hal: %T isn't a resource", item)
+		}
+		doc, err := e.resource(b, r, include)
+		if err != nil {
+			return err
+		}
+		name = r.Type
+		embedded = append(embedded, doc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{"_embedded": map[string]interface{}{name: embedded}}
+	if page != nil {
+		links, err := b.PageLinks(*page, len(embedded), e.config.PageParam, e.config.SizeParam)
+		if err != nil {
+			return nil, err
+		}
+		if len(links) > 0 {
+			halLinks := map[string]interface{}{}
+			for rel, href := range links {
+				halLinks[rel] = link{Href: href}
+			}
+			doc["_links"] = halLinks
+		}
+		if page.Total > 0 {
+			doc["total"] = page.Total
+		}
+	}
+	return e.config.Codec.Marshal(doc)
+}
+
+// resource returns the HAL representation of r, embedding the resources of the relations selected by include
+func (e *Serializer) resource(b resource.Builder, r *resource.Resource, include shape.Fields) (map[string]interface{}, error) {
+	doc := make(map[string]interface{}, len(r.Attributes)+2)
+	for name, value := range r.Attributes {
+		doc[name] = value
+	}
+	links, embedded := map[string]interface{}{}, map[string]interface{}{}
+	if r.Self != "" {
+		links["self"] = link{Href: r.Self}
+	}
+
+	relations, err := b.Relations(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range relations {
+		var hrefs []link
+		for _, related := range rel.Resources {
+			if related.Self != "" {
+				hrefs = append(hrefs, link{Href: related.Self})
+			}
+		}
+		switch {
+		case rel.Many && len(hrefs) > 0:
+			links[rel.Name] = hrefs
+		case len(hrefs) > 0:
+			links[rel.Name] = hrefs[0]
+		case rel.Related != "":
+			links[rel.Name] = link{Href: rel.Related}
+		}
+
+		sub, ok := include[rel.Name]
+		if !ok {
+			continue
+		}
+		docs := []interface{}{}
+		for _, related := range rel.Resources {
+			relatedDoc, err := e.resource(b, related, sub)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, relatedDoc)
+		}
+		switch {
+		case rel.Many:
+			embedded[rel.Name] = docs
+		case len(docs) > 0:
+			embedded[rel.Name] = docs[0]
+		default:
+			embedded[rel.Name] = nil
+		}
+	}
+
+	if len(links) > 0 {
+		doc["_links"] = links
+	}
+	if len(embedded) > 0 {
+		doc["_embedded"] = embedded
+	}
+	return doc, nil
+}
+
+// isCollection returns true for the streams, slices and arrays, but []byte
+func isCollection(val interface{}) bool {
+	if stream.IsStream(val) {
+		return true
+	}
+	t := reflect.TypeOf(val)
+	return t != nil && (t.Kind() == reflect.Array || t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8)
+}
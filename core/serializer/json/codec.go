@@ -0,0 +1,58 @@
+package json
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type (
+	// Codec marshals and decodes JSON for the JSON serializers and the JSON data reader of egret,
+	// encoding/json by default. A faster implementation is plugged by replacing DefaultCodec, e.g. with
+	// an adapter of jsoniter.ConfigCompatibleWithStandardLibrary, the encoders and decoders of which
+	// already implement Encoder and Decoder
+	Codec interface {
+		Marshal(v interface{}) ([]byte, error)
+		MarshalIndent(v interface{}, prefix, indent string) ([]byte, error)
+		NewEncoder(w io.Writer) Encoder
+		NewDecoder(r io.Reader) Decoder
+	}
+
+	// Encoder writes JSON values to an output stream, as encoding/json.Encoder does
+	Encoder interface {
+		Encode(v interface{}) error
+		SetEscapeHTML(on bool)
+	}
+
+	// Decoder reads JSON values from an input stream, as encoding/json.Decoder does
+	Decoder interface {
+		Decode(v interface{}) error
+		DisallowUnknownFields()
+		UseNumber()
+	}
+
+	// StdCodec is the Codec of encoding/json
+	StdCodec struct{}
+)
+
+// DefaultCodec is the Codec used when the Config of a serializer has none
+var DefaultCodec Codec = StdCodec{}
+
+// Marshal implements the Codec interface
+func (StdCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// MarshalIndent implements the Codec interface
+func (StdCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+// NewEncoder implements the Codec interface
+func (StdCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+// NewDecoder implements the Codec interface
+func (StdCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
@@ -2,6 +2,7 @@ package json
 
 import (
 	"github.com/imdario/mergo"
+	"github.com/kenorld/egret/core/serializer/stream"
 )
 
 // Config is the configuration for this serializer
@@ -10,6 +11,11 @@ type Config struct {
 	UnEscapeHTML  bool
 	Prefix        []byte
 	StreamingJSON bool
+	// Codec marshals the values, DefaultCodec if nil
+	Codec Codec
+	// FlushItems the number of items of a stream after which they are flushed to the client,
+	// stream.DefaultFlushItems by default. A negative value flushes them at the end only
+	FlushItems int
 }
 
 // DefaultConfig returns the default configuration for this serializer
@@ -19,6 +25,7 @@ func DefaultConfig() Config {
 		UnEscapeHTML:  false,
 		Prefix:        []byte(""),
 		StreamingJSON: false,
+		FlushItems:    stream.DefaultFlushItems,
 	}
 }
 
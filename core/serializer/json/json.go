@@ -2,8 +2,9 @@ package json
 
 import (
 	"bytes"
-	"encoding/json"
+	"io"
 
+	"github.com/kenorld/egret/core/serializer/stream"
 	"github.com/valyala/bytebufferpool"
 )
 
@@ -37,6 +38,14 @@ var (
 	and    = []byte("&")
 )
 
+// codec returns the Codec of the config, else DefaultCodec
+func (e *Serializer) codec() Codec {
+	if e.config.Codec != nil {
+		return e.config.Codec
+	}
+	return DefaultCodec
+}
+
 // ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
 func (e *Serializer) ContentType() string {
 	return ContentType
@@ -50,7 +59,7 @@ func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{
 		if len(e.config.Prefix) > 0 {
 			w.Write(e.config.Prefix)
 		}
-		err := json.NewEncoder(w).Encode(val)
+		err := e.codec().NewEncoder(w).Encode(val)
 		result := w.Bytes()
 		buffer.Put(w)
 		return result, err
@@ -60,10 +69,10 @@ func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{
 	var err error
 
 	if e.config.Indent {
-		result, err = json.MarshalIndent(val, "", "  ")
+		result, err = e.codec().MarshalIndent(val, "", "  ")
 		result = append(result, newLineB...)
 	} else {
-		result, err = json.Marshal(val)
+		result, err = e.codec().Marshal(val)
 	}
 	if err != nil {
 		return nil, err
@@ -79,3 +88,62 @@ func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{
 	}
 	return result, nil
 }
+
+var (
+	openB  = []byte("[")
+	commaB = []byte(",")
+	closeB = []byte("]")
+)
+
+// SerializeTo writes the items of a channel or a stream.Iterator as a JSON array, as they are produced,
+// flushing them every FlushItems items if w is an http.Flusher, and the other values as Serialize does
+// implements the serializer.StreamSerializer interface
+func (e *Serializer) SerializeTo(w io.Writer, val interface{}, options ...map[string]interface{}) error {
+	if !stream.IsStream(val) {
+		result, err := e.Serialize(val, options...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(result)
+		return err
+	}
+
+	if len(e.config.Prefix) > 0 {
+		if _, err := w.Write(e.config.Prefix); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(openB); err != nil {
+		return err
+	}
+	first, items := true, 0
+	err := stream.Each(val, func(item interface{}) error {
+		result, err := e.codec().Marshal(item)
+		if err != nil {
+			return err
+		}
+		if e.config.UnEscapeHTML {
+			result = bytes.Replace(result, ltHex, lt, -1)
+			result = bytes.Replace(result, gtHex, gt, -1)
+			result = bytes.Replace(result, andHex, and, -1)
+		}
+		if !first {
+			if _, err := w.Write(commaB); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err = w.Write(result); err != nil {
+			return err
+		}
+		if items++; e.config.FlushItems > 0 && items%e.config.FlushItems == 0 {
+			stream.Flush(w)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(closeB)
+	return err
+}
@@ -0,0 +1,288 @@
+// Package jsonapi renders the resources described by package resource as JSON:API documents,
+// https://jsonapi.org, and reads the resources of the request documents.
+//
+// A resource, a collection or a resource.Page is rendered as the primary data of a document,
+// the resources of the relations given by the "include" option, e.g. "author,comments.author",
+// being added to it as included resources. A page adds the links of the pages around it and
+// its total to the document. An Error or a []Error is rendered as an errors document, and the
+// maps, e.g. the documents built by hand, as they are.
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	ejson "github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/resource"
+	"github.com/kenorld/egret/core/serializer/shape"
+	"github.com/kenorld/egret/core/serializer/stream"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "application/vnd.api+json"
+)
+
+// Error is an error object of an errors document
+type Error struct {
+	Status string            `json:"status,omitempty"`
+	Code   string            `json:"code,omitempty"`
+	Title  string            `json:"title,omitempty"`
+	Detail string            `json:"detail,omitempty"`
+	Source map[string]string `json:"source,omitempty"`
+}
+
+type document struct {
+	Data     interface{}            `json:"data"`
+	Included []*object              `json:"included,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+type errorsDocument struct {
+	Errors []Error `json:"errors"`
+}
+
+type object struct {
+	Type          string                     `json:"type"`
+	ID            string                     `json:"id"`
+	Attributes    map[string]json.RawMessage `json:"attributes,omitempty"`
+	Relationships map[string]*relationship   `json:"relationships,omitempty"`
+	Links         map[string]string          `json:"links,omitempty"`
+}
+
+type relationship struct {
+	// Data a *resource.Identifier, nil for an empty to-one relation, or a []resource.Identifier
+	Data  interface{}       `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Serializer the serializer which renders a JSON:API document
+type Serializer struct {
+	config Config
+}
+
+// New returns a new jsonapi serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Codec == nil {
+		c.Codec = ejson.DefaultCodec
+	}
+	if c.PageParam == "" {
+		c.PageParam = "page[number]"
+	}
+	if c.SizeParam == "" {
+		c.SizeParam = "page[size]"
+	}
+	return &Serializer{config: c}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// ShapesObjects tells that the serializer shapes the attributes of the resources itself, their ids and
+// relations being kept whatever the fieldset
+func (e *Serializer) ShapesObjects() {}
+
+// SerializeError returns the errors document of an error
+// implements the serializer.ErrorSerializer interface
+func (e *Serializer) SerializeError(status int, name, title, summary string) ([]byte, error) {
+	return e.Serialize(Error{Status: strconv.Itoa(status), Code: name, Title: title, Detail: summary})
+}
+
+// Deserialize sets the resource v points to from the resource object of a request document, see Unmarshal
+// implements the serializer.Deserializer interface
+func (e *Serializer) Deserialize(data []byte, v interface{}) error {
+	return Unmarshal(data, v)
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case Error:
+		return e.config.Codec.Marshal(errorsDocument{Errors: []Error{v}})
+	case []Error:
+		return e.config.Codec.Marshal(errorsDocument{Errors: v})
+	case map[string]interface{}:
+		return e.config.Codec.Marshal(v)
+	}
+
+	b := resource.Builder{Codec: e.config.Codec, Link: e.config.Link}
+	if len(options) > 0 {
+		if o := shape.OptionsOf(options[0]); !o.IsZero() {
+			b.Shaper = shape.New(o)
+		}
+	}
+	doc := &document{}
+	items, page := val, (*resource.Page)(nil)
+	switch p := val.(type) {
+	case resource.Page:
+		items, page = p.Items, &p
+	case *resource.Page:
+		items, page = p.Items, p
+	}
+
+	var primary []*resource.Resource
+	if page != nil || isCollection(items) {
+		data := []*object{}
+		if err := stream.Each(items, func(item interface{}) error {
+			r, err := b.Resource(item)
+			if err != nil {
+				return err
+			}
+			if r == nil {
+				return fmt.Errorf("jsonapi: %T isn't a resource", item)
+			}
+			obj, err := e.object(b, r)
+			if err != nil {
+				return err
+			}
+			primary = append(primary, r)
+			data = append(data, obj)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		doc.Data = data
+	} else if !isNil(items) {
+		r, err := b.Resource(items)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			return nil, fmt.Errorf("jsonapi: %T isn't a resource", items)
+		}
+		obj, err := e.object(b, r)
+		if err != nil {
+			return nil, err
+		}
+		primary = append(primary, r)
+		doc.Data = obj
+		if r.Self != "" {
+			doc.Links = map[string]string{"self": r.Self}
+		}
+	}
+
+	included, err := b.Included(primary, resource.Include(options...))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range included {
+		obj, err := e.object(b, r)
+		if err != nil {
+			return nil, err
+		}
+		doc.Included = append(doc.Included, obj)
+	}
+	if page != nil {
+		if doc.Links, err = b.PageLinks(*page, len(primary), e.config.PageParam, e.config.SizeParam); err != nil {
+			return nil, err
+		}
+		if page.Total > 0 {
+			doc.Meta = map[string]interface{}{"total": page.Total}
+		}
+	}
+	return e.config.Codec.Marshal(doc)
+}
+
+// object returns the resource object of r
+func (e *Serializer) object(b resource.Builder, r *resource.Resource) (*object, error) {
+	obj := &object{Type: r.Type, ID: r.ID, Attributes: r.Attributes}
+	// the id is a member of the object, not an attribute
+	delete(obj.Attributes, r.IDName)
+	if r.Self != "" {
+		obj.Links = map[string]string{"self": r.Self}
+	}
+	relations, err := b.Relations(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range relations {
+		if obj.Relationships == nil {
+			obj.Relationships = map[string]*relationship{}
+		}
+		data := &relationship{}
+		if rel.Many {
+			ids := []resource.Identifier{}
+			for _, related := range rel.Resources {
+				ids = append(ids, resource.Identifier{Type: related.Type, ID: related.ID})
+			}
+			data.Data = ids
+		} else if len(rel.Resources) > 0 {
+			data.Data = &resource.Identifier{Type: rel.Resources[0].Type, ID: rel.Resources[0].ID}
+		}
+		if rel.Related != "" {
+			data.Links = map[string]string{"related": rel.Related}
+		}
+		obj.Relationships[rel.Name] = data
+	}
+	return obj, nil
+}
+
+// isCollection returns true for the streams, slices and arrays, but []byte
+func isCollection(val interface{}) bool {
+	if stream.IsStream(val) {
+		return true
+	}
+	t := reflect.TypeOf(val)
+	return t != nil && (t.Kind() == reflect.Array || t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8)
+}
+
+func isNil(val interface{}) bool {
+	v := reflect.ValueOf(val)
+	return !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// request is a request document, holding a resource object
+type request struct {
+	Data *struct {
+		Type          string          `json:"type"`
+		ID            string          `json:"id"`
+		Attributes    json.RawMessage `json:"attributes"`
+		Relationships map[string]struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"relationships"`
+	} `json:"data"`
+}
+
+// Unmarshal sets the resource v points to from the resource object of a request document,
+// the related resources of its relationships being set with their id only
+func Unmarshal(data []byte, v interface{}) error {
+	var doc request
+	if err := ejson.DefaultCodec.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return err
+	}
+	if doc.Data == nil {
+		return fmt.Errorf("jsonapi: the document has no primary data")
+	}
+
+	relations := map[string][]resource.Identifier{}
+	for name, rel := range doc.Data.Relationships {
+		var ids []resource.Identifier
+		switch data := bytes.TrimSpace(rel.Data); {
+		case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		case data[0] == '[':
+			if err := json.Unmarshal(data, &ids); err != nil {
+				return fmt.Errorf("jsonapi: relationship %s: %v", name, err)
+			}
+		default:
+			var id resource.Identifier
+			if err := json.Unmarshal(data, &id); err != nil {
+				return fmt.Errorf("jsonapi: relationship %s: %v", name, err)
+			}
+			ids = append(ids, id)
+		}
+		relations[name] = ids
+	}
+
+	return resource.Builder{}.Decode(v, resource.Identifier{Type: doc.Data.Type, ID: doc.Data.ID}, doc.Data.Attributes, relations)
+}
@@ -0,0 +1,114 @@
+package jsonapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kenorld/egret/core/serializer/resource"
+)
+
+type testPeople struct {
+	ID   int    `json:"id" resource:"id,people" route:"people"`
+	Name string `json:"name"`
+}
+
+type testComment struct {
+	ID     string      `json:"id" resource:"id,comments"`
+	Body   string      `json:"body"`
+	Author *testPeople `json:"author" resource:"rel"`
+}
+
+type testArticle struct {
+	ID       int           `json:"id" resource:"id,articles" route:"article"`
+	Title    string        `json:"title"`
+	Draft    bool          `json:"draft,omitempty"`
+	Author   *testPeople   `json:"author" resource:"rel" route:"article_author"`
+	Comments []testComment `json:"comments" resource:"rel"`
+}
+
+var testRoutes = map[string]string{"article": "/articles/", "article_author": "/articles/author/", "people": "/people/", "articles": "/articles"}
+
+func testLink(route string, params map[string]interface{}) (string, error) {
+	if id, ok := params["id"]; ok {
+		return testRoutes[route] + id.(string), nil
+	}
+	return testRoutes[route], nil
+}
+
+func TestSerializeCompoundDocument(t *testing.T) {
+	dan := &testPeople{9, "Dan"}
+	article := testArticle{1, "JSON:API", false, dan, []testComment{{"5", "First", &testPeople{2, "Ann"}}, {"12", "Too", dan}}}
+
+	result, err := New(Config{Link: testLink}).Serialize(article, map[string]interface{}{"include": "author,comments.author"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":{"type":"articles","id":"1","attributes":{"title":"JSON:API"},` +
+		`"relationships":{"author":{"data":{"type":"people","id":"9"},"links":{"related":"/articles/author/1"}},` +
+		`"comments":{"data":[{"type":"comments","id":"5"},{"type":"comments","id":"12"}]}},"links":{"self":"/articles/1"}},` +
+		`"included":[{"type":"people","id":"9","attributes":{"name":"Dan"},"links":{"self":"/people/9"}},` +
+		`{"type":"comments","id":"5","attributes":{"body":"First"},"relationships":{"author":{"data":{"type":"people","id":"2"}}}},` +
+		`{"type":"comments","id":"12","attributes":{"body":"Too"},"relationships":{"author":{"data":{"type":"people","id":"9"}}}},` +
+		`{"type":"people","id":"2","attributes":{"name":"Ann"},"links":{"self":"/people/2"}}],` +
+		`"links":{"self":"/articles/1"}}`
+	if string(result) != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	result, err = New().Serialize((*testArticle)(nil))
+	if err != nil || string(result) != `{"data":null}` {
+		t.Errorf("Expected null data, got %s, %v", result, err)
+	}
+	if _, err = New().Serialize([]int{1}); err == nil {
+		t.Errorf("Expected an error for a collection of non-resources")
+	}
+}
+
+func TestSerializePage(t *testing.T) {
+	page := resource.Page{Items: []testPeople{{1, "Ann"}, {2, "Dan"}}, Number: 2, Size: 2, Total: 5, Route: "articles"}
+	result, err := New(Config{Link: testLink}).Serialize(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"data":[{"type":"people","id":"1"`,
+		`"first":"/articles?page%5Bnumber%5D=1\u0026page%5Bsize%5D=2"`,
+		`"prev":"/articles?page%5Bnumber%5D=1\u0026page%5Bsize%5D=2"`,
+		`"next":"/articles?page%5Bnumber%5D=3\u0026page%5Bsize%5D=2"`,
+		`"last":"/articles?page%5Bnumber%5D=3\u0026page%5Bsize%5D=2"`,
+		`"meta":{"total":5}`,
+	} {
+		if !strings.Contains(string(result), expected) {
+			t.Errorf("Expected %s in %s", expected, result)
+		}
+	}
+
+	result, _ = New().Serialize([]Error{{Status: "404", Title: "Not Found"}})
+	if expected := `{"errors":[{"status":"404","title":"Not Found"}]}`; string(result) != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var article testArticle
+	err := Unmarshal([]byte(`{"data":{"type":"articles","id":"3","attributes":{"title":"Read"},"relationships":{
+		"author":{"data":{"type":"people","id":"9"}},"comments":{"data":[{"type":"comments","id":"5"}]}}}}`), &article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.ID != 3 || article.Title != "Read" || article.Author == nil || article.Author.ID != 9 ||
+		len(article.Comments) != 1 || article.Comments[0].ID != "5" {
+		t.Errorf("Unexpected article %+v", article)
+	}
+
+	for body, expected := range map[string]string{
+		`{"data":{"type":"people","attributes":{}}}`:                                                    `resource: type "people" doesn't match "articles"`,
+		`{"data":{"type":"articles","id":"x"}}`:                                                         `resource: invalid id "x"`,
+		`{"data":{"type":"articles","relationships":{"author":{"data":{"type":"articles","id":"1"}}}}}`: `resource: type "articles" doesn't match "people"`,
+		`{"meta":{}}`: "jsonapi: the document has no primary data",
+	} {
+		if err := Unmarshal([]byte(body), &testArticle{}); err == nil || err.Error() != expected {
+			t.Errorf("Expected %s for %s, got %v", expected, body, err)
+		}
+	}
+}
@@ -2,12 +2,15 @@ package jsonp
 
 import (
 	"github.com/imdario/mergo"
+	"github.com/kenorld/egret/core/serializer/json"
 )
 
 // Config is the configuration for this serializer
 type Config struct {
 	Indent   bool
 	Callback string // the callback can be override by the context's options or parameter on context.JSONP
+	// Codec marshals the values, json.DefaultCodec if nil
+	Codec json.Codec
 }
 
 // DefaultConfig returns the default configuration for this serializer
@@ -1,7 +1,7 @@
 package jsonp
 
 import (
-	"encoding/json"
+	"github.com/kenorld/egret/core/serializer/json"
 )
 
 const (
@@ -41,12 +41,16 @@ func (e *Serializer) ContentType() string {
 // Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
 // implements the go-serializer.Serializer interface
 func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	codec := e.config.Codec
+	if codec == nil {
+		codec = json.DefaultCodec
+	}
 	var result []byte
 	var err error
 	if e.config.Indent {
-		result, err = json.MarshalIndent(val, "", "  ")
+		result, err = codec.MarshalIndent(val, "", "  ")
 	} else {
-		result, err = json.Marshal(val)
+		result, err = codec.Marshal(val)
 	}
 
 	if err != nil {
@@ -0,0 +1,9 @@
+package msgpack
+
+// Config is the configuration for this serializer
+type Config struct {
+	// UseJSONTag names the fields after their json tag, if they have no msgpack tag
+	UseJSONTag bool
+	// UseCompactInts encodes the integers in the fewest bytes possible
+	UseCompactInts bool
+}
@@ -0,0 +1,59 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "application/msgpack"
+)
+
+// Serializer the serializer which renders a MessagePack 'object'
+type Serializer struct {
+	config Config
+}
+
+// New returns a new msgpack serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	return &Serializer{config: c}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := e.SerializeTo(buf, val, options...)
+	return buf.Bytes(), err
+}
+
+// SerializeError returns the representation of an error, its status, name, title and summary in "error"
+// implements the serializer.ErrorSerializer interface
+func (e *Serializer) SerializeError(status int, name, title, summary string) ([]byte, error) {
+	return e.Serialize(map[string]interface{}{
+		"error": map[string]interface{}{"status": status, "name": name, "title": title, "summary": summary},
+	})
+}
+
+// SerializeTo writes the MessagePack representation of the 'object'
+// implements the serializer.StreamSerializer interface
+func (e *Serializer) SerializeTo(w io.Writer, val interface{}, options ...map[string]interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	if e.config.UseJSONTag {
+		enc.SetCustomStructTag("json")
+	}
+	enc.UseCompactInts(e.config.UseCompactInts)
+	return enc.Encode(val)
+}
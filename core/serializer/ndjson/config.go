@@ -0,0 +1,14 @@
+package ndjson
+
+import "github.com/kenorld/egret/core/serializer/json"
+
+// Config is the configuration for this serializer
+type Config struct {
+	// UnEscapeHTML keeps <, > and & as they are in the strings
+	UnEscapeHTML bool
+	// Codec encodes the items, json.DefaultCodec if nil
+	Codec json.Codec
+	// FlushItems the number of items of a stream after which they are flushed to the client,
+	// stream.DefaultFlushItems by default. A negative value flushes them at the end only
+	FlushItems int
+}
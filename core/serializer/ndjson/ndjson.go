@@ -0,0 +1,71 @@
+package ndjson
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/stream"
+)
+
+const (
+	// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+	ContentType = "application/x-ndjson"
+)
+
+// Serializer the serializer which renders each item of a collection as a line of JSON,
+// see stream.Each for the collections accepted
+type Serializer struct {
+	config Config
+}
+
+// New returns a new ndjson serializer
+func New(cfg ...Config) *Serializer {
+	c := Config{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.FlushItems == 0 {
+		c.FlushItems = stream.DefaultFlushItems
+	}
+	return &Serializer{config: c}
+}
+
+// ContentType the custom key for the serializer, when used inside egret, Q web frameworks or simply net/http
+func (e *Serializer) ContentType() string {
+	return ContentType
+}
+
+// Serialize accepts the 'object' value and converts it to bytes in order to be 'renderable'
+// implements the go-serializer.Serializer interface
+func (e *Serializer) Serialize(val interface{}, options ...map[string]interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := e.SerializeTo(buf, val, options...)
+	return buf.Bytes(), err
+}
+
+// SerializeTo writes the lines of the items as they are produced, flushing them every FlushItems
+// items of a stream, if w is an http.Flusher
+// implements the serializer.StreamSerializer interface
+func (e *Serializer) SerializeTo(w io.Writer, val interface{}, options ...map[string]interface{}) error {
+	codec := e.config.Codec
+	if codec == nil {
+		codec = json.DefaultCodec
+	}
+	enc := codec.NewEncoder(w)
+	enc.SetEscapeHTML(!e.config.UnEscapeHTML)
+	items, flushItems := 0, 0
+	if stream.IsStream(val) {
+		flushItems = e.config.FlushItems
+	}
+	return stream.Each(val, func(item interface{}) error {
+		// Encode ends each item with a new line
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		if items++; flushItems > 0 && items%flushItems == 0 {
+			stream.Flush(w)
+		}
+		return nil
+	})
+}
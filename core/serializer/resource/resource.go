@@ -0,0 +1,453 @@
+// Package resource describes the resources rendered by the hypermedia serializers, jsonapi and hal,
+// by the resource tags of their fields: the id field gives the type of the resource, and the name of
+// the route of its self link, the relations tag the fields holding other resources:
+//
+//      type Article struct {
+//          ID       int       `json:"id" resource:"id,articles" route:"article"`
+//          Title    string    `json:"title"`
+//          Author   *People   `json:"author" resource:"rel" route:"article_author"`
+//          Comments []Comment `json:"comments" resource:"rel"`
+//      }
+//
+// The routes are reversed by the LinkFunc of the serializers with the id of the resource as "id",
+// the route of a relation giving its related link. The other json fields are the attributes of the
+// resource. The fields of the embedded structs are attributes, they aren't looked into.
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	ejson "github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/shape"
+	"github.com/kenorld/egret/core/serializer/stream"
+)
+
+// LinkFunc returns the URL of a named route, given its params, e.g. egret.ReverseURL
+type LinkFunc func(route string, params map[string]interface{}) (string, error)
+
+// Resource is a resource found in a serialized object
+type Resource struct {
+	Type string
+	ID   string
+	// IDName the json name of the id field
+	IDName string
+	// Attributes the json fields of the resource, but its relations
+	Attributes map[string]json.RawMessage
+	// Self the self link of the resource, empty without route or LinkFunc
+	Self string
+
+	value reflect.Value
+	info  *typeInfo
+}
+
+// Key identifies the resource among the resources of a document
+func (r *Resource) Key() string {
+	return r.Type + "/" + r.ID
+}
+
+// Identifier identifies a resource by its type and id
+type Identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Relation is a relation of a resource, to one or many resources
+type Relation struct {
+	Name string
+	Many bool
+	// Resources the related resources, none for an empty to-one relation
+	Resources []*Resource
+	// Related the related link of the relation, empty without route or LinkFunc
+	Related string
+}
+
+// Page is a page of a collection, rendered along with the links of the pages around it,
+// the route being reversed with Params and the page number and size added to its query:
+//
+//      resource.Page{Items: articles, Number: 2, Size: 20, Total: count, Route: "articles"}
+type Page struct {
+	Items interface{}
+	// Number the number of the page, from 1
+	Number int
+	Size   int
+	// Total the number of items of the collection, 0 if unknown, the next link being then
+	// given while the pages are full
+	Total  int
+	Route  string
+	Params map[string]interface{}
+}
+
+// Builder builds the resources of the serialized objects
+type Builder struct {
+	// Codec marshals the attributes, json.DefaultCodec if nil
+	Codec ejson.Codec
+	// Link builds the links, none are if nil
+	Link LinkFunc
+	// Shaper shapes the values before their attributes are marshaled, e.g. to a sparse fieldset,
+	// their id and relations being read from the values themselves
+	Shaper *shape.Shaper
+}
+
+// Resource returns the resource of val, a struct or a pointer to a struct with an id field,
+// nil if val isn't a resource
+func (b Builder) Resource(val interface{}) (*Resource, error) {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	info := typeInfoOf(v.Type())
+	if info == nil {
+		return nil, nil
+	}
+
+	codec := b.Codec
+	if codec == nil {
+		codec = ejson.DefaultCodec
+	}
+	attributes := v.Interface()
+	if b.Shaper != nil {
+		attributes = b.Shaper.Shape(attributes)
+	}
+	data, err := codec.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	r := &Resource{Type: info.typ, ID: ID(v.Field(info.id)), IDName: info.idName, value: v, info: info}
+	if err := codec.NewDecoder(bytes.NewReader(data)).Decode(&r.Attributes); err != nil {
+		return nil, fmt.Errorf("resource: %s isn't marshaled as an object: %v", v.Type(), err)
+	}
+	for _, rel := range info.relations {
+		delete(r.Attributes, rel.name)
+	}
+	if r.Self, err = b.link(info.route, map[string]interface{}{"id": r.ID}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Relations returns the relations of r, in the order of their fields
+func (b Builder) Relations(r *Resource) ([]*Relation, error) {
+	// the shaper selects the attributes of the resources given, the related ones are whole
+	b.Shaper = nil
+	relations := make([]*Relation, 0, len(r.info.relations))
+	for _, info := range r.info.relations {
+		rel := &Relation{Name: info.name, Many: info.many}
+		var err error
+		if rel.Related, err = b.link(info.route, map[string]interface{}{"id": r.ID}); err != nil {
+			return nil, err
+		}
+		if err := stream.Each(r.value.Field(info.index).Interface(), func(item interface{}) error {
+			related, err := b.Resource(item)
+			if related != nil {
+				rel.Resources = append(rel.Resources, related)
+			}
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		relations = append(relations, rel)
+	}
+	return relations, nil
+}
+
+// Included returns the resources of the relations of resources selected by include,
+// e.g. the ones of "author,comments.author", but the resources given, each one once
+func (b Builder) Included(resources []*Resource, include shape.Fields) ([]*Resource, error) {
+	seen := map[string]bool{}
+	for _, r := range resources {
+		seen[r.Key()] = true
+	}
+	var included []*Resource
+	var walk func([]*Resource, shape.Fields) error
+	walk = func(resources []*Resource, include shape.Fields) error {
+		for _, r := range resources {
+			relations, err := b.Relations(r)
+			if err != nil {
+				return err
+			}
+			for _, rel := range relations {
+				sub, ok := include[rel.Name]
+				if !ok {
+					continue
+				}
+				for _, related := range rel.Resources {
+					if !seen[related.Key()] {
+						seen[related.Key()] = true
+						included = append(included, related)
+					}
+				}
+				if err := walk(rel.Resources, sub); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(resources, include)
+	return included, err
+}
+
+// Include returns the relations to include given by the "include" option,
+// as a string, e.g. "author,comments.author", or a shape.Fields
+func Include(options ...map[string]interface{}) shape.Fields {
+	if len(options) == 0 {
+		return nil
+	}
+	switch include := options[0]["include"].(type) {
+	case string:
+		return shape.ParseFields(include)
+	case shape.Fields:
+		return include
+	}
+	return nil
+}
+
+// PageLinks returns the self, first, prev, next and last links of a page,
+// its number and size being given by the numberParam and sizeParam query parameters
+func (b Builder) PageLinks(page Page, count int, numberParam string, sizeParam string) (map[string]string, error) {
+	if b.Link == nil || page.Route == "" {
+		return nil, nil
+	}
+	base, err := b.Link(page.Route, page.Params)
+	if err != nil {
+		return nil, err
+	}
+	href := func(number int) string {
+		query := url.Values{}
+		query.Set(numberParam, strconv.Itoa(number))
+		if page.Size > 0 {
+			query.Set(sizeParam, strconv.Itoa(page.Size))
+		}
+		sep := "?"
+		if strings.Contains(base, "?") {
+			sep = "&"
+		}
+		return base + sep + query.Encode()
+	}
+
+	number := page.Number
+	if number < 1 {
+		number = 1
+	}
+	links := map[string]string{"self": href(number), "first": href(1)}
+	if number > 1 {
+		links["prev"] = href(number - 1)
+	}
+	if page.Total > 0 && page.Size > 0 {
+		last := (page.Total + page.Size - 1) / page.Size
+		links["last"] = href(last)
+		if number < last {
+			links["next"] = href(number + 1)
+		}
+	} else if page.Size > 0 && count >= page.Size {
+		links["next"] = href(number + 1)
+	}
+	return links, nil
+}
+
+func (b Builder) link(route string, params map[string]interface{}) (string, error) {
+	if b.Link == nil || route == "" {
+		return "", nil
+	}
+	return b.Link(route, params)
+}
+
+// Decode sets the resource v points to from its identifier, its json attributes and the identifiers
+// of its relations, the related resources being set with their id only
+func (b Builder) Decode(v interface{}, id Identifier, attributes []byte, relations map[string][]Identifier) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("resource: can't decode into %T", v)
+	}
+	rv = rv.Elem()
+	info := typeInfoOf(rv.Type())
+	if info == nil {
+		return fmt.Errorf("resource: %s isn't a resource", rv.Type())
+	}
+	if id.Type != "" && id.Type != info.typ {
+		return fmt.Errorf("resource: type %q doesn't match %q", id.Type, info.typ)
+	}
+
+	if len(attributes) > 0 {
+		codec := b.Codec
+		if codec == nil {
+			codec = ejson.DefaultCodec
+		}
+		if err := codec.NewDecoder(bytes.NewReader(attributes)).Decode(v); err != nil {
+			return fmt.Errorf("resource: attributes: %v", err)
+		}
+	}
+	if id.ID != "" {
+		if err := SetID(rv.Field(info.id), id.ID); err != nil {
+			return err
+		}
+	}
+	for _, rel := range info.relations {
+		ids, ok := relations[rel.name]
+		if !ok {
+			continue
+		}
+		field := rv.Field(rel.index)
+		if !rel.many {
+			if len(ids) == 0 {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			related, err := newRelated(field.Type(), ids[0])
+			if err != nil {
+				return err
+			}
+			field.Set(related)
+			continue
+		}
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("resource: can't decode the relation %s into %s", rel.name, field.Type())
+		}
+		items := reflect.MakeSlice(field.Type(), len(ids), len(ids))
+		for i, id := range ids {
+			related, err := newRelated(field.Type().Elem(), id)
+			if err != nil {
+				return err
+			}
+			items.Index(i).Set(related)
+		}
+		field.Set(items)
+	}
+	return nil
+}
+
+// newRelated returns a resource of type t, or a pointer to it, with the given id
+func newRelated(t reflect.Type, id Identifier) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		related, err := newRelated(t.Elem(), id)
+		if err != nil {
+			return related, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(related)
+		return p, nil
+	}
+	info := typeInfoOf(t)
+	if info == nil {
+		return reflect.Value{}, fmt.Errorf("resource: %s isn't a resource", t)
+	}
+	if id.Type != "" && id.Type != info.typ {
+		return reflect.Value{}, fmt.Errorf("resource: type %q doesn't match %q", id.Type, info.typ)
+	}
+	related := reflect.New(t).Elem()
+	return related, SetID(related.Field(info.id), id.ID)
+}
+
+// ID returns the id of a resource, given by its id field
+func ID(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// SetID sets the id field of a resource, v being addressable
+func SetID(v reflect.Value, id string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(id)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("resource: invalid id %q", id)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("resource: invalid id %q", id)
+		}
+		v.SetUint(n)
+		return nil
+	}
+	return fmt.Errorf("resource: can't set an id of type %s", v.Type())
+}
+
+// typeInfo the resource fields of a struct
+type typeInfo struct {
+	typ    string
+	route  string
+	id     int
+	idName string
+	// relations the relations, by field index
+	relations []relationInfo
+}
+
+type relationInfo struct {
+	index int
+	name  string
+	route string
+	many  bool
+}
+
+var typeInfos sync.Map
+
+// typeInfoOf returns the resource fields of t, nil if t isn't a resource
+func typeInfoOf(t reflect.Type) *typeInfo {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if info, ok := typeInfos.Load(t); ok {
+		return info.(*typeInfo)
+	}
+
+	var info *typeInfo
+	var relations []relationInfo
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("resource")
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		switch strings.TrimSpace(parts[0]) {
+		case "id":
+			info = &typeInfo{id: i, idName: jsonName(field), route: field.Tag.Get("route")}
+			if len(parts) > 1 {
+				info.typ = strings.TrimSpace(parts[1])
+			}
+			if info.typ == "" {
+				info.typ = strings.ToLower(t.Name())
+			}
+		case "rel":
+			kind := field.Type.Kind()
+			relations = append(relations, relationInfo{index: i, name: jsonName(field), route: field.Tag.Get("route"),
+				many: kind == reflect.Slice || kind == reflect.Array})
+		}
+	}
+	if info != nil {
+		info.relations = relations
+	}
+	typeInfos.Store(t, info)
+	return info
+}
+
+// jsonName returns the json name of a field, else its name
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
@@ -1,7 +1,7 @@
 // Package serializer helps GoLang Developers to serialize any custom type to []byte or string.
 // Your custom serializers are finally, organised.
 //
-// Built'n supported serializers: JSON, JSONP, XML,, Text, Binary Data.
+// Built'n supported serializers: JSON, JSONP, XML,, Text, Binary Data, NDJSON, CSV, MessagePack, CBOR, JSON:API, HAL.
 //
 // This package is already used by Iris & Q Web Frameworks.
 package serializer
@@ -9,12 +9,22 @@ package serializer
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 
+	"github.com/kenorld/egret/core/serializer/cbor"
+	"github.com/kenorld/egret/core/serializer/csv"
 	"github.com/kenorld/egret/core/serializer/data"
+	"github.com/kenorld/egret/core/serializer/hal"
 	"github.com/kenorld/egret/core/serializer/json"
+	"github.com/kenorld/egret/core/serializer/jsonapi"
 	"github.com/kenorld/egret/core/serializer/jsonp"
+	"github.com/kenorld/egret/core/serializer/msgpack"
+	"github.com/kenorld/egret/core/serializer/ndjson"
+	"github.com/kenorld/egret/core/serializer/resource"
+	"github.com/kenorld/egret/core/serializer/shape"
+	"github.com/kenorld/egret/core/serializer/stream"
 	"github.com/kenorld/egret/core/serializer/text"
 	"github.com/kenorld/egret/core/serializer/xml"
 )
@@ -26,6 +36,33 @@ type (
 		// Serialize accepts an object with serialization options and returns its bytes representation
 		Serialize(interface{}, ...map[string]interface{}) ([]byte, error)
 	}
+	// StreamSerializer is implemented by the serializers which write an object as it is serialized,
+	// without building its whole representation in memory, e.g. the items of a channel or a stream.Iterator
+	StreamSerializer interface {
+		Serializer
+		// SerializeTo accepts an object with serialization options and writes its bytes representation to the writer
+		SerializeTo(io.Writer, interface{}, ...map[string]interface{}) error
+	}
+	// ShapingSerializer is implemented by the serializers shaping the objects themselves, e.g. the
+	// hypermedia ones reading the resources of the original objects, the Manager leaving them as they are
+	ShapingSerializer interface {
+		Serializer
+		ShapesObjects()
+	}
+	// ErrorSerializer is implemented by the serializers with their own representation of the errors,
+	// e.g. the errors documents of JSON:API, rendered instead of the error pages of the formats without templates
+	ErrorSerializer interface {
+		Serializer
+		// SerializeError returns the bytes representation of the error with an HTTP status, a name, a title and a summary
+		SerializeError(status int, name, title, summary string) ([]byte, error)
+	}
+	// Deserializer is implemented by the serializers which also read their representation,
+	// e.g. the JSON:API one reading the resource object of a request document
+	Deserializer interface {
+		Serializer
+		// Deserialize sets the object v points to from its bytes representation
+		Deserialize(data []byte, v interface{}) error
+	}
 	// SerializeFunc is the alternative way to implement a Serializer using a simple function
 	SerializeFunc func(interface{}, ...map[string]interface{}) ([]byte, error)
 )
@@ -39,6 +76,7 @@ func (s SerializeFunc) Serialize(obj interface{}, options ...map[string]interfac
 // this exists because almost all package's users will use kataras/go-template with kataras/go-serializer
 // in one method, so we need something to tell if the 'renderer' wants to render a
 // serializer's result or the template's result, you don't have to worry about these things.
+// The content types, e.g. "application/vnd.api+json", may contain it.
 const NotAllowedKeyChar = '.'
 
 // Manager is optionally, used when your app needs to manage more than one serializer
@@ -58,7 +96,7 @@ func (s Manager) For(key string, serializer ...Serializer) {
 		s = make(map[string][]Serializer)
 	}
 
-	if strings.IndexByte(key, NotAllowedKeyChar) != -1 {
+	if strings.IndexByte(key, NotAllowedKeyChar) != -1 && strings.IndexByte(key, '/') == -1 {
 		return
 	}
 
@@ -76,10 +114,10 @@ var (
 
 var (
 	once               sync.Once
-	defaultManagerKeys = [...]string{json.ContentType, jsonp.ContentType, xml.ContentType, text.ContentType, data.ContentType}
+	defaultManagerKeys = [...]string{json.ContentType, jsonp.ContentType, xml.ContentType, text.ContentType, data.ContentType, ndjson.ContentType, csv.ContentType, msgpack.ContentType, cbor.ContentType, jsonapi.ContentType, hal.ContentType}
 )
 
-// RegisterDefaults register defaults serializer for each of the default serializer keys (data,json,jsonp,text,xml)
+// RegisterDefaults register defaults serializer for each of the default serializer keys (data,json,jsonp,text,xml,ndjson,csv,msgpack,cbor,jsonapi,hal)
 func RegisterDefaults(serializers *Manager) {
 	for _, ctype := range defaultManagerKeys {
 
@@ -96,12 +134,71 @@ func RegisterDefaults(serializers *Manager) {
 				serializers.For(ctype, text.New())
 			case data.ContentType:
 				serializers.For(ctype, data.New())
+			case ndjson.ContentType:
+				serializers.For(ctype, ndjson.New())
+			case csv.ContentType:
+				serializers.For(ctype, csv.New())
+			case msgpack.ContentType:
+				serializers.For(ctype, msgpack.New())
+			case cbor.ContentType:
+				serializers.For(ctype, cbor.New())
+			case jsonapi.ContentType:
+				serializers.For(ctype, jsonapi.New())
+			case hal.ContentType:
+				serializers.For(ctype, hal.New())
 			}
 		}
 	}
 }
 
-// Serialize returns the result as bytes representation of the serializer(s)
+// Shape returns the object with the fields selected by the options, see package shape:
+// "fields" a sparse fieldset, as a string or a shape.Fields, "view" the view of the fields,
+// and "omit" a func(reflect.StructField) bool returning true for the fields to omit.
+// The items of a stream are shaped as they are produced, the ones of a resource.Page as well
+func Shape(obj interface{}, options map[string]interface{}) interface{} {
+	o := shape.OptionsOf(options)
+	if o.IsZero() {
+		return obj
+	}
+
+	switch page := obj.(type) {
+	case resource.Page:
+		page.Items = Shape(page.Items, options)
+		return page
+	case *resource.Page:
+		shaped := *page
+		shaped.Items = Shape(page.Items, options)
+		return &shaped
+	}
+	shaper := shape.New(o)
+	if stream.IsStream(obj) {
+		return stream.Iterator(func(yield func(interface{}) error) error {
+			return stream.Each(obj, func(item interface{}) error {
+				return yield(shaper.Shape(item))
+			})
+		})
+	}
+	return shaper.Shape(obj)
+}
+
+// shapeFor returns the object to serialize by each serializer, the object shaped by the options,
+// once, but for the ShapingSerializers
+func shapeFor(obj interface{}, options map[string]interface{}) func(Serializer) interface{} {
+	var shaped interface{}
+	done := false
+	return func(s Serializer) interface{} {
+		if _, ok := s.(ShapingSerializer); ok {
+			return obj
+		}
+		if !done {
+			shaped, done = Shape(obj, options), true
+		}
+		return shaped
+	}
+}
+
+// Serialize returns the result as bytes representation of the serializer(s),
+// the object being shaped by the options first
 func (s Manager) Serialize(key string, obj interface{}, options map[string]interface{}) ([]byte, error) {
 	if key == "" {
 		return nil, errKeyMissing
@@ -109,15 +206,15 @@ func (s Manager) Serialize(key string, obj interface{}, options map[string]inter
 	if s == nil {
 		return nil, errManagerEmpty
 	}
-
 	serializers := s[key]
 	if serializers == nil {
 		return nil, fmt.Errorf("Serializer with key %s couldn't be found", key)
 	}
+	shaped := shapeFor(obj, options)
 	var finalResult []byte
 
 	for i, n := 0, len(serializers); i < n; i++ {
-		result, err := serializers[i].Serialize(obj, options)
+		result, err := serializers[i].Serialize(shaped(serializers[i]), options)
 		if err != nil {
 			return nil, err
 		}
@@ -126,6 +223,40 @@ func (s Manager) Serialize(key string, obj interface{}, options map[string]inter
 	return finalResult, nil
 }
 
+// SerializeTo writes the result of the serializer(s) to the writer, as it is serialized by the StreamSerializers,
+// the other ones being written once they returned their bytes representation.
+// The object is shaped by the options first
+func (s Manager) SerializeTo(w io.Writer, key string, obj interface{}, options map[string]interface{}) error {
+	if key == "" {
+		return errKeyMissing
+	}
+	if s == nil {
+		return errManagerEmpty
+	}
+	serializers := s[key]
+	if serializers == nil {
+		return fmt.Errorf("Serializer with key %s couldn't be found", key)
+	}
+	shaped := shapeFor(obj, options)
+
+	for i, n := 0, len(serializers); i < n; i++ {
+		if streamer, ok := serializers[i].(StreamSerializer); ok {
+			if err := streamer.SerializeTo(w, shaped(streamer), options); err != nil {
+				return err
+			}
+			continue
+		}
+		result, err := serializers[i].Serialize(shaped(serializers[i]), options)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // SerializeToString returns the string representation of the serializer(s)
 // same as Serialize but returns string
 func (s Manager) SerializeToString(key string, obj interface{}, options map[string]interface{}) (string, error) {
@@ -137,6 +268,26 @@ func (s Manager) SerializeToString(key string, obj interface{}, options map[stri
 	return string(result), nil
 }
 
+// ErrorSerializer returns the first serializer of the key which is an ErrorSerializer, nil if none is
+func (s Manager) ErrorSerializer(key string) ErrorSerializer {
+	for _, serializer := range s[key] {
+		if es, ok := serializer.(ErrorSerializer); ok {
+			return es
+		}
+	}
+	return nil
+}
+
+// Deserializer returns the first serializer of the key which is a Deserializer, nil if none is
+func (s Manager) Deserializer(key string) Deserializer {
+	for _, serializer := range s[key] {
+		if d, ok := serializer.(Deserializer); ok {
+			return d
+		}
+	}
+	return nil
+}
+
 // Len returns the length of the serializers map
 func (s Manager) Len() int {
 	if s == nil {
@@ -0,0 +1,458 @@
+// Package shape selects the fields of an object before it is serialized: the fields of a sparse fieldset,
+// e.g. "id,hotel.name", of a view named by the view tag of the fields, and the fields not omitted by a func.
+//
+// The shaped object is a copy of the selected fields into structs built with reflect.StructOf, with
+// the same field names and tags, and the same embedded structs, so every serializer handles it as
+// the original object:
+//
+//	type Booking struct {
+//	    ID     int     `json:"id"`
+//	    Hotel  Hotel   `json:"hotel"`
+//	    Price  float64 `json:"price" view:"admin,owner"`
+//	}
+//
+//	shape.New(shape.Options{Fields: shape.ParseFields("id,hotel.name"), View: "owner"}).Shape(booking)
+//
+// A field without view tag belongs to every view. Fields are selected by their json name, else their name.
+// Types marshaling themselves, e.g. time.Time, and recursive types past their first level are kept as is.
+package shape
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fields is a sparse fieldset, each field mapping to the fields selected in its value, nil for all of them
+type Fields map[string]Fields
+
+// Options selects the fields of the shaped objects
+type Options struct {
+	// Fields the fields selected, all of them if nil
+	Fields Fields
+	// View the view of the fields selected, all of them if empty
+	View string
+	// Omit returns true for the fields to omit, e.g. the ones the current user may not see
+	Omit func(field reflect.StructField) bool
+}
+
+// IsZero returns true if the options select all the fields
+func (o Options) IsZero() bool {
+	return o.Fields == nil && o.View == "" && o.Omit == nil
+}
+
+// OptionsOf returns the options given by the serialization options: "fields" a sparse fieldset, as a
+// string or a Fields, "view" the view of the fields, and "omit" a func(reflect.StructField) bool
+func OptionsOf(options map[string]interface{}) Options {
+	var o Options
+	switch fields := options["fields"].(type) {
+	case string:
+		o.Fields = ParseFields(fields)
+	case Fields:
+		o.Fields = fields
+	}
+	o.View, _ = options["view"].(string)
+	o.Omit, _ = options["omit"].(func(reflect.StructField) bool)
+	return o
+}
+
+// ParseFields parses a sparse fieldset, the comma-separated paths of the fields, e.g. "id,hotel.name"
+func ParseFields(s string) Fields {
+	var fields Fields
+	for _, path := range strings.Split(s, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if fields == nil {
+			fields = Fields{}
+		}
+		current := fields
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			sub, ok := current[name]
+			if ok && sub == nil {
+				// the whole field is already selected
+				break
+			}
+			if i == len(names)-1 {
+				current[name] = nil
+				break
+			}
+			if sub == nil {
+				sub = Fields{}
+				current[name] = sub
+			}
+			current = sub
+		}
+	}
+	return fields
+}
+
+// String returns the canonical form of the fieldset, its paths sorted, e.g. "hotel.name,id"
+func (f Fields) String() string {
+	var paths []string
+	for name, sub := range f {
+		if sub == nil {
+			paths = append(paths, name)
+			continue
+		}
+		for _, path := range strings.Split(sub.String(), ",") {
+			paths = append(paths, name+"."+path)
+		}
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+// maxPlans caps the plans cached by fieldset, each fieldset of a type having its own shaped type
+const maxPlans = 1024
+
+// planKey is the key of a plan in the caches, the fieldset being in its canonical form
+type planKey struct {
+	typ          reflect.Type
+	fields, view string
+}
+
+var (
+	plansMu sync.Mutex
+	plans   = map[planKey]*plan{}
+)
+
+// Shaper shapes objects, caching the shaped types of their structs
+type Shaper struct {
+	options Options
+	plans   map[planKey]*plan
+}
+
+// New returns a Shaper with the given options
+func New(options Options) *Shaper {
+	return &Shaper{options: options, plans: map[planKey]*plan{}}
+}
+
+// Shape returns a copy of val with the selected fields only
+func (s *Shaper) Shape(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	p := s.rootPlan(reflect.TypeOf(val), s.options.Fields)
+	if p.same {
+		return val
+	}
+	return s.value(reflect.ValueOf(val), p).Interface()
+}
+
+// rootPlan returns the plan of the values of t, cached by the shaper, and by the package unless
+// the options omit fields with a func
+func (s *Shaper) rootPlan(t reflect.Type, selected Fields) *plan {
+	key := planKey{typ: t, fields: selected.String(), view: s.options.View}
+	if selected == nil {
+		// no fieldset, unlike an empty one
+		key.fields = "*"
+	}
+	if p, ok := s.plans[key]; ok {
+		return p
+	}
+	shared := s.options.Omit == nil
+	if shared {
+		plansMu.Lock()
+		p, ok := plans[key]
+		plansMu.Unlock()
+		if ok {
+			s.plans[key] = p
+			return p
+		}
+	}
+	p := s.plan(t, selected, true, map[reflect.Type]bool{})
+	s.plans[key] = p
+	if shared {
+		plansMu.Lock()
+		if len(plans) < maxPlans {
+			plans[key] = p
+		}
+		plansMu.Unlock()
+	}
+	return p
+}
+
+// plan how to shape the values of a type
+type plan struct {
+	typ reflect.Type
+	// same the values are kept as is
+	same bool
+	// elem the plan of the elements of a pointer, slice, array or map
+	elem *plan
+	// fields the fields of a struct
+	fields []fieldPlan
+	// selected the fields selected in the dynamic value of an interface, or in a record
+	selected Fields
+	record   bool
+}
+
+type fieldPlan struct {
+	index int
+	plan  *plan
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	xmlMarshaler  = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	xmlNameType   = reflect.TypeOf(xml.Name{})
+)
+
+func marshals(t reflect.Type) bool {
+	for _, m := range []reflect.Type{jsonMarshaler, xmlMarshaler, textMarshaler} {
+		if t.Implements(m) || reflect.PtrTo(t).Implements(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// plan returns the plan of t, the root structs being named for encoding/xml. The types being planned
+// are kept as is when found again, reflect.StructOf can't build recursive types
+func (s *Shaper) plan(t reflect.Type, selected Fields, root bool, planning map[reflect.Type]bool) *plan {
+	switch t.Kind() {
+	case reflect.Interface:
+		return &plan{typ: t, selected: selected}
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		if t.Kind() == reflect.Map && t.Key().Kind() != reflect.String {
+			break
+		}
+		if t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Interface && selected != nil {
+			// a record, e.g. a map[string]interface{}, the fields of which are its keys
+			return &plan{typ: t, selected: selected, record: true}
+		}
+		elem := s.plan(t.Elem(), selected, root && t.Kind() != reflect.Map, planning)
+		if elem.same {
+			break
+		}
+		p := &plan{elem: elem}
+		switch t.Kind() {
+		case reflect.Ptr:
+			p.typ = reflect.PtrTo(elem.typ)
+		case reflect.Slice:
+			p.typ = reflect.SliceOf(elem.typ)
+		case reflect.Array:
+			p.typ = reflect.ArrayOf(t.Len(), elem.typ)
+		case reflect.Map:
+			p.typ = reflect.MapOf(t.Key(), elem.typ)
+		}
+		return p
+	case reflect.Struct:
+		if marshals(t) || planning[t] {
+			break
+		}
+		planning[t] = true
+		defer delete(planning, t)
+
+		p, fields := s.structPlan(t, selected, map[string]bool{}, planning)
+		hasXMLName := false
+		for _, field := range fields {
+			hasXMLName = hasXMLName || field.Name == "XMLName"
+		}
+		if root && !hasXMLName && t.Name() != "" {
+			// encoding/xml names the root elements after their type, the shaped types have no name
+			p.fields = append(p.fields, fieldPlan{})
+			fields = append(fields, reflect.StructField{Name: "XMLName", Type: xmlNameType,
+				Tag: reflect.StructTag(`xml:"` + t.Name() + `" json:"-" msgpack:"-" cbor:"-" csv:"-"`)})
+		}
+		p.typ = reflect.StructOf(fields)
+		return p
+	}
+	return &plan{typ: t, same: true}
+}
+
+// structPlan returns the plan of the selected fields of struct t, and the fields of its shaped type.
+// The embedded structs stay embedded, with their selected fields, so that the serializers promote
+// their fields as they do the ones of t. names holds the names of the fields shadowing the ones of t
+func (s *Shaper) structPlan(t reflect.Type, selected Fields, names map[string]bool, planning map[reflect.Type]bool) (*plan, []reflect.StructField) {
+	// the fields of t shadow the ones of its embedded structs
+	inner := make(map[string]bool, len(names)+t.NumField())
+	for name := range names {
+		inner[name] = true
+	}
+	goNames := map[string]bool{}
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if field := t.Field(i); !embedded(field) {
+			inner[fieldName(field)] = true
+			goNames[field.Name] = true
+		}
+	}
+
+	p := &plan{}
+	var fields []reflect.StructField
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		if embedded(field) {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if planning[ft] {
+				continue
+			}
+			planning[ft] = true
+			ep, embeddedFields := s.structPlan(ft, selected, inner, planning)
+			delete(planning, ft)
+			if len(embeddedFields) == 0 {
+				continue
+			}
+			ep.typ = reflect.StructOf(embeddedFields)
+			if field.Type.Kind() == reflect.Ptr {
+				ep = &plan{typ: reflect.PtrTo(ep.typ), elem: ep}
+			}
+			p.fields = append(p.fields, fieldPlan{index: i, plan: ep})
+			// the shaped fields are exported, the name of an embedded field being unused by the serializers
+			fields = append(fields, reflect.StructField{Name: embeddedName(field.Name, goNames), Type: ep.typ, Tag: field.Tag, Anonymous: true})
+			continue
+		}
+		name := fieldName(field)
+		if field.PkgPath != "" || names[name] {
+			continue
+		}
+
+		var sub Fields
+		if selected != nil && field.Name != "XMLName" {
+			var ok bool
+			if sub, ok = lookup(selected, name, field.Name); !ok {
+				continue
+			}
+		}
+		if !s.inView(field) || (s.options.Omit != nil && s.options.Omit(field)) {
+			continue
+		}
+		fp := s.plan(field.Type, sub, false, planning)
+		p.fields = append(p.fields, fieldPlan{index: i, plan: fp})
+		fields = append(fields, reflect.StructField{Name: field.Name, Type: fp.typ, Tag: field.Tag})
+	}
+	for name := range inner {
+		names[name] = true
+	}
+	return p, fields
+}
+
+// embeddedName returns an exported name for an embedded field, unique among names
+func embeddedName(name string, names map[string]bool) string {
+	result := strings.ToUpper(name[:1]) + name[1:]
+	for i := 2; names[result]; i++ {
+		result = strings.ToUpper(name[:1]) + name[1:] + strconv.Itoa(i)
+	}
+	names[result] = true
+	return result
+}
+
+// embedded returns true for the embedded structs, the fields of which are promoted
+func embedded(field reflect.StructField) bool {
+	ft := field.Type
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	return field.Anonymous && ft.Kind() == reflect.Struct && field.Tag.Get("json") == ""
+}
+
+func (s *Shaper) inView(field reflect.StructField) bool {
+	views, ok := field.Tag.Lookup("view")
+	if !ok || s.options.View == "" {
+		return true
+	}
+	for _, view := range strings.Split(views, ",") {
+		if strings.TrimSpace(view) == s.options.View {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName returns the json name of a field, else its name
+func fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+func lookup(selected Fields, name string, goName string) (Fields, bool) {
+	if sub, ok := selected[name]; ok {
+		return sub, true
+	}
+	for key, sub := range selected {
+		if strings.EqualFold(key, goName) {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// value returns the shaped copy of v
+func (s *Shaper) value(v reflect.Value, p *plan) reflect.Value {
+	if p.same {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		elem := v.Elem()
+		shaped := s.value(elem, s.rootPlan(elem.Type(), p.selected))
+		result := reflect.New(p.typ).Elem()
+		result.Set(shaped)
+		return result
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(p.typ)
+		}
+		result := reflect.New(p.elem.typ)
+		result.Elem().Set(s.value(v.Elem(), p.elem))
+		return result
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(p.typ)
+		}
+		result := reflect.MakeSlice(p.typ, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(s.value(v.Index(i), p.elem))
+		}
+		return result
+	case reflect.Array:
+		result := reflect.New(p.typ).Elem()
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(s.value(v.Index(i), p.elem))
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(p.typ)
+		}
+		result := reflect.MakeMapWithSize(p.typ, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if !p.record {
+				result.SetMapIndex(iter.Key(), s.value(iter.Value(), p.elem))
+				continue
+			}
+			if sub, ok := lookup(p.selected, iter.Key().String(), iter.Key().String()); ok {
+				result.SetMapIndex(iter.Key(), s.value(iter.Value(), &plan{typ: p.typ.Elem(), selected: sub}))
+			}
+		}
+		return result
+	case reflect.Struct:
+		result := reflect.New(p.typ).Elem()
+		for i, fp := range p.fields {
+			if fp.plan == nil {
+				// the XMLName added to a root struct
+				continue
+			}
+			result.Field(i).Set(s.value(v.Field(fp.index), fp.plan))
+		}
+		return result
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package shape
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testHotel struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Address string    `json:"address" view:"admin"`
+	Opened  time.Time `json:"opened"`
+}
+
+type testAudit struct {
+	CreatedBy string `json:"created_by" role:"admin"`
+}
+
+type testBooking struct {
+	testAudit
+	ID     int                    `json:"id"`
+	Hotel  *testHotel             `json:"hotel"`
+	Hotels []testHotel            `json:"hotels,omitempty"`
+	Price  float64                `json:"price" view:"admin,owner"`
+	Extra  map[string]interface{} `json:"extra,omitempty"`
+	notes  string
+}
+
+type testTree struct {
+	Name     string      `json:"name"`
+	Children []*testTree `json:"children,omitempty"`
+}
+
+func TestParseFields(t *testing.T) {
+	expected := Fields{"id": nil, "hotel": Fields{"name": nil, "address": nil}, "price": nil}
+	if actual := ParseFields("id, hotel.name,hotel.address,price,price.currency,"); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	if ParseFields("") != nil {
+		t.Error("Expected no fieldset")
+	}
+}
+
+func TestShape(t *testing.T) {
+	opened := time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)
+	booking := testBooking{
+		testAudit: testAudit{"bob"},
+		ID:        1,
+		Hotel:     &testHotel{2, "Hilton", "Paris", opened},
+		Price:     99.5,
+		Extra:     map[string]interface{}{"vip": true, "notes": "late", "room": map[string]interface{}{"floor": 3, "view": "sea"}},
+		notes:     "private",
+	}
+	omitAdmin := func(field reflect.StructField) bool { return field.Tag.Get("role") == "admin" }
+
+	tests := []struct {
+		options  Options
+		expected string
+	}{
+		{Options{Fields: ParseFields("id,hotel.name")}, `{"id":1,"hotel":{"name":"Hilton"}}`},
+		{Options{Fields: ParseFields("ID,Hotel.opened,created_by")}, `{"created_by":"bob","id":1,"hotel":{"opened":"2020-05-17T00:00:00Z"}}`},
+		{Options{Fields: ParseFields("extra.vip,extra.room.view")}, `{"extra":{"room":{"view":"sea"},"vip":true}}`},
+		{Options{View: "owner", Fields: ParseFields("id,hotel,price")}, `{"id":1,"hotel":{"id":2,"name":"Hilton","opened":"2020-05-17T00:00:00Z"},"price":99.5}`},
+		{Options{View: "public", Omit: omitAdmin}, `{"id":1,"hotel":{"id":2,"name":"Hilton","opened":"2020-05-17T00:00:00Z"},"extra":{"notes":"late","room":{"floor":3,"view":"sea"},"vip":true}}`},
+	}
+	for _, test := range tests {
+		actual, err := json.Marshal(New(test.options).Shape(booking))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("%+v:\nexpected %s\n     got %s", test.options, test.expected, actual)
+		}
+	}
+}
+
+func TestShapeCollections(t *testing.T) {
+	shaper := New(Options{Fields: ParseFields("name,children.name")})
+	tree := []*testTree{{Name: "a", Children: []*testTree{{Name: "b", Children: []*testTree{{Name: "c"}}}}}, nil}
+	actual, _ := json.Marshal(shaper.Shape(tree))
+	expected := `[{"name":"a","children":[{"name":"b","children":[{"name":"c"}]}]},null]`
+	if string(actual) != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+
+	if shaper.Shape("text") != "text" || shaper.Shape(nil) != nil {
+		t.Error("Expected the values without fields to be kept")
+	}
+
+	actual, err := xml.Marshal(New(Options{Fields: ParseFields("ID,Name")}).Shape([]testHotel{{ID: 1, Name: "Hilton"}}))
+	expected = `<testHotel><ID>1</ID><Name>Hilton</Name></testHotel>`
+	if err != nil || string(actual) != expected {
+		t.Errorf("Expected %s, got %s %v", expected, actual, err)
+	}
+}
+
+type testPerson struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+type testGuest struct {
+	Name string `json:"full_name"`
+	*testPerson
+}
+
+func TestShapeEmbeddedCollision(t *testing.T) {
+	guest := testGuest{Name: "a", testPerson: &testPerson{Name: "b", Age: 3}}
+	tests := map[string]string{
+		"":               `{"full_name":"a","name":"b","age":3}`,
+		"full_name,name": `{"full_name":"a","name":"b"}`,
+		"full_name":      `{"full_name":"a"}`,
+		"full_name,age":  `{"full_name":"a","age":3}`,
+	}
+	for fields, expected := range tests {
+		options := Options{Fields: ParseFields(fields), View: "public"}
+		actual, err := json.Marshal(New(options).Shape(guest))
+		if err != nil || string(actual) != expected {
+			t.Errorf("%q: expected %s, got %s %v", fields, expected, actual, err)
+		}
+	}
+
+	// the nil embedded structs are left out
+	actual, err := json.Marshal(New(Options{Fields: ParseFields("full_name,age")}).Shape(testGuest{Name: "a"}))
+	if expected := `{"full_name":"a"}`; err != nil || string(actual) != expected {
+		t.Errorf("Expected %s, got %s %v", expected, actual, err)
+	}
+}
+
+func TestFieldsString(t *testing.T) {
+	if actual := ParseFields("price, hotel.name,id,hotel.address").String(); actual != "hotel.address,hotel.name,id,price" {
+		t.Errorf("Expected the canonical fieldset, got %q", actual)
+	}
+}
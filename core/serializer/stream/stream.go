@@ -0,0 +1,86 @@
+// Package stream lets the serializers write the items of a collection one by one,
+// the collection being given as a channel or an iterator func instead of a slice.
+package stream
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// DefaultFlushItems the number of items of a stream after which the serializers flush them to
+// the client by default
+const DefaultFlushItems = 100
+
+// Flush sends the items written so far to the client, if w is an http.Flusher
+func Flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Iterator calls yield with each item of a collection, stopping at the first error it returns.
+// Unlike a channel, it doesn't leave a goroutine blocked when the client goes away:
+//
+//      stream.Iterator(func(yield func(interface{}) error) error {
+//          for rows.Next() {
+//              ...
+//              if err := yield(booking); err != nil {
+//                  return err
+//              }
+//          }
+//          return rows.Err()
+//      })
+type Iterator func(yield func(item interface{}) error) error
+
+// IsStream returns true if val is an Iterator or a channel, the items of which are produced
+// as they are serialized
+func IsStream(val interface{}) bool {
+	switch val.(type) {
+	case Iterator, func(func(interface{}) error) error:
+		return true
+	}
+	v := reflect.ValueOf(val)
+	return v.Kind() == reflect.Chan && v.Type().ChanDir()&reflect.RecvDir != 0
+}
+
+// Each calls fn with each item of val, given as an Iterator, a channel, a slice or an array,
+// else with val itself. The items of a channel are read until it is closed
+func Each(val interface{}, fn func(item interface{}) error) error {
+	switch iter := val.(type) {
+	case Iterator:
+		return iter(fn)
+	case func(func(interface{}) error) error:
+		return iter(fn)
+	}
+
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.RecvDir == 0 {
+			return fmt.Errorf("stream: can't receive from %s", v.Type())
+		}
+		for {
+			item, ok := v.Recv()
+			if !ok {
+				return nil
+			}
+			if err := fn(item.Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte is a single item
+			break
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := fn(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fn(val)
+}
@@ -2,7 +2,9 @@ package template
 
 import (
 	"errors"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 )
 
@@ -21,6 +23,8 @@ type (
 		// AssetFunc and NamesFunc used when files are distrubuted inside the app executable
 		AssetFunc func(name string) ([]byte, error)
 		NamesFunc func() []string
+		// FS the file system of the Directory when set by RegisterFS
+		FS fs.FS
 	}
 	// BinaryLoader optionally, called after TemplateLocation's Directory, used when files are distrubuted inside the app executable
 	// sets the AssetFunc and NamesFunc
@@ -52,6 +56,26 @@ func (t *Loader) Register(dir string, fileExtension string) *BinaryLoader {
 	return &BinaryLoader{Loader: t}
 }
 
+// RegisterFS sets the directory of fsys to load from, e.g. "views" of an embed.FS or "." of an fs.Sub,
+// the templates are distributed inside the app executable and loaded as by Binary
+func (t *Loader) RegisterFS(fsys fs.FS, dir string, fileExtension string) {
+	if dir == "" {
+		dir = "."
+	}
+	t.Register(dir, fileExtension).Binary(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}, func() (names []string) {
+		fs.WalkDir(fsys, path.Clean(filepath.ToSlash(dir)), func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				names = append(names, name)
+			}
+			return nil
+		})
+		return
+	})
+	t.FS = fsys
+}
+
 // Binary optionally, called after Loader.Directory, used when files are distrubuted inside the app executable
 // sets the AssetFunc and NamesFunc
 func (t *BinaryLoader) Binary(assetFunc func(name string) ([]byte, error), namesFunc func() []string) {
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/valyala/bytebufferpool"
 )
@@ -18,6 +20,10 @@ type (
 	Entry struct {
 		Loader   *Loader
 		Template Template
+
+		// names the index of the loaded templates, when the Template is a TemplateIndex
+		names map[string]struct{}
+		mu    sync.RWMutex
 	}
 
 	// Manager is an optional feature, used when you want to use multiple template engines
@@ -26,11 +32,6 @@ type (
 	// the registry finds the correct template engine and executes the template
 	// so you can use and render a template file by it's file extension
 	Manager struct {
-		// Reload reloads the template engine on each execute, used when the project is under development status
-		// if true the template will reflect the runtime template files changes
-		// defaults to false
-		// Reload bool
-
 		// Entries the template Templates with their loader
 		Entries Entries
 		// SharedFuncs funcs that will be shared all over the supported template engines
@@ -45,7 +46,41 @@ type (
 // Loader can be used without a mux because of this we have this type of function here which just pass itself's field into other itself's field
 // which, normally, is not a smart choice.
 func (entry *Entry) LoadTemplate() error {
-	return entry.Loader.LoadTemplate(entry.Template)
+	err := entry.Loader.LoadTemplate(entry.Template)
+	if index, ok := entry.Template.(TemplateIndex); ok {
+		names := make(map[string]struct{})
+		for _, name := range index.Names() {
+			names[name] = struct{}{}
+		}
+		entry.mu.Lock()
+		entry.names = names
+		entry.mu.Unlock()
+	}
+	return err
+}
+
+// Has returns true if the template file is loaded by the entry,
+// it looks for the file only if the Template isn't a TemplateIndex
+func (entry *Entry) Has(filename string) bool {
+	entry.mu.RLock()
+	names := entry.names
+	entry.mu.RUnlock()
+	if names != nil {
+		_, ok := names[filepath.ToSlash(filename)]
+		return ok
+	}
+
+	if entry.Loader.IsBinary() {
+		name := path.Join(filepath.ToSlash(entry.Loader.Directory), filepath.ToSlash(filename))
+		for _, n := range entry.Loader.NamesFunc() {
+			if path.Clean(n) == name {
+				return true
+			}
+		}
+		return false
+	}
+	_, err := os.Stat(filepath.Join(entry.Loader.Directory, filename))
+	return err == nil
 }
 
 // LoadAll loads all template engines entries, returns the first error
@@ -64,10 +99,8 @@ func (entries Entries) Find(filename string) *Entry {
 	// Read-Only no locks needed, at serve/runtime-time the library is not supposed to add new template engines
 	for i, n := 0, len(entries); i < n; i++ {
 		e := entries[i]
-		if e.Loader.Extension == extension {
-			if _, err := os.Stat(filepath.Join(e.Loader.Directory, filename)); err == nil {
-				return e
-			}
+		if e.Loader.Extension == extension && e.Has(filename) {
+			return e
 		}
 	}
 	return nil
@@ -80,7 +113,7 @@ func (entries Entries) Find(filename string) *Entry {
 // the registry finds the correct template engine and executes the template
 // so you can use and render a template file by it's file extension
 func NewManager(sharedFuncs map[string]interface{}) *Manager {
-	m := &Manager{ /*Reload: false, */ Entries: Entries{}, buffer: &bytebufferpool.Pool{}}
+	m := &Manager{Entries: Entries{}, buffer: &bytebufferpool.Pool{}}
 	m.SharedFuncs = sharedFuncs
 	return m
 }
@@ -107,11 +140,15 @@ func (m *Manager) Load() error {
 	return m.Entries.LoadAll()
 }
 
-func (m *Manager) Refresh() error {
+// Refresh loads all template engines entries, unlike Load it goes on after an error
+// so a template which does not parse doesn't prevent loading the others, returns the first error
+func (m *Manager) Refresh() (err error) {
 	for _, entry := range m.Entries {
-		entry.LoadTemplate()
+		if loadErr := entry.LoadTemplate(); loadErr != nil && err == nil {
+			err = loadErr
+		}
 	}
-	return nil
+	return
 }
 
 // ExecuteWriter calls the correct template Template's ExecuteWriter func
@@ -126,12 +163,6 @@ func (m *Manager) ExecuteWriter(out io.Writer, name string, binding interface{},
 		return fmt.Errorf("template %s was not found", name)
 	}
 
-	// if m.Reload {
-	// 	if err = entry.LoadTemplate(); err != nil {
-	// 		return
-	// 	}
-	// }
-
 	return entry.Template.ExecuteWriter(out, name, binding, options)
 }
 
@@ -0,0 +1,40 @@
+package template_test
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kenorld/egret/core/template"
+	"github.com/kenorld/egret/core/template/native"
+)
+
+func TestManagerFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"views/index.html":        {Data: []byte(`{{extends "layouts/base.html"}}{{define "content"}}{{.}}{{end}}`)},
+		"views/layouts/base.html": {Data: []byte(`<body>{{block "content" .}}{{end}}</body>`)},
+		"views/index.txt":         {Data: []byte(`{{.}}`)},
+		"other/index.html":        {Data: []byte(`other`)},
+	}
+	m := template.NewManager(nil)
+	for _, ext := range []string{".html", ".txt"} {
+		m.AddTemplate(native.New(native.Config{Layout: template.NoLayout})).RegisterFS(fsys, "views", ext)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry := m.Entries.Find("layouts/base.html"); entry != m.Entries[0] {
+		t.Errorf("Expected the html entry, got %v", entry)
+	}
+	if entry := m.Entries.Find("missing.html"); entry != nil {
+		t.Errorf("Expected no entry, got %v", entry)
+	}
+	out := &bytes.Buffer{}
+	if err := m.ExecuteWriter(out, "index.html", "embedded", nil); err != nil || out.String() != "<body>embedded</body>" {
+		t.Errorf("Unexpected result %q, %v", out.String(), err)
+	}
+	if result, err := m.ExecuteString("index.txt", "text", nil); err != nil || result != "text" {
+		t.Errorf("Unexpected result %q, %v", result, err)
+	}
+}
@@ -0,0 +1,129 @@
+package native
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	etemplate "github.com/kenorld/egret/core/template"
+)
+
+// A template inherits from a layout by starting with an extends action,
+// then overrides the block sections of the layout with define actions:
+//
+//      {{extends "layouts/admin.html"}}
+//      {{define "content"}}<h1>{{.Title}}</h1>{{end}}
+//
+// where layouts/admin.html can itself extend a layout:
+//
+//      {{extends "layouts/base.html"}}
+//      {{define "content"}}<nav></nav>{{block "admin" .}}{{end}}{{end}}
+//
+// The chain of layouts is resolved when the templates are loaded, executing
+// the template executes the layout which does not extend any other.
+
+type source struct {
+	name     string
+	path     string
+	contents string
+	// parent the layout extended, and the line of the extends action
+	parent string
+	line   int
+}
+
+// extendsPattern matches the extends action starting a template
+func (s *Template) extendsPattern() *regexp.Regexp {
+	left, right := s.delims()
+	return regexp.MustCompile(`^\s*(` + regexp.QuoteMeta(left) + `-?\s*extends\s+"([^"]+)"\s*-?` + regexp.QuoteMeta(right) + `)`)
+}
+
+// load parses the sources, builds the templates using extends and replaces the loaded templates by them.
+// A template which does not parse is skipped, the first one is returned as a *template.ParseError
+func (s *Template) load(root string, sources []*source) error {
+	var templateErr error
+	templates := template.New(root)
+	templates.Delims(s.Config.Left, s.Config.Right)
+
+	pattern, cachePattern := s.extendsPattern(), s.cachePattern()
+	byName := make(map[string]*source, len(sources))
+	names := make([]string, 0, len(sources))
+	for _, src := range sources {
+		names = append(names, src.name)
+		if match := pattern.FindStringSubmatchIndex(src.contents); match != nil {
+			src.parent = src.contents[match[4]:match[5]]
+			src.line = strings.Count(src.contents[:match[2]], "\n") + 1
+			// keep the lines of the errors
+			action := src.contents[match[2]:match[3]]
+			src.contents = src.contents[:match[2]] + strings.Repeat("\n", strings.Count(action, "\n")) + src.contents[match[3]:]
+		}
+		s.cacheBlocks(src, cachePattern)
+		byName[src.name] = src
+
+		// the blocks overridden by a template are only seen by its own copy of the layouts
+		if src.parent != "" {
+			continue
+		}
+		if err := s.parse(templates, src.name, src.contents); err != nil && templateErr == nil {
+			templateErr = parseError(src.name, src.path, err)
+		}
+	}
+
+	extended := map[string]*template.Template{}
+	for _, src := range sources {
+		if src.parent == "" {
+			continue
+		}
+		tmpl, err := s.extend(templates, byName, src)
+		if err != nil {
+			if templateErr == nil {
+				templateErr = err
+			}
+			continue
+		}
+		extended[src.name] = tmpl
+	}
+
+	s.mu.Lock()
+	s.Templates = templates
+	s.extended = extended
+	s.names = names
+	s.mu.Unlock()
+	return templateErr
+}
+
+// extend returns the template to execute for src: the last layout of its chain in a copy of templates
+// where the chain is parsed, from the last layout to src, so each one overrides the blocks of the layout it extends
+func (s *Template) extend(templates *template.Template, byName map[string]*source, src *source) (*template.Template, error) {
+	chain := []*source{src}
+	for current := src; current.parent != ""; {
+		parent, ok := byName[current.parent]
+		if !ok {
+			return nil, &etemplate.ParseError{Name: current.name, Path: current.path, Line: current.line,
+				Description: fmt.Sprintf("extends %q: template not found", current.parent)}
+		}
+		for _, c := range chain {
+			if c == parent {
+				names := make([]string, 0, len(chain)+1)
+				for _, c := range chain {
+					names = append(names, c.name)
+				}
+				return nil, &etemplate.ParseError{Name: current.name, Path: current.path, Line: current.line,
+					Description: fmt.Sprintf("extends %q: inheritance cycle %s", current.parent, strings.Join(append(names, parent.name), " -> "))}
+			}
+		}
+		chain = append(chain, parent)
+		current = parent
+	}
+
+	set, err := templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := s.parse(set, chain[i].name, chain[i].contents); err != nil {
+			return nil, parseError(chain[i].name, chain[i].path, err)
+		}
+	}
+	return set.Lookup(chain[len(chain)-1].name), nil
+}
@@ -0,0 +1,91 @@
+package native
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	etemplate "github.com/kenorld/egret/core/template"
+)
+
+var extendsTemplates = map[string]string{
+	"layouts/base.html":    `<html><title>{{block "title" .}}Egret{{end}}</title><body>{{block "content" .}}{{end}}</body></html>`,
+	"layouts/admin.html":   "{{extends \"layouts/base.html\"}}\n{{define \"content\"}}<nav>admin</nav>{{block \"admin\" .}}{{end}}{{end}}",
+	"layouts/yield.html":   `{{extends "layouts/base.html"}}{{define "content"}}<main>{{yield}}</main>{{end}}`,
+	"users/index.html":     "\n{{extends \"layouts/admin.html\"}}\n{{define \"title\"}}Users{{end}}\n{{define \"admin\"}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}",
+	"hotels/index.html":    `{{extends "layouts/base.html"}}{{define "content"}}<h1>Hotels</h1>{{render "partials/footer.html"}}{{end}}`,
+	"partials/footer.html": `<footer>{{len .}}</footer>`,
+	"plain.html":           `<p>{{index . 0}}</p>`,
+}
+
+func loadTestTemplates(t *testing.T, templates map[string]string) (*Template, error) {
+	dir, err := ioutil.TempDir("", "egret-native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, contents := range templates {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(fpath), 0777)
+		ioutil.WriteFile(fpath, []byte(contents), 0666)
+	}
+	tmpl := New(Config{Layout: NoLayout})
+	return tmpl, tmpl.LoadDirectory(dir, ".html")
+}
+
+func executeTestTemplate(t *testing.T, tmpl *Template, name string, options map[string]interface{}) string {
+	out := &bytes.Buffer{}
+	if err := tmpl.ExecuteWriter(out, name, []string{"alice", "bob"}, options); err != nil {
+		t.Fatalf("Failed to execute %s: %s", name, err)
+	}
+	return out.String()
+}
+
+func TestExtends(t *testing.T) {
+	tmpl, err := loadTestTemplates(t, extendsTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, layout, expected string
+	}{
+		{"users/index.html", "", "<html><title>Users</title><body><nav>admin</nav><ul><li>alice</li><li>bob</li></ul></body></html>"},
+		{"hotels/index.html", "", "<html><title>Egret</title><body><h1>Hotels</h1><footer>2</footer></body></html>"},
+		{"layouts/admin.html", "", "<html><title>Egret</title><body><nav>admin</nav></body></html>"},
+		{"plain.html", "", "<p>alice</p>"},
+		{"plain.html", "layouts/yield.html", "<html><title>Egret</title><body><main><p>alice</p></main></body></html>"},
+	}
+	for _, test := range tests {
+		actual := executeTestTemplate(t, tmpl, test.name, map[string]interface{}{"layout": test.layout})
+		if strings.TrimSpace(actual) != test.expected {
+			t.Errorf("%s with layout %q:\nexpected %s\n     got %s", test.name, test.layout, test.expected, actual)
+		}
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	tests := []struct {
+		templates map[string]string
+		line      int
+		expected  string
+	}{
+		{map[string]string{"a.html": "\n\n{{extends \"missing.html\"}}"}, 3, `extends "missing.html": template not found`},
+		{map[string]string{"a.html": `{{extends "b.html"}}`, "b.html": `{{extends "a.html"}}`}, 1, "inheritance cycle"},
+		{map[string]string{"a.html": "{{extends \"b.html\"}}\n{{define \"x\"}}{{.}{{end}}", "b.html": ""}, 2, "bad character"},
+	}
+	for _, test := range tests {
+		_, err := loadTestTemplates(t, test.templates)
+		perr, ok := err.(*etemplate.ParseError)
+		if !ok {
+			t.Errorf("Expected a parse error, got %v", err)
+			continue
+		}
+		if perr.Line != test.line || !strings.Contains(perr.Description, test.expected) {
+			t.Errorf("Expected %q at line %d, got %s", test.expected, test.line, perr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package native
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	etemplate "github.com/kenorld/egret/core/template"
+)
+
+// A cache action stores the HTML rendered by its body in etemplate.Fragments,
+// for the given time to live and under the given tags:
+//
+//      {{cache "nav" "10m" "menus"}}{{render "partials/nav.html"}}{{endcache}}
+//      {{cache (print "sidebar-" .User.ID) "1h"}}...{{endcache}}
+//
+// The body is executed with the dot of the action, and without the variables
+// declared outside of it. Cache actions can't be nested.
+//
+// The fragments are cached per locale, the key being suffixed by the
+// "currentLocale" render arg of the page, e.g. "nav@fr-FR", as their messages
+// are in the locale of the request. The other values the body depends on,
+// e.g. the user, have to be part of the key.
+
+// localeArg is the render arg of the locale of the request
+const localeArg = "currentLocale"
+
+// cachePattern returns the pattern of a cache action and its body
+func (s *Template) cachePattern() *regexp.Regexp {
+	left, right := s.delims()
+	left, right = regexp.QuoteMeta(left), regexp.QuoteMeta(right)
+	return regexp.MustCompile(`(?s)` + left + `(-?)\s*cache\s+(.*?)\s*(-?)` + right + `(.*?)` + left + `(-?)\s*endcache\s*(-?)` + right)
+}
+
+// cacheBlocks replaces the cache actions of src with calls to the fragment func,
+// their bodies being moved at the end of the template as defined templates
+func (s *Template) cacheBlocks(src *source, pattern *regexp.Regexp) {
+	left, right := s.delims()
+	var defines []string
+	src.contents = pattern.ReplaceAllStringFunc(src.contents, func(block string) string {
+		match := pattern.FindStringSubmatch(block)
+		name := fmt.Sprintf("%s#cache%d", src.name, len(defines)+1)
+		// the trim markers of the cache action trim the body, the ones of endcache the text following it
+		defines = append(defines, left+"define "+strconv.Quote(name)+trimRight(match[3])+right+match[4]+left+trimLeft(match[5])+"end"+right)
+		// keep the lines of the errors following the action, without rendering the newlines of the body
+		return left + trimLeft(match[1]) + "fragment " + strconv.Quote(name) + " . " + match[2] + strings.Repeat("\n", strings.Count(block, "\n")) + trimRight(match[6]) + right
+	})
+	src.contents += strings.Join(defines, "")
+}
+
+func trimLeft(marker string) string {
+	if marker == "" {
+		return ""
+	}
+	return "- "
+}
+
+func trimRight(marker string) string {
+	if marker == "" {
+		return ""
+	}
+	return " -"
+}
+
+// fragmentLocale returns the locale of the render args of a page, empty if none
+func fragmentLocale(binding interface{}) string {
+	if args, ok := binding.(map[string]interface{}); ok {
+		return cast.ToString(args[localeArg])
+	}
+	return ""
+}
+
+// fragmentFunc returns the fragment func of templates, executing the template name
+// unless its fragment is cached under key in locale
+func fragmentFunc(templates *template.Template, locale string) func(string, interface{}, string, interface{}, ...string) (template.HTML, error) {
+	return func(name string, binding interface{}, key string, ttl interface{}, tags ...string) (template.HTML, error) {
+		if locale != "" {
+			key += "@" + locale
+		}
+		fragments := etemplate.Fragments
+		if fragments != nil {
+			if fragment, ok := fragments.Get(key); ok {
+				return template.HTML(fragment), nil
+			}
+		}
+
+		tmpl := templates.Lookup(name)
+		if tmpl == nil {
+			return "", fmt.Errorf("html/template: %q is undefined", name)
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, binding); err != nil {
+			return "", err
+		}
+		if fragments != nil {
+			expires, err := fragmentTTL(ttl)
+			if err != nil {
+				return "", err
+			}
+			fragments.Set(key, buf.String(), expires, tags)
+		}
+		return template.HTML(buf.String()), nil
+	}
+}
+
+// fragmentTTL returns the time to live of a fragment, given as a duration,
+// a string like "10m" or a number of seconds
+func fragmentTTL(ttl interface{}) (time.Duration, error) {
+	switch v := ttl.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	seconds, err := cast.ToInt64E(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("cache: invalid time to live %v", ttl)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,88 @@
+package native
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	etemplate "github.com/kenorld/egret/core/template"
+)
+
+type testFragments struct {
+	fragments map[string]string
+	ttls      map[string]time.Duration
+	tags      map[string][]string
+}
+
+func (f *testFragments) Get(key string) (string, bool) {
+	fragment, ok := f.fragments[key]
+	return fragment, ok
+}
+
+func (f *testFragments) Set(key, fragment string, ttl time.Duration, tags []string) {
+	f.fragments[key] = fragment
+	f.ttls[key] = ttl
+	f.tags[key] = tags
+}
+
+func TestCacheFragments(t *testing.T) {
+	tmpl, err := loadTestTemplates(t, map[string]string{
+		"layouts/base.html": `<body>{{cache "nav" "10m" "menus"}}<nav>{{len .}}</nav>{{endcache}}{{block "content" .}}{{end}}</body>`,
+		"users/index.html":  "{{extends \"layouts/base.html\"}}\n{{define \"content\"}}{{cache (print \"users-\" (len .)) 30}}\n<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>\n{{- endcache}}{{end}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { etemplate.Fragments = nil }()
+	fragments := &testFragments{map[string]string{}, map[string]time.Duration{}, map[string][]string{}}
+	etemplate.Fragments = fragments
+
+	expected := "<body><nav>2</nav>\n<ul><li>alice</li><li>bob</li></ul></body>"
+	if actual := strings.TrimSpace(executeTestTemplate(t, tmpl, "users/index.html", nil)); actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+	if fragments.ttls["nav"] != 10*time.Minute || fragments.tags["nav"][0] != "menus" || fragments.ttls["users-2"] != 30*time.Second {
+		t.Errorf("Unexpected fragments %v %v", fragments.ttls, fragments.tags)
+	}
+
+	fragments.fragments["users-2"] = "<p>cached</p>"
+	expected = "<body><nav>2</nav><p>cached</p></body>"
+	if actual := strings.TrimSpace(executeTestTemplate(t, tmpl, "users/index.html", nil)); actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+
+	etemplate.Fragments = nil
+	expected = "<body><nav>2</nav>\n<ul><li>alice</li><li>bob</li></ul></body>"
+	if actual := strings.TrimSpace(executeTestTemplate(t, tmpl, "users/index.html", nil)); actual != expected {
+		t.Errorf("Expected %s without a fragment cache, got %s", expected, actual)
+	}
+}
+
+func TestCacheFragmentsPerLocale(t *testing.T) {
+	tmpl, err := loadTestTemplates(t, map[string]string{
+		"nav.html": `{{cache "nav" "10m"}}<nav>{{.title}}</nav>{{endcache}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { etemplate.Fragments = nil }()
+	fragments := &testFragments{map[string]string{}, map[string]time.Duration{}, map[string][]string{}}
+	etemplate.Fragments = fragments
+
+	for locale, title := range map[string]string{"en-US": "Home", "fr-FR": "Accueil"} {
+		out := &bytes.Buffer{}
+		if err := tmpl.ExecuteWriter(out, "nav.html", map[string]interface{}{"title": title, localeArg: locale}); err != nil {
+			t.Fatal(err)
+		}
+		expected := "<nav>" + title + "</nav>"
+		if out.String() != expected {
+			t.Errorf("Expected %s in %s, got %s", expected, locale, out.String())
+		}
+		if fragments.fragments["nav@"+locale] != expected {
+			t.Errorf("Expected the fragment of %s to be cached, got %v", locale, fragments.fragments)
+		}
+	}
+}
@@ -8,8 +8,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+
+	etemplate "github.com/kenorld/egret/core/template"
 )
 
 const (
@@ -25,7 +29,16 @@ type (
 		Config Config
 		// Middleware func(name string, contents string) (string, error)
 		Templates *template.Template
-		mu        sync.Mutex
+		// extended the templates starting with an extends action, by name, see extends.go
+		extended map[string]*template.Template
+		names    []string
+		mu       sync.Mutex
+	}
+
+	// set the templates used by an execution, even if reloaded meanwhile
+	set struct {
+		templates *template.Template
+		extended  map[string]*template.Template
 	}
 )
 
@@ -44,6 +57,12 @@ var emptyFuncs = template.FuncMap{
 	}, "render": func() (string, error) {
 		return "", nil
 	},
+	"fragment": func(string, interface{}, string, interface{}, ...string) (string, error) {
+		return "", nil
+	},
+	"extends": func(string) (string, error) {
+		return "", fmt.Errorf("extends was called, yet it is not the first action of the template")
+	},
 }
 
 // New creates and returns the HTMLTemplate template engine
@@ -68,6 +87,18 @@ func New(cfg ...Config) *Template {
 	return e
 }
 
+// delims returns the action delimiters, the default ones if not configured
+func (s *Template) delims() (string, string) {
+	left, right := s.Config.Left, s.Config.Right
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	return left, right
+}
+
 // Funcs should returns the helper funcs
 func (s *Template) Funcs() map[string]interface{} {
 	return s.Config.Funcs
@@ -78,126 +109,157 @@ func (s *Template) Funcs() map[string]interface{} {
 // 	return ContentType
 // }
 
-// LoadDirectory builds the templates
+// LoadDirectory builds the templates, it is called again to reload them:
+// the new templates replace the previous ones once the directory is walked.
+// A template which does not parse is skipped, the first one is returned as a *template.ParseError
 func (s *Template) LoadDirectory(dir string, extension string) error {
-	var templateErr error
-	s.Templates = template.New(dir)
-	s.Templates.Delims(s.Config.Left, s.Config.Right)
-
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if info == nil || info.IsDir() {
-		} else {
-			rel, err := filepath.Rel(dir, path)
-			if err != nil {
-				templateErr = err
-				return err
-			}
-
-			ext := filepath.Ext(path)
-			if ext == extension {
-				buf, err := ioutil.ReadFile(path)
-				if err != nil {
-					templateErr = err
-					return err
-				}
-
-				contents := string(buf)
-
-				if err == nil {
-					name := filepath.ToSlash(rel)
-					tmpl := s.Templates.New(name)
-					// tmpl := s.Templates.New(path)
-
-					// if s.Middleware != nil {
-					// 	contents, err = s.Middleware(path, contents)
-					// }
-					if err != nil {
-						templateErr = err
-						return err
-					}
-					s.mu.Lock()
-					// Add our funcmaps.
-					if s.Config.Funcs != nil {
-						tmpl.Funcs(s.Config.Funcs)
-					}
-
-					tmpl.Funcs(emptyFuncs).Parse(contents)
-					s.mu.Unlock()
-				}
-			}
-
+	var sources []*source
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if info == nil || info.IsDir() || filepath.Ext(path) != extension {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
 		}
+		sources = append(sources, &source{name: filepath.ToSlash(rel), path: path, contents: string(buf)})
 		return nil
 	})
 
+	templateErr := s.load(dir, sources)
+	if err != nil {
+		return err
+	}
 	return templateErr
 }
 
 // LoadAssets loads the templates by binary
 func (s *Template) LoadAssets(virtualDirectory string, virtualExtension string, assetFunc func(name string) ([]byte, error), namesFunc func() []string) error {
-	var templateErr error
-	s.Templates = template.New(virtualDirectory)
-	s.Templates.Delims(s.Config.Left, s.Config.Right)
+	var sources []*source
+	root := virtualDirectory
 	names := namesFunc()
 	if len(virtualDirectory) > 0 {
 		if virtualDirectory[0] == '.' { // first check for .wrong
 			virtualDirectory = virtualDirectory[1:]
 		}
-		if virtualDirectory[0] == '/' || virtualDirectory[0] == os.PathSeparator { // second check for /something, (or ./something if we had dot on 0 it will be removed
+		if len(virtualDirectory) > 0 && (virtualDirectory[0] == '/' || virtualDirectory[0] == os.PathSeparator) { // second check for /something, (or ./something if we had dot on 0 it will be removed
 			virtualDirectory = virtualDirectory[1:]
 		}
 	}
 
+	var err error
 	for _, path := range names {
 		if !strings.HasPrefix(path, virtualDirectory) {
 			continue
 		}
 		ext := filepath.Ext(path)
 		if ext == virtualExtension {
-			rel, err := filepath.Rel(virtualDirectory, path)
-			if err != nil {
-				templateErr = err
-				return err
+			var rel string
+			if rel, err = filepath.Rel(virtualDirectory, path); err != nil {
+				break
 			}
 
-			buf, err := assetFunc(path)
-			if err != nil {
-				templateErr = err
-				return err
-			}
-			contents := string(buf)
-			name := filepath.ToSlash(rel)
-			tmpl := s.Templates.New(name)
-
-			// if s.Middleware != nil {
-			// 	contents, err = s.Middleware(name, contents)
-			// }
-			if err != nil {
-				templateErr = err
-				return err
+			var buf []byte
+			if buf, err = assetFunc(path); err != nil {
+				break
 			}
-
-			// Add our funcmaps.
-			if s.Config.Funcs != nil {
-				tmpl.Funcs(s.Config.Funcs)
-			}
-			tmpl.Funcs(emptyFuncs).Parse(contents)
+			sources = append(sources, &source{name: filepath.ToSlash(rel), contents: string(buf)})
 		}
 	}
+
+	templateErr := s.load(root, sources)
+	if err != nil {
+		return err
+	}
 	return templateErr
 }
 
-func (s *Template) executeTemplateBuf(name string, binding interface{}) (*bytes.Buffer, error) {
+// parse adds the template name, parsed from contents, to templates
+func (s *Template) parse(templates *template.Template, name string, contents string) error {
+	tmpl := templates.New(name)
+	// if s.Middleware != nil {
+	// 	contents, err = s.Middleware(name, contents)
+	// }
+
+	// Add our funcmaps.
+	if s.Config.Funcs != nil {
+		tmpl.Funcs(s.Config.Funcs)
+	}
+	_, err := tmpl.Funcs(emptyFuncs).Parse(contents)
+	return err
+}
+
+// parseErrorPattern matches the errors of the template parser, e.g.
+// template: users/index.html:12: unexpected "}" in operand
+var parseErrorPattern = regexp.MustCompile(`(?s)^template: .*?:(\d+): (.*)$`)
+
+func parseError(name string, path string, err error) error {
+	e := &etemplate.ParseError{Name: name, Path: path, Description: err.Error()}
+	if match := parseErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		e.Line, _ = strconv.Atoi(match[1])
+		e.Description = match[2]
+	}
+	return e
+}
+
+// Names returns the names of the loaded templates, implements the TemplateIndex interface
+func (s *Template) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names
+}
+
+// templates returns the loaded templates
+func (s *Template) templates() set {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return set{templates: s.Templates, extended: s.extended}
+}
+
+// lookup returns the template to execute for name, the copy of its layouts for a template using extends
+func (ts set) lookup(name string) *template.Template {
+	if tmpl, ok := ts.extended[name]; ok {
+		return tmpl
+	}
+	return ts.templates.Lookup(name)
+}
+
+// execute executes the template name
+func (ts set) execute(out io.Writer, name string, binding interface{}) error {
+	tmpl := ts.lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("html/template: %q is undefined", name)
+	}
+	return tmpl.Execute(out, binding)
+}
+
+func (ts set) executeTemplateBuf(name string, binding interface{}) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
-	err := s.Templates.ExecuteTemplate(buf, name, binding)
+	err := ts.execute(buf, name, binding)
 
 	return buf, err
 }
 
-func (s *Template) layoutFuncsFor(name string, binding interface{}) {
+// funcs adds the funcs to the templates, and to the copies used by the names extending layouts,
+// the fragments being cached in the locale of the binding
+func (ts set) funcs(funcs template.FuncMap, binding interface{}, names ...string) {
+	locale := fragmentLocale(binding)
+	ts.templates.Funcs(funcs).Funcs(template.FuncMap{"fragment": fragmentFunc(ts.templates, locale)})
+	for _, name := range names {
+		if tmpl, ok := ts.extended[name]; ok {
+			tmpl.Funcs(funcs).Funcs(template.FuncMap{"fragment": fragmentFunc(tmpl, locale)})
+		}
+	}
+}
+
+func (s *Template) layoutFuncsFor(templates set, name string, binding interface{}) template.FuncMap {
 	funcs := template.FuncMap{
 		"yield": func() (template.HTML, error) {
-			buf, err := s.executeTemplateBuf(name, binding)
+			buf, err := templates.executeTemplateBuf(name, binding)
 			// Return safe HTML here since we are rendering our own template.
 			return template.HTML(buf.String()), err
 		},
@@ -206,8 +268,8 @@ func (s *Template) layoutFuncsFor(name string, binding interface{}) {
 		},
 		"partial": func(partialName string) (template.HTML, error) {
 			fullPartialName := fmt.Sprintf("%s-%s", partialName, name)
-			if s.Templates.Lookup(fullPartialName) != nil {
-				buf, err := s.executeTemplateBuf(fullPartialName, binding)
+			if templates.lookup(fullPartialName) != nil {
+				buf, err := templates.executeTemplateBuf(fullPartialName, binding)
 				return template.HTML(buf.String()), err
 			}
 			return "", nil
@@ -220,14 +282,14 @@ func (s *Template) layoutFuncsFor(name string, binding interface{}) {
 		// 	ext := filepath.Ext(name)
 		// 	root := name[:len(name)-len(ext)]
 		// 	fullPartialName := fmt.Sprintf("%s%s%s", root, partialName, ext)
-		// 	if s.Templates.Lookup(fullPartialName) != nil {
-		// 		buf, err := s.executeTemplateBuf(fullPartialName, binding)
+		// 	if templates.lookup(fullPartialName) != nil {
+		// 		buf, err := templates.executeTemplateBuf(fullPartialName, binding)
 		// 		return template.HTML(buf.String()), err
 		// 	}
 		// 	return "", nil
 		// },
 		"render": func(fullPartialName string) (template.HTML, error) {
-			buf, err := s.executeTemplateBuf(fullPartialName, binding)
+			buf, err := templates.executeTemplateBuf(fullPartialName, binding)
 			return template.HTML(buf.String()), err
 		},
 	}
@@ -237,27 +299,26 @@ func (s *Template) layoutFuncsFor(name string, binding interface{}) {
 			funcs[k] = v
 		}
 	}
-	if tpl := s.Templates.Lookup(name); tpl != nil {
-		tpl.Funcs(funcs)
-	}
+	return funcs
 }
 
-func (s *Template) runtimeFuncsFor(name string, binding interface{}) {
-	funcs := template.FuncMap{
+func (s *Template) runtimeFuncsFor(templates set, name string, binding interface{}) template.FuncMap {
+	return template.FuncMap{
 		"render": func(fullPartialName string) (template.HTML, error) {
-			buf, err := s.executeTemplateBuf(fullPartialName, binding)
+			buf, err := templates.executeTemplateBuf(fullPartialName, binding)
 			return template.HTML(buf.String()), err
 		},
 	}
-
-	if tpl := s.Templates.Lookup(name); tpl != nil {
-		tpl.Funcs(funcs)
-	}
 }
 
-// ExecuteWriter executes a templates and write its results to the out writer
+// ExecuteWriter executes a templates and write its results to the out writer,
+// the layout option replaces the configured layout, which is not used by the templates using extends
 func (s *Template) ExecuteWriter(out io.Writer, name string, binding interface{}, options ...map[string]interface{}) error {
+	templates := s.templates()
 	layout := s.Config.Layout
+	if _, ok := templates.extended[name]; ok {
+		layout = ""
+	}
 
 	if len(options) > 0 {
 		layoutOpt := options[0]["layout"]
@@ -271,13 +332,13 @@ func (s *Template) ExecuteWriter(out io.Writer, name string, binding interface{}
 	}
 
 	if layout != "" && layout != NoLayout {
-		s.layoutFuncsFor(name, binding)
+		templates.funcs(s.layoutFuncsFor(templates, name, binding), binding, name, layout)
 		name = layout
 	} else {
-		s.runtimeFuncsFor(name, binding)
+		templates.funcs(s.runtimeFuncsFor(templates, name, binding), binding, name)
 	}
 
-	return s.Templates.ExecuteTemplate(out, name, binding)
+	return templates.execute(out, name, binding)
 }
 
 // ExecuteRaw receives, parse and executes raw source template contents
@@ -1,7 +1,9 @@
 package template
 
 import (
+	"fmt"
 	"io"
+	"time"
 )
 
 type (
@@ -35,8 +37,43 @@ type (
 		// ExecuteRaw is super-simple function without options and funcs, it's not used widely
 		ExecuteRaw(src string, wr io.Writer, binding interface{}) error
 	}
+
+	// TemplateIndex is optional interface for the Template
+	// used by the Manager to find the template engine of a file without looking for it on the disk
+	TemplateIndex interface {
+		// Names returns the names of the loaded templates, relative to the loader's directory
+		Names() []string
+	}
+
+	// FragmentCache stores the fragments rendered by the cache actions of the templates,
+	// implemented by the cache package
+	FragmentCache interface {
+		// Get returns the fragment of key, false if it is not cached
+		Get(key string) (string, bool)
+		// Set caches the fragment of key for ttl, the tags allowing to invalidate it along with others
+		Set(key string, fragment string, ttl time.Duration, tags []string)
+	}
+
+	// ParseError is returned by the template engines when a template file does not parse,
+	// it locates the error so it can be shown on the development error page
+	ParseError struct {
+		// Name of the template, relative to the loader's directory
+		Name string
+		// Path of the template file, empty when loaded by binary
+		Path        string
+		Line        int
+		Description string
+	}
 )
 
+// Fragments caches the fragments of the templates, they are rendered on each execution if nil,
+// like in development mode
+var Fragments FragmentCache
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("template: %s:%d: %s", e.Name, e.Line, e.Description)
+}
+
 // Below are just helpers for my two web frameworks which you can use also to your web app
 
 // NoLayout to disable layout for a particular template file
@@ -0,0 +1,10 @@
+// Package views embeds the templates of Egret, like its error pages, so the
+// applications find them without the Egret sources.
+package views
+
+import "embed"
+
+// FS holds the templates, named as in this directory, e.g. "errors/500.html".
+//
+//go:embed *.html errors
+var FS embed.FS
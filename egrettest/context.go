@@ -0,0 +1,152 @@
+package egrettest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kenorld/egret"
+)
+
+// Context runs handlers on a request without routing it, e.g. to unit test an action,
+// and checks what they would render without rendering it, the templates being left
+// unexecuted:
+//
+//      func TestShow(t *testing.T) {
+//          c := egrettest.NewContext(t, httptest.NewRequest("GET", "/hotels/1", nil)).
+//              WithParams(map[string]string{"id": "1"}).
+//              WithSession(egret.Session{"user": "demo"})
+//          c.Run(controllers.ShowHotel)
+//          c.ExpectStatus(200).ExpectTemplate("hotels/show.html")
+//      }
+type Context struct {
+	*egret.Context
+	T testing.TB
+	// Recorder records what the handlers write to the response themselves
+	Recorder *httptest.ResponseRecorder
+}
+
+// NewContext returns the context of req, with empty params, session and flash
+func NewContext(t testing.TB, req *http.Request) *Context {
+	w := httptest.NewRecorder()
+	c := egret.NewContext(egret.NewRequest(req), egret.NewResponse(w))
+	c.Params = map[string]string{}
+	c.Session = egret.Session{}
+	c.Flash = egret.Flash{Data: map[string]string{}, Out: map[string]string{}}
+	return &Context{Context: c, T: t, Recorder: w}
+}
+
+// WithParams adds params to the context, as the ones of the route would be
+func (c *Context) WithParams(params map[string]string) *Context {
+	for key, val := range params {
+		c.Params[key] = val
+	}
+	return c
+}
+
+// WithSession adds values to the session of the context
+func (c *Context) WithSession(session egret.Session) *Context {
+	for key, val := range session {
+		c.Session[key] = val
+	}
+	return c
+}
+
+// WithFlash adds values to the flash of the context, as the ones of the previous request
+func (c *Context) WithFlash(flash map[string]string) *Context {
+	for key, val := range flash {
+		c.Flash.Data[key] = val
+	}
+	return c
+}
+
+// Run runs the handlers in order, each going on to the next one with Next as in the app
+func (c *Context) Run(handlers ...egret.HandlerFunc) *Context {
+	c.Handlers = handlers
+	c.Next()
+	return c
+}
+
+// ExpectStatus checks the status of the response
+func (c *Context) ExpectStatus(status int) *Context {
+	c.T.Helper()
+	if actual := c.Rendering().Status; actual != status {
+		c.T.Errorf("egrettest: expected status %d, got %d%s", status, actual, c.describe())
+	}
+	return c
+}
+
+// ExpectTemplate checks the path of the rendered template
+func (c *Context) ExpectTemplate(path string) *Context {
+	c.T.Helper()
+	r := c.Rendering()
+	if r.Error != nil || r.RedirectURL != "" || r.Format != "" || r.Binary != nil || r.TemplatePath != path {
+		c.T.Errorf("egrettest: expected template %q%s", path, c.describe())
+	}
+	return c
+}
+
+// ExpectRedirect checks the URL redirected to
+func (c *Context) ExpectRedirect(url string) *Context {
+	c.T.Helper()
+	if actual := c.Rendering().RedirectURL; actual != url {
+		c.T.Errorf("egrettest: expected a redirect to %q%s", url, c.describe())
+	}
+	return c
+}
+
+// ExpectFormat checks the content type the entity is serialized to, e.g. egret.ContentJSON
+func (c *Context) ExpectFormat(format string) *Context {
+	c.T.Helper()
+	if actual := c.Rendering().Format; actual != format {
+		c.T.Errorf("egrettest: expected format %q, got %q%s", format, actual, c.describe())
+	}
+	return c
+}
+
+// ExpectEntity checks the serialized entity, or the one of the template, is deeply equal to entity
+func (c *Context) ExpectEntity(entity interface{}) *Context {
+	c.T.Helper()
+	if actual := c.Rendering().Entity; !reflect.DeepEqual(actual, entity) {
+		c.T.Errorf("egrettest: expected entity %#v, got %#v", entity, actual)
+	}
+	return c
+}
+
+// ExpectError checks the handlers failed with an error
+func (c *Context) ExpectError() *Context {
+	c.T.Helper()
+	if c.Rendering().Error == nil {
+		c.T.Errorf("egrettest: expected an error%s", c.describe())
+	}
+	return c
+}
+
+// ExpectFlash checks a value of the flash set for the next request
+func (c *Context) ExpectFlash(key, value string) *Context {
+	c.T.Helper()
+	if actual := c.Flash.Out[key]; actual != value {
+		c.T.Errorf("egrettest: expected flash %s %q, got %q", key, value, actual)
+	}
+	return c
+}
+
+// describe returns what the handlers render, for the failures
+func (c *Context) describe() string {
+	r := c.Rendering()
+	switch {
+	case r.Error != nil:
+		return fmt.Sprintf(": error %v", r.Error)
+	case r.RedirectURL != "":
+		return fmt.Sprintf(": redirect to %q", r.RedirectURL)
+	case r.Format != "":
+		return fmt.Sprintf(": %s entity", r.Format)
+	case r.Binary != nil:
+		return fmt.Sprintf(": binary %q", r.Binary.Name)
+	case r.TemplatePath != "":
+		return fmt.Sprintf(": template %q", r.TemplatePath)
+	}
+	return ""
+}
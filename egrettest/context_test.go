@@ -0,0 +1,49 @@
+package egrettest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kenorld/egret"
+)
+
+func TestContext(t *testing.T) {
+	initTestApp()
+
+	show := func(c *egret.Context) {
+		if c.Session["user"] == "" {
+			c.Flash.Error("Sign in first")
+			c.Redirect("/login")
+			return
+		}
+		c.RenderTemplate("hotels/show.html", map[string]string{"id": c.Param("id")}, nil)
+	}
+	auth := func(c *egret.Context) {
+		c.Store["checked"] = true
+		c.Next()
+	}
+
+	c := NewContext(t, httptest.NewRequest("GET", "/hotels/1", nil)).
+		WithParams(map[string]string{"id": "1"}).
+		WithSession(egret.Session{"user": "demo"}).
+		Run(auth, show)
+	c.ExpectStatus(200).ExpectTemplate("hotels/show.html").ExpectEntity(map[string]string{"id": "1"})
+	if c.Store["checked"] != true {
+		t.Errorf("Expected the handlers to run in order")
+	}
+	if c.Recorder.Body.Len() != 0 {
+		t.Errorf("Expected the template not to be executed, got %q", c.Recorder.Body.String())
+	}
+
+	NewContext(t, httptest.NewRequest("GET", "/hotels/1", nil)).Run(show).
+		ExpectStatus(302).ExpectRedirect("/login").ExpectFlash("error", "Sign in first")
+
+	NewContext(t, httptest.NewRequest("GET", "/hotels", nil)).
+		WithFlash(map[string]string{"success": "Saved"}).
+		Run(func(c *egret.Context) { c.RenderJSON([]string{c.Flash.Data["success"]}) }).
+		ExpectStatus(200).ExpectFormat(egret.ContentJSON).ExpectEntity([]string{"Saved"})
+
+	NewContext(t, httptest.NewRequest("GET", "/hotels/2", nil)).
+		Run(func(c *egret.Context) { c.NotFound("No hotel %d", 2) }).
+		ExpectStatus(404).ExpectError()
+}
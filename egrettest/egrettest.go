@@ -0,0 +1,312 @@
+// Package egrettest tests an Egret app in process: the app is initialized without
+// listening to a port, and a Client sends it requests, keeping its cookies, e.g. the
+// Session and the Flash, from one request to the next:
+//
+//      func TestBooking(t *testing.T) {
+//          c := egrettest.New(t)
+//          c.Post("/login").WithForm(url.Values{"user": {"demo"}}).Expect(302)
+//          var hotels []models.Hotel
+//          c.Get("/hotels").WithHeader("Accept", "application/json").Expect(200).JSON(&hotels)
+//      }
+//
+// The app is initialized in the run mode of the EGRET_RUN_MODE environment variable,
+// "dev" by default, from the import path of EGRET_IMPORT_PATH and in the directory
+// of EGRET_BASE_PATH, else the closest directory holding conf/app.yaml, all set by egret test.
+package egrettest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kenorld/egret"
+)
+
+const (
+	// RunModeEnv the environment variable of the run mode of the app
+	RunModeEnv = "EGRET_RUN_MODE"
+	// ImportPathEnv the environment variable of the import path of the app
+	ImportPathEnv = "EGRET_IMPORT_PATH"
+	// BasePathEnv the environment variable of the directory of the app
+	BasePathEnv = "EGRET_BASE_PATH"
+)
+
+var initOnce sync.Once
+
+// Init initializes the app once, unless it is already initialized, in the run mode
+// of EGRET_RUN_MODE and from the import path of EGRET_IMPORT_PATH. The tests run
+// from the directory of the app, as the app itself does, whatever their package
+func Init() {
+	initOnce.Do(func() {
+		if egret.Initialized {
+			return
+		}
+		if dir := basePath(); dir != "" {
+			if err := os.Chdir(dir); err != nil {
+				panic(err)
+			}
+		}
+		mode := os.Getenv(RunModeEnv)
+		if mode == "" {
+			mode = "dev"
+		}
+		egret.Init(mode, os.Getenv(ImportPathEnv), "")
+	})
+}
+
+// basePath returns the directory of the app, EGRET_BASE_PATH else the closest
+// directory holding conf/app.yaml, empty if none does
+func basePath() string {
+	if dir := os.Getenv(BasePathEnv); dir != "" {
+		return dir
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "conf", "app.yaml")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Client sends requests to the app in process, keeping the cookies of its responses
+type Client struct {
+	T       testing.TB
+	Handler http.Handler
+	Jar     http.CookieJar
+	// BaseURL the URL the paths of the requests are resolved against
+	BaseURL *url.URL
+}
+
+// New initializes the app and returns a Client reporting its failures to t
+func New(t testing.TB) *Client {
+	Init()
+	jar, _ := cookiejar.New(nil)
+	base, _ := url.Parse("https://localhost")
+	return &Client{T: t, Handler: egret.Handler(), Jar: jar, BaseURL: base}
+}
+
+// Get returns a GET request of path
+func (c *Client) Get(path string) *Request {
+	return c.NewRequest("GET", path)
+}
+
+// Post returns a POST request of path
+func (c *Client) Post(path string) *Request {
+	return c.NewRequest("POST", path)
+}
+
+// Put returns a PUT request of path
+func (c *Client) Put(path string) *Request {
+	return c.NewRequest("PUT", path)
+}
+
+// Patch returns a PATCH request of path
+func (c *Client) Patch(path string) *Request {
+	return c.NewRequest("PATCH", path)
+}
+
+// Delete returns a DELETE request of path
+func (c *Client) Delete(path string) *Request {
+	return c.NewRequest("DELETE", path)
+}
+
+// NewRequest returns a request of path, sent once a response is expected
+func (c *Client) NewRequest(method, path string) *Request {
+	ref, err := url.Parse(path)
+	if err != nil {
+		c.T.Fatalf("egrettest: invalid path %q: %v", path, err)
+	}
+	target := c.BaseURL.ResolveReference(ref).String()
+	return &Request{client: c, Request: httptest.NewRequest(method, target, nil)}
+}
+
+// Session returns the session of the client, the one of its session cookie
+func (c *Client) Session() egret.Session {
+	if cookie := c.cookie(egret.CookiePrefix + "_SESSION"); cookie != nil {
+		return egret.GetSessionFromCookie(cookie)
+	}
+	return egret.Session{}
+}
+
+// SetSession replaces the session of the client, e.g. to send the requests of a signed in user
+func (c *Client) SetSession(session egret.Session) {
+	c.Jar.SetCookies(c.BaseURL, []*http.Cookie{session.Cookie()})
+}
+
+// Flash returns the flash of the client, the one set by the last response
+func (c *Client) Flash() map[string]string {
+	flash := map[string]string{}
+	if cookie := c.cookie(egret.CookiePrefix + "_FLASH"); cookie != nil {
+		egret.ParseKeyValueCookie(cookie.Value, func(key, val string) {
+			flash[key] = val
+		})
+	}
+	return flash
+}
+
+func (c *Client) cookie(name string) *http.Cookie {
+	for _, cookie := range c.Jar.Cookies(c.BaseURL) {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// Request is a request of a Client
+type Request struct {
+	*http.Request
+	client *Client
+}
+
+// WithHeader sets a header of the request
+func (r *Request) WithHeader(key, value string) *Request {
+	r.Header.Set(key, value)
+	return r
+}
+
+// WithCookie adds a cookie to the request, along with the ones of the client
+func (r *Request) WithCookie(cookie *http.Cookie) *Request {
+	r.AddCookie(cookie)
+	return r
+}
+
+// WithBody sets the body of the request and its content type
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+// WithJSON sets the body of the request to the JSON of v
+func (r *Request) WithJSON(v interface{}) *Request {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.client.T.Fatalf("egrettest: %v", err)
+	}
+	return r.WithBody(egret.ContentJSON, body)
+}
+
+// WithForm sets the body of the request to the form values
+func (r *Request) WithForm(values url.Values) *Request {
+	return r.WithBody("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// Do sends the request to the app and returns its response
+func (r *Request) Do() *Response {
+	c := r.client
+	for _, cookie := range c.Jar.Cookies(r.URL) {
+		if _, err := r.Cookie(cookie.Name); err == http.ErrNoCookie {
+			r.AddCookie(cookie)
+		}
+	}
+	w := httptest.NewRecorder()
+	c.Handler.ServeHTTP(w, r.Request)
+
+	result := w.Result()
+	result.Request = r.Request
+	c.Jar.SetCookies(r.URL, result.Cookies())
+	body, _ := ioutil.ReadAll(result.Body)
+	return &Response{Response: result, Body: body, client: c}
+}
+
+// Expect sends the request to the app and checks the status of its response
+func (r *Request) Expect(status int) *Response {
+	r.client.T.Helper()
+	return r.Do().Expect(status)
+}
+
+// Response is a response of the app
+type Response struct {
+	*http.Response
+	// Body the whole body of the response
+	Body   []byte
+	client *Client
+}
+
+// Expect checks the status of the response
+func (r *Response) Expect(status int) *Response {
+	r.client.T.Helper()
+	if r.StatusCode != status {
+		r.client.T.Errorf("egrettest: %s %s: expected status %d, got %d: %s", r.Request.Method, r.Request.URL.Path, status, r.StatusCode, r.excerpt())
+	}
+	return r
+}
+
+// ExpectHeader checks a header of the response
+func (r *Response) ExpectHeader(key, value string) *Response {
+	r.client.T.Helper()
+	if actual := r.Header.Get(key); actual != value {
+		r.client.T.Errorf("egrettest: %s %s: expected %s %q, got %q", r.Request.Method, r.Request.URL.Path, key, value, actual)
+	}
+	return r
+}
+
+// ExpectContentType checks the content type of the response, but its parameters
+func (r *Response) ExpectContentType(contentType string) *Response {
+	r.client.T.Helper()
+	if actual := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]); actual != contentType {
+		r.client.T.Errorf("egrettest: %s %s: expected content type %q, got %q", r.Request.Method, r.Request.URL.Path, contentType, actual)
+	}
+	return r
+}
+
+// ExpectContains checks the body of the response contains s
+func (r *Response) ExpectContains(s string) *Response {
+	r.client.T.Helper()
+	if !bytes.Contains(r.Body, []byte(s)) {
+		r.client.T.Errorf("egrettest: %s %s: expected %q in the body: %s", r.Request.Method, r.Request.URL.Path, s, r.excerpt())
+	}
+	return r
+}
+
+// JSON decodes the JSON body of the response into v
+func (r *Response) JSON(v interface{}) *Response {
+	r.client.T.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.client.T.Errorf("egrettest: %s %s: invalid JSON body: %v: %s", r.Request.Method, r.Request.URL.Path, err, r.excerpt())
+	}
+	return r
+}
+
+// String returns the body of the response
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// Follow sends a GET request of the location of the redirect response
+func (r *Response) Follow() *Response {
+	r.client.T.Helper()
+	location, err := r.Location()
+	if err != nil {
+		r.client.T.Fatalf("egrettest: %s %s: no location to follow: %v", r.Request.Method, r.Request.URL.Path, err)
+	}
+	return r.client.Get(location.String()).Do()
+}
+
+// excerpt returns the beginning of the body, for the failures
+func (r *Response) excerpt() string {
+	const max = 512
+	if len(r.Body) > max {
+		return string(r.Body[:max]) + "..."
+	}
+	return string(r.Body)
+}
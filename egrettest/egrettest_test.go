@@ -0,0 +1,56 @@
+package egrettest
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
+	"github.com/kenorld/egret/core/serializer"
+	"go.uber.org/zap"
+)
+
+func initTestApp() {
+	egret.Logger = zap.NewNop()
+	egret.Config, _ = conf.LoadContext("app", nil)
+	egret.MainSerializerManager = serializer.NewManager()
+	serializer.RegisterDefaults(egret.MainSerializerManager)
+	egret.SecretKey = []byte("secret")
+	egret.CookiePrefix = "EGRET"
+	egret.Initialized = true
+
+	router := egret.NewRouter()
+	router.Before("*", egret.SessionHandler, egret.FlashHandler)
+	router.Path("/login").Post(func(c *egret.Context) {
+		c.Session["user"] = c.Form("user")
+		c.Flash.Success("Welcome %s", c.Form("user"))
+		c.Redirect("/me")
+	})
+	router.Path("/me").Get(func(c *egret.Context) {
+		c.RenderJSON(map[string]string{"user": c.Session["user"], "flash": c.Flash.Data["success"]})
+	})
+}
+
+func TestClient(t *testing.T) {
+	initTestApp()
+	c := New(t)
+
+	resp := c.Post("/login").WithForm(url.Values{"user": {"demo"}}).Expect(302)
+	if user := c.Session()["user"]; user != "demo" {
+		t.Errorf("Expected the user of the session, got %q", user)
+	}
+	if flash := c.Flash()["success"]; flash != "Welcome demo" {
+		t.Errorf("Expected the flash of the login, got %q", flash)
+	}
+
+	var me map[string]string
+	resp.Follow().Expect(200).ExpectContentType(egret.ContentJSON).JSON(&me)
+	if me["user"] != "demo" || me["flash"] != "Welcome demo" {
+		t.Errorf("Expected the session and the flash to round-trip, got %v", me)
+	}
+	c.Get("/me").Expect(200).ExpectContains(`"flash":""`)
+
+	c.SetSession(egret.Session{"user": "admin"})
+	c.Get("/me").Expect(200).ExpectContains(`"user":"admin"`)
+	c.Get("/missing").Expect(404)
+}
@@ -0,0 +1,195 @@
+package egret
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ETagHeader represents the header "ETag"
+	ETagHeader = "ETag"
+	// IfMatchHeader represents the header "If-Match"
+	IfMatchHeader = "If-Match"
+	// IfNoneMatchHeader represents the header "If-None-Match"
+	IfNoneMatchHeader = "If-None-Match"
+)
+
+// ETagResponseWriter buffers the rendered body, so its ETag can be sent
+// before it, and answers 304 Not Modified when the client already has it.
+type ETagResponseWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	weak    bool
+	status  int
+	buffer  bytes.Buffer
+	// passthrough is set once the body has been flushed to the client
+	// and can no longer be tagged.
+	passthrough bool
+	closed      bool
+}
+
+// ETagHandler tags the successful responses of GET and HEAD requests, as
+// produced by ExecuteRender, with a hash of their body, and answers requests
+// whose If-None-Match header matches it with 304 Not Modified.
+//
+// Tags are strong unless "render.etag.weak" is set. Put ETagHandler before
+// CompressHandler in the chain, so the tag is computed on the uncompressed
+// body: CompressHandler makes it weak, as it is shared by the encodings of
+// the body. Responses that already carry an ETag (see Context.CheckETag) are
+// left untouched.
+func ETagHandler(ctx *Context) {
+	ctx.Next()
+	method := ctx.Request.Method
+	if method != http.MethodGet && method != http.MethodHead {
+		return
+	}
+	ctx.Response.Writer = &ETagResponseWriter{
+		ResponseWriter: ctx.Response.Writer,
+		request:        ctx.Request.Request,
+		weak:           Config.GetBoolDefault("render.etag.weak", false),
+		status:         http.StatusOK,
+	}
+}
+
+// WriteHeader holds the status back until the body is complete.
+func (w *ETagResponseWriter) WriteHeader(status int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *ETagResponseWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush sends the buffered body untagged and streams the rest of it.
+func (w *ETagResponseWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close tags and writes the buffered response, then closes the parent writer.
+func (w *ETagResponseWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if !w.passthrough {
+		w.writeBuffered()
+	}
+	if c, ok := w.ResponseWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *ETagResponseWriter) writeBuffered() {
+	header := w.Header()
+	if w.status == http.StatusOK {
+		etag := header.Get(ETagHeader)
+		if etag == "" {
+			etag = NewETag(w.buffer.Bytes(), w.weak)
+			header.Set(ETagHeader, etag)
+		}
+		if ETagMatch(w.request.Header.Get(IfNoneMatchHeader), etag, true) {
+			header.Del(ContentType)
+			header.Del(ContentLength)
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buffer.Bytes())
+}
+
+// NewETag returns a quoted entity tag for the given content,
+// prefixed with W/ if weak is true.
+func NewETag(content []byte, weak bool) string {
+	sum := sha1.Sum(content)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// ETagMatch reports whether etag matches one of the entity tags of an
+// If-Match or If-None-Match header value. "*" matches any tag.
+//
+// The weak comparison (used by If-None-Match) ignores the W/ prefixes, the
+// strong comparison (used by If-Match) never matches a weak tag.
+func ETagMatch(header string, etag string, weakComparison bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || etag == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	if weakComparison {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weakComparison {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckETag sets the ETag of the current version of the requested resource
+// and evaluates the conditional request headers against it.
+//
+// For GET and HEAD requests, a matching If-None-Match header makes the
+// response a 304 Not Modified. For other methods (e.g. PUT and PATCH), a
+// non-matching If-Match header, or If-None-Match "*" on an existing resource,
+// makes it a 412 Precondition Failed.
+// In both cases the rest of the handlers are skipped and false is returned,
+// so the caller should return immediately:
+//
+//      if !ctx.CheckETag(egret.NewETag([]byte(post.Version), false)) {
+//          return
+//      }
+func (c *Context) CheckETag(etag string) bool {
+	header := c.Request.Header
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		c.Response.SetHeader(ETagHeader, etag)
+		if ETagMatch(header.Get(IfNoneMatchHeader), etag, true) {
+			c.Response.Status = http.StatusNotModified
+			c.Abort()
+			return false
+		}
+	default:
+		ifMatch := header.Get(IfMatchHeader)
+		if (ifMatch != "" && !ETagMatch(ifMatch, etag, false)) ||
+			strings.TrimSpace(header.Get(IfNoneMatchHeader)) == "*" {
+			c.PreconditionFailed("The resource has been modified")
+			c.Abort()
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package egret
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveETag(method, ifNoneMatch, ifMatch string, handler HandlerFunc) *httptest.ResponseRecorder {
+	Config, _ = conf.LoadContext("app", nil)
+	initSerializer()
+	req, _ := http.NewRequest(method, "/posts/1", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set(IfNoneMatchHeader, ifNoneMatch)
+	}
+	if ifMatch != "" {
+		req.Header.Set(IfMatchHeader, ifMatch)
+	}
+	return serveHandlers(req, ETagHandler, handler)
+}
+
+func TestETagHandler(t *testing.T) {
+	render := func(c *Context) { c.RenderText("hello") }
+	etag := NewETag([]byte("hello"), false)
+
+	w := serveETag("GET", "", "", render)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag, w.Header().Get(ETagHeader))
+	assert.Equal(t, "hello", w.Body.String())
+
+	w = serveETag("GET", `"other", `+etag, "", render)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "", w.Body.String())
+
+	w = serveETag("GET", "W/"+etag, "", render)
+	assert.Equal(t, http.StatusNotModified, w.Code, "If-None-Match uses the weak comparison")
+}
+
+func TestCheckETag(t *testing.T) {
+	version := `"v2"`
+	update := func(c *Context) {
+		if !c.CheckETag(version) {
+			return
+		}
+		c.RenderText("updated")
+	}
+	req, _ := http.NewRequest("PUT", "/posts/1", nil)
+
+	req.Header.Set(IfMatchHeader, `"v1"`)
+	c := NewContext(NewRequest(req), NewResponse(httptest.NewRecorder()))
+	c.Handlers = []HandlerFunc{update}
+	c.Next()
+	assert.Equal(t, http.StatusPreconditionFailed, c.Response.Status)
+	assert.NotNil(t, c.Error)
+
+	req.Header.Set(IfMatchHeader, version)
+	c = NewContext(NewRequest(req), NewResponse(httptest.NewRecorder()))
+	c.Handlers = []HandlerFunc{update}
+	c.Next()
+	assert.Nil(t, c.Error)
+	assert.Equal(t, "updated", c.RenderArgs["Entity"])
+
+	assert.False(t, ETagMatch("W/"+version, "W/"+version, false), "If-Match uses the strong comparison")
+	assert.True(t, ETagMatch("*", version, false))
+}
+
+func TestETagHandlerEncodings(t *testing.T) {
+	Config, _ = conf.LoadContext("app", nil)
+	initSerializer()
+	body := strings.Repeat("egret ", 1000)
+	serve := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/posts/1", nil)
+		req.Header.Set(AcceptEncodingHeader, acceptEncoding)
+		req.Header.Set(IfNoneMatchHeader, ifNoneMatch)
+		return serveHandlers(req, ETagHandler, CompressHandler, func(c *Context) { c.RenderText(body) })
+	}
+	etag := NewETag([]byte(body), false)
+
+	w := serve("", "")
+	assert.Equal(t, etag, w.Header().Get(ETagHeader), "the identity body has the strong tag")
+
+	for _, encoding := range []string{"gzip", "br"} {
+		w = serve(encoding, "")
+		assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, AcceptEncodingHeader, w.Header().Get("Vary"))
+		assert.Equal(t, "W/"+etag, w.Header().Get(ETagHeader), "the encoded bodies share a weak tag")
+
+		w = serve(encoding, w.Header().Get(ETagHeader))
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	}
+	w = serve("", "W/"+etag)
+	assert.Equal(t, http.StatusNotModified, w.Code, "the weak tag validates the identity body")
+}
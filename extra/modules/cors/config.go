@@ -0,0 +1,78 @@
+package cors
+
+import (
+	"sync/atomic"
+
+	"github.com/kenorld/egret"
+	"go.uber.org/zap"
+)
+
+// Config is the "cors" section of app.yaml, the options of the handler
+// returned by Configured.
+type Config struct {
+	AllowedOrigins     []string
+	AllowedMethods     []string
+	AllowedHeaders     []string
+	ExposedHeaders     []string
+	AllowCredentials   bool
+	MaxAge             int `validate:"min=0"`
+	OptionsPassthrough bool
+	Debug              bool
+}
+
+func init() {
+	egret.RegisterConfig("cors", Config{})
+}
+
+// Options returns the options of the handler.
+func (cfg Config) Options() Options {
+	return Options{
+		AllowedOrigins:     cfg.AllowedOrigins,
+		AllowedMethods:     cfg.AllowedMethods,
+		AllowedHeaders:     cfg.AllowedHeaders,
+		ExposedHeaders:     cfg.ExposedHeaders,
+		AllowCredentials:   cfg.AllowCredentials,
+		MaxAge:             cfg.MaxAge,
+		OptionsPassthrough: cfg.OptionsPassthrough,
+		Debug:              cfg.Debug,
+	}
+}
+
+// Configured returns a handler with the options of the "cors" section of
+// app.yaml, once the configuration is loaded. A reload of the configuration
+// changing the section applies the new options to the next requests.
+//
+// Example:
+//
+//      egret.OnAppStart(func() {
+//          router.Path("/api").Before("*", cors.Configured())
+//      })
+func Configured() egret.HandlerFunc {
+	c, err := fromConfig()
+	if err != nil {
+		panic("Invalid cors configuration: " + err.Error())
+	}
+	var current atomic.Value
+	current.Store(c)
+	egret.OnConfigChange("cors", func(old, new interface{}) {
+		c, err := fromConfig()
+		if err != nil {
+			egret.Logger.Error("Invalid cors configuration, the options are kept", zap.Error(err))
+			return
+		}
+		current.Store(c)
+		egret.Logger.Info("CORS options changed")
+	})
+	return func(ctx *egret.Context) {
+		current.Load().(*Cors).Serve(ctx)
+	}
+}
+
+// fromConfig returns a handler with the options of the "cors" section.
+func fromConfig() (*Cors, error) {
+	cfg := Config{}
+	if err := egret.Config.Bind("cors", &cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg.Options()), nil
+}
@@ -227,7 +227,7 @@ func (c *Cors) Conflicts() string {
 
 // Serve serves the middleware
 func (c *Cors) Serve(ctx *egret.Context) {
-	if ctx.Method() == "OPTIONS" {
+	if ctx.Request.Method == http.MethodOptions {
 		c.logf("Serve: Preflight request")
 		// Check preflight, if any error, http error will raise
 		c.handlePreflight(ctx)
@@ -237,28 +237,30 @@ func (c *Cors) Serve(ctx *egret.Context) {
 			ctx.Next()
 		} else {
 			// If don't have by pass through, set status ok
-			ctx.SetStatusCode(http.StatusOK)
+			ctx.Response.Status = http.StatusOK
 			// Actual request will be serve
 		}
 
 	} else {
 		c.logf("Serve: Actual request")
 		c.handleActualRequest(ctx)
+		// the requests without CORS headers are served as well
+		ctx.Next()
 	}
 }
 
 // handlePreflight handles pre-flight CORS requests
 func (c *Cors) handlePreflight(ctx *egret.Context) bool {
-	origin := ctx.RequestHeader("Origin")
+	origin := ctx.Request.Header.Get("Origin")
 
-	if ctx.Method() != "OPTIONS" {
-		c.logf("  Preflight aborted: %s!=OPTIONS", ctx.Method())
+	if ctx.Request.Method != http.MethodOptions {
+		c.logf("  Preflight aborted: %s!=OPTIONS", ctx.Request.Method)
 		return false
 	}
 	// Always set Vary headers
-	ctx.Response.SetHeader("Vary", "Origin")
-	ctx.Response.SetHeader("Vary", "Access-Control-Request-Method")
-	ctx.Response.SetHeader("Vary", "Access-Control-Request-Headers")
+	ctx.Response.Header().Add("Vary", "Origin")
+	ctx.Response.Header().Add("Vary", "Access-Control-Request-Method")
+	ctx.Response.Header().Add("Vary", "Access-Control-Request-Headers")
 
 	if c.allowedOriginsAll {
 		origin = "*"
@@ -274,12 +276,12 @@ func (c *Cors) handlePreflight(ctx *egret.Context) bool {
 		return false
 	}
 
-	reqMethod := ctx.Request.Header().Get("Access-Control-Request-Method")
+	reqMethod := ctx.Request.Header.Get("Access-Control-Request-Method")
 	if !c.isMethodAllowed(reqMethod) {
 		c.logf("  Preflight aborted: method '%s' not allowed", reqMethod)
 		return false
 	}
-	reqHeaders := parseHeaderList(ctx.RequestHeader("Access-Control-Request-Headers"))
+	reqHeaders := parseHeaderList(ctx.Request.Header.Get("Access-Control-Request-Headers"))
 	if !c.areHeadersAllowed(reqHeaders) {
 		c.logf("  Preflight aborted: headers '%v' not allowed", reqHeaders)
 		return false
@@ -301,20 +303,20 @@ func (c *Cors) handlePreflight(ctx *egret.Context) bool {
 		ctx.Response.SetHeader("Access-Control-Max-Age", strconv.Itoa(c.maxAge))
 	}
 
-	c.logf("  Preflight response headers: %v", ctx.ResponseWriter.Header())
+	c.logf("  Preflight response headers: %v", ctx.Response.Header())
 	return true
 }
 
 // handleActualRequest handles simple cross-origin requests, actual request or redirects
 func (c *Cors) handleActualRequest(ctx *egret.Context) {
-	origin := ctx.RequestHeader("Origin")
+	origin := ctx.Request.Header.Get("Origin")
 
-	if ctx.Method() == egret.MethodOptions {
-		c.logf("  Actual request no headers added: method == %s", ctx.Method())
+	if ctx.Request.Method == http.MethodOptions {
+		c.logf("  Actual request no headers added: method == %s", ctx.Request.Method)
 		return
 	}
 
-	ctx.Response.SetHeader("Vary", "Origin")
+	ctx.Response.Header().Add("Vary", "Origin")
 	if c.allowedOriginsAll {
 		origin = "*"
 	}
@@ -332,8 +334,8 @@ func (c *Cors) handleActualRequest(ctx *egret.Context) {
 	// POST. Access-Control-Allow-Methods is only used for pre-flight requests and the
 	// spec doesn't instruct to check the allowed methods for simple cross-origin requests.
 	// We think it's a nice feature to be able to have control on those methods though.
-	if !c.isMethodAllowed(ctx.Method()) {
-		c.logf("  Actual request no headers added: method '%s' not allowed", ctx.Method())
+	if !c.isMethodAllowed(ctx.Request.Method) {
+		c.logf("  Actual request no headers added: method '%s' not allowed", ctx.Request.Method)
 		return
 	}
 	ctx.Response.SetHeader("Access-Control-Allow-Origin", origin)
@@ -343,8 +345,13 @@ func (c *Cors) handleActualRequest(ctx *egret.Context) {
 	if c.allowCredentials {
 		ctx.Response.SetHeader("Access-Control-Allow-Credentials", "true")
 	}
-	ctx.Next()
+}
 
+// logf writes a debugging message, if the Debug option is set
+func (c *Cors) logf(format string, a ...interface{}) {
+	if c.Log != nil {
+		c.Log.Printf(format, a...)
+	}
 }
 
 // isOriginAllowed checks if a given origin is allowed to perform cross-domain requests
@@ -378,7 +385,7 @@ func (c *Cors) isMethodAllowed(method string) bool {
 		return false
 	}
 	method = strings.ToUpper(method)
-	if method == egret.MethodOptions {
+	if method == http.MethodOptions {
 		// Always allow preflight requests
 		return true
 	}
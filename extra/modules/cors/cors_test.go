@@ -0,0 +1,69 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kenorld/egret"
+	"github.com/kenorld/egret/conf"
+	"go.uber.org/zap"
+)
+
+func serve(handler egret.HandlerFunc, method, origin string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(method, "/api/items", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	ctx := egret.NewContext(egret.NewRequest(r), egret.NewResponse(w))
+	ctx.Handlers = []egret.HandlerFunc{handler, func(ctx *egret.Context) {
+		ctx.Response.Write([]byte("items"))
+	}}
+	ctx.Next()
+	ctx.ExecuteRender()
+	return w
+}
+
+func TestConfiguredReload(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "app.yaml")
+	write := func(yaml string) {
+		if err := os.WriteFile(fpath, []byte(yaml), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cors:\n  allowed_origins: [https://a.example.com]\n  max_age: 60\n")
+	egret.Logger = zap.NewNop()
+	egret.Config, _ = conf.LoadContext("app", []string{dir})
+	handler := Configured()
+
+	w := serve(handler, "GET", "https://a.example.com")
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://a.example.com" {
+		t.Errorf("Expected the configured origin to be allowed, got %q", origin)
+	}
+	if w.Body.String() != "items" {
+		t.Errorf("Expected the request to be served, got %q", w.Body.String())
+	}
+	w = serve(handler, "OPTIONS", "https://a.example.com")
+	if maxAge := w.Header().Get("Access-Control-Max-Age"); maxAge != "60" {
+		t.Errorf("Expected the configured max age, got %q", maxAge)
+	}
+
+	write("cors:\n  allowed_origins: [https://b.example.com]\n")
+	if err := egret.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(handler, "GET", "https://a.example.com")
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Expected the reloaded options to reject the origin, got %q", origin)
+	}
+	if w.Body.String() != "items" {
+		t.Errorf("Expected the request without CORS headers to be served, got %q", w.Body.String())
+	}
+	w = serve(handler, "GET", "https://b.example.com")
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://b.example.com" {
+		t.Errorf("Expected the reloaded origin to be allowed, got %q", origin)
+	}
+}
@@ -39,6 +39,7 @@ func (i *i18nMiddleware) Serve(ctx *egret.Context) {
 		language = i.config.Default
 	}
 	locale := i18n.Locale{Lang: language}
+	ctx.Request.Locale = language
 	ctx.Set("language", language)
 	ctx.Set("translate", locale.Tr)
 	ctx.Next()
@@ -18,13 +18,27 @@ var (
 	selfConcurrent bool
 )
 
+// Config is the "jobs" section of app.yaml.
+type Config struct {
+	// Pool limits the number of jobs running concurrently, 0 meaning no limit.
+	// Default value: DefaultJobPoolSize.
+	Pool int `validate:"min=0"`
+	// SelfConcurrent allows a job to run concurrently with itself.
+	SelfConcurrent bool
+}
+
 func init() {
 	MainCron = cron.New()
+	egret.RegisterConfig("jobs", Config{})
 	egret.OnAppStart(func() {
-		if size := egret.Config.GetIntDefault("jobs.pool", DefaultJobPoolSize); size > 0 {
-			workPermits = make(chan struct{}, size)
+		cfg := Config{Pool: DefaultJobPoolSize}
+		if err := egret.Config.Bind("jobs", &cfg); err != nil {
+			panic("Invalid jobs configuration: " + err.Error())
+		}
+		if cfg.Pool > 0 {
+			workPermits = make(chan struct{}, cfg.Pool)
 		}
-		selfConcurrent = egret.Config.GetBoolDefault("jobs.self_concurrent", false)
+		selfConcurrent = cfg.SelfConcurrent
 		MainCron.Start()
 	})
 }
@@ -42,18 +42,20 @@ func (f Flash) Success(msg string, args ...interface{}) {
 func FlashHandler(ctx *Context) {
 	ctx.Flash = restoreFlash(ctx.Request.Request)
 	ctx.RenderArgs["flash"] = ctx.Flash.Data
-
-	// Store the flash.
-	var flashValue string
-	for key, value := range ctx.Flash.Out {
-		flashValue += "\x00" + key + ":" + value + "\x00"
-	}
-	ctx.SetCookie(&http.Cookie{
-		Name:     CookiePrefix + "_FLASH",
-		Value:    url.QueryEscape(flashValue),
-		HttpOnly: true,
-		Secure:   CookieSecure,
-		Path:     "/",
+	// Store the flash set by the handlers once the response is written,
+	// whether by them or once they returned.
+	ctx.Response.OnBeforeWrite(func() {
+		var flashValue string
+		for key, value := range ctx.Flash.Out {
+			flashValue += "\x00" + key + ":" + value + "\x00"
+		}
+		ctx.SetCookie(&http.Cookie{
+			Name:     CookiePrefix + "_FLASH",
+			Value:    url.QueryEscape(flashValue),
+			HttpOnly: true,
+			Secure:   CookieSecure,
+			Path:     "/",
+		})
 	})
 	ctx.Next()
 }
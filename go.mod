@@ -1,9 +1,10 @@
 module github.com/kenorld/egret
 
-go 1.14
+go 1.16
 
 require (
 	github.com/agtorre/gocolorize v1.0.0
+	github.com/andybalholm/brotli v1.0.4
 	github.com/bradfitz/gomemcache v0.0.0-20190913173617-a41fca850d0b
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/facebookgo/ensure v0.0.0-20200202191622-63f1cf65ac4c
@@ -11,17 +12,21 @@ require (
 	github.com/facebookgo/stack v0.0.0-20160209184415-751773369052 // indirect
 	github.com/facebookgo/subset v0.0.0-20200203212716-c811ad88dec4 // indirect
 	github.com/fsnotify/fsnotify v1.4.9
+	github.com/fxamacker/cbor/v2 v2.4.0
 	github.com/gomodule/redigo v1.8.1
 	github.com/imdario/mergo v0.3.9
 	github.com/klauspost/compress v1.10.5
 	github.com/microcosm-cc/bluemonday v1.0.2
+	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/spf13/cast v1.3.1
 	github.com/spf13/viper v1.7.0
 	github.com/stoewer/go-strcase v1.2.0
-	github.com/stretchr/testify v1.5.1
+	github.com/stretchr/testify v1.6.1
 	github.com/unknwon/i18n v0.0.0-20200329073805-1baf5be3c30e
 	github.com/valyala/bytebufferpool v1.0.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.uber.org/zap v1.15.0
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37
 	golang.org/x/net v0.0.0-20200506145744-7e3656a0809f
+	golang.org/x/text v0.3.2
 )
@@ -36,12 +36,24 @@ const (
 	ContentText = "text/plain"
 	// ContentXML header value for XML data.
 	ContentXML = "text/xml"
+	// ContentNDJSON header value for newline delimited JSON data.
+	ContentNDJSON = "application/x-ndjson"
+	// ContentCSV header value for CSV data.
+	ContentCSV = "text/csv"
+	// ContentMsgpack header value for MessagePack data.
+	ContentMsgpack = "application/msgpack"
+	// ContentCBOR header value for CBOR data.
+	ContentCBOR = "application/cbor"
+	// ContentJSONAPI header value for JSON:API documents.
+	ContentJSONAPI = "application/vnd.api+json"
+	// ContentHAL header value for HAL documents.
+	ContentHAL = "application/hal+json"
 )
 
 type Request struct {
 	*http.Request
 	ContentType     string
-	Format          string // "html", "xml", "json", or "txt"
+	Format          string // "html", "xml", "json", "txt", "msgpack" or "cbor"
 	AcceptLanguages AcceptLanguages
 	Locale          string
 	Websocket       *websocket.Conn
@@ -54,6 +66,7 @@ type Response struct {
 	Writer http.ResponseWriter
 
 	headerWrited bool
+	beforeWrite  []func()
 }
 
 func NewResponse(w http.ResponseWriter) *Response {
@@ -125,26 +138,71 @@ func (resp *Response) SetFormat(s string) {
 			s = "text/plain"
 		case "txt":
 			s = "text/plain"
+		case "msgpack":
+			s = ContentMsgpack
+		case "cbor":
+			s = ContentCBOR
+		case "jsonapi":
+			s = ContentJSONAPI
+		case "hal":
+			s = ContentHAL
 		}
 	}
-	if !cc {
+	// JSON:API forbids the media type parameters
+	if !cc && !isBinaryContentType(s) && s != ContentJSONAPI {
 		s += "; charset=utf-8"
 	}
 	resp.ContentType = s
 }
 
+// isBinaryContentType returns true for the content types without a charset.
+func isBinaryContentType(s string) bool {
+	switch s {
+	case ContentBinary, ContentMsgpack, ContentCBOR:
+		return true
+	}
+	return false
+}
+
 func (resp *Response) EnsureHeaderWrited() {
 	if !resp.headerWrited {
 		resp.headerWrited = true
+		resp.runBeforeWrite()
 		resp.SetHeader(ContentType, resp.ContentType)
 		resp.Writer.WriteHeader(resp.Status)
 	}
 }
+
+// OnBeforeWrite adds a func called once, before the header of the response
+// is written, e.g. to set the cookies of the handlers whether the response is
+// written by them or rendered once they returned.
+func (resp *Response) OnBeforeWrite(f func()) {
+	resp.beforeWrite = append(resp.beforeWrite, f)
+}
+
+// runBeforeWrite calls the funcs given to OnBeforeWrite, once, for the
+// responses written to the Writer without EnsureHeaderWrited as well.
+func (resp *Response) runBeforeWrite() {
+	funcs := resp.beforeWrite
+	resp.beforeWrite = nil
+	for _, f := range funcs {
+		f()
+	}
+}
+
 func (resp *Response) Write(data []byte) (int, error) {
 	resp.EnsureHeaderWrited()
 	return resp.Writer.Write(data)
 }
 
+// Flush sends the data written so far to the client, if the writer supports
+// it, e.g. while a serializer streams a collection.
+func (resp *Response) Flush() {
+	if f, ok := resp.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Get the content type.
 // e.g. From "multipart/form-data; boundary=--" to "multipart/form-data"
 // If none is specified, returns "text/html" by default.
@@ -157,9 +215,9 @@ func ResolveContentType(req *http.Request) string {
 }
 
 // ResolveFormat maps the request's Accept MIME type declaration to
-// a Request.Format attribute, specifically "html", "xml", "json", or "txt",
-// returning a default of "html" when Accept header cannot be mapped to a
-// value above.
+// a Request.Format attribute, specifically "html", "xml", "json", "txt",
+// "msgpack", "cbor", "jsonapi" or "hal", returning a default of "html" when
+// Accept header cannot be mapped to a value above.
 func ResolveFormat(req *http.Request) string {
 	accept := req.Header.Get("accept")
 
@@ -169,6 +227,15 @@ func ResolveFormat(req *http.Request) string {
 		strings.Contains(accept, "application/xhtml"),
 		strings.Contains(accept, "text/html"):
 		return "html"
+	case strings.Contains(accept, "application/msgpack"),
+		strings.Contains(accept, "application/x-msgpack"):
+		return "msgpack"
+	case strings.Contains(accept, "application/cbor"):
+		return "cbor"
+	case strings.Contains(accept, ContentJSONAPI):
+		return "jsonapi"
+	case strings.Contains(accept, ContentHAL):
+		return "hal"
 	case strings.Contains(accept, "application/json"),
 		strings.Contains(accept, "text/javascript"),
 		strings.Contains(accept, "application/javascript"):
@@ -0,0 +1,355 @@
+package egret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+const (
+	// CurrentLocaleRenderArg is the render argument holding the locale of the
+	// request, read by the i18n template funcs given the render arguments:
+	//
+	//      {{t . "hotels.count" "count" (len .Hotels)}}
+	CurrentLocaleRenderArg = "currentLocale"
+
+	// CountMessageArg is the named argument choosing the plural form of a message.
+	CountMessageArg = "count"
+
+	unknownMessageFormat = "??? %s ???"
+)
+
+var (
+	// MessagePaths where to look for the message files, named after their
+	// locale, e.g. messages/fr.yaml or messages/pt-BR.json.
+	// Ordered by priority. (Earlier paths take precedence over later paths.)
+	MessagePaths []string
+
+	// DefaultLocale is the locale of the requests not asking for any of the
+	// locales of the message files, set by "i18n.default_locale".
+	DefaultLocale = "en"
+
+	// messages the messages of each locale, by lower cased key.
+	messages      = map[string]map[string]string{}
+	localeTags    []language.Tag
+	localeMatcher language.Matcher
+
+	messageArgPattern = regexp.MustCompile(`\{(\w+)\}`)
+	pluralForms       = map[plural.Form]string{
+		plural.Other: "other",
+		plural.Zero:  "zero",
+		plural.One:   "one",
+		plural.Two:   "two",
+		plural.Few:   "few",
+		plural.Many:  "many",
+	}
+)
+
+// initI18n loads the message files of the application and its modules.
+func initI18n() {
+	DefaultLocale = Config.GetStringDefault("i18n.default_locale", DefaultLocale)
+	MessagePaths = []string{filepath.Join(BasePath, "messages")}
+	for _, module := range Modules {
+		MessagePaths = append(MessagePaths, filepath.Join(module.Path, "messages"))
+	}
+	if err := loadMessages(MessagePaths); err != nil {
+		Logger.Fatal("Failed to load the messages", zap.Error(err))
+	}
+}
+
+// loadMessages reads the message files of the paths, the keys of nested
+// sections being joined by dots, as for app.yaml. A message with plural
+// forms is a section of the CLDR plural categories of its locale, and of
+// exact counts:
+//
+//      hotels:
+//        count:
+//          0: No hotel
+//          one: One hotel
+//          other: "{count} hotels"
+func loadMessages(paths []string) error {
+	loaded := map[string]map[string]string{}
+	var tags []language.Tag
+	for i := len(paths) - 1; i >= 0; i-- {
+		files, err := ioutil.ReadDir(paths[i])
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			if file.IsDir() || !ContainsString(conf.Extensions, ext) {
+				continue
+			}
+			tag, err := language.Parse(strings.TrimSuffix(file.Name(), ext))
+			if err != nil {
+				return fmt.Errorf("message file %s is not named after a locale: %s", file.Name(), err)
+			}
+
+			v := viper.New()
+			v.SetConfigFile(filepath.Join(paths[i], file.Name()))
+			if err := v.ReadInConfig(); err != nil {
+				return err
+			}
+			locale := tag.String()
+			if loaded[locale] == nil {
+				loaded[locale] = map[string]string{}
+				tags = append(tags, tag)
+			}
+			for _, key := range v.AllKeys() {
+				loaded[locale][key] = v.GetString(key)
+			}
+		}
+	}
+
+	messages, localeTags = loaded, tags
+	localeMatcher = language.NewMatcher(tags)
+	return nil
+}
+
+// MessageLocales returns the locales of the loaded message files.
+func MessageLocales() []string {
+	locales := make([]string, len(localeTags))
+	for i, tag := range localeTags {
+		locales[i] = tag.String()
+	}
+	return locales
+}
+
+// ResolveLocale returns the locale of the messages for a request: the one
+// of the "i18n.cookie" cookie, else the best match of the Accept-Language
+// header, else DefaultLocale.
+func ResolveLocale(r *Request) string {
+	if len(localeTags) == 0 {
+		return DefaultLocale
+	}
+	if cookie, err := r.Cookie(Config.GetStringDefault("i18n.cookie", CookiePrefix+"_LANG")); err == nil {
+		if tag, err := language.Parse(cookie.Value); err == nil {
+			if _, ok := messages[tag.String()]; ok {
+				return tag.String()
+			}
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil && len(tags) > 0 {
+		if _, index, confidence := localeMatcher.Match(tags...); confidence != language.No {
+			return localeTags[index].String()
+		}
+	}
+	return DefaultLocale
+}
+
+// Message returns the message of key for locale, falling back to the
+// messages of its language then of DefaultLocale. The {name} placeholders
+// of the message are replaced by the named arguments, given as name, value
+// pairs or as a map, the "count" argument choosing the plural form:
+//
+//      egret.Message("fr", "hotels.count", "count", 3, "city", "Paris")
+func Message(locale string, key string, args ...interface{}) string {
+	named := messageArgs(args)
+	key = strings.ToLower(key)
+	keys := []string{key}
+	if count, ok := named[CountMessageArg]; ok {
+		keys = append([]string{key + "." + cast.ToString(count), key + "." + pluralForm(locale, count)}, key+".other", key)
+	}
+
+	for _, candidate := range localeCandidates(locale) {
+		for _, k := range keys {
+			if text, ok := messages[candidate][k]; ok {
+				return messageArgPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+					value, ok := named[placeholder[1:len(placeholder)-1]]
+					if !ok {
+						return placeholder
+					}
+					switch value.(type) {
+					case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+						return FormatNumber(locale, value)
+					}
+					return cast.ToString(value)
+				})
+			}
+		}
+	}
+	return fmt.Sprintf(unknownMessageFormat, key)
+}
+
+// Message returns the message of key for the locale of the request.
+func (c *Context) Message(key string, args ...interface{}) string {
+	return Message(c.Request.Locale, key, args...)
+}
+
+// FormatDate formats a date with the "format.date" message of locale, or
+// by default the application's date format.
+func FormatDate(locale string, date time.Time) string {
+	return date.Format(localeFormat(locale, "format.date", DateFormat))
+}
+
+// FormatDateTime formats a date with the "format.datetime" message of
+// locale, or by default the application's datetime format.
+func FormatDateTime(locale string, date time.Time) string {
+	return date.Format(localeFormat(locale, "format.datetime", DateTimeFormat))
+}
+
+// FormatNumber formats a number with the separators of locale, with the
+// given number of decimals if any.
+func FormatNumber(locale string, value interface{}, decimals ...int) string {
+	var options []number.Option
+	if len(decimals) > 0 {
+		options = append(options, number.MinFractionDigits(decimals[0]), number.MaxFractionDigits(decimals[0]))
+	}
+	return message.NewPrinter(localeTag(locale)).Sprint(number.Decimal(value, options...))
+}
+
+// FormatCurrency formats an amount of the currency of the given ISO code,
+// e.g. "EUR", with the "format.currency" message of locale, "{symbol}{amount}"
+// by default.
+func FormatCurrency(locale string, amount interface{}, code string) (string, error) {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", err
+	}
+	tag := localeTag(locale)
+	scale, _ := currency.Standard.Rounding(unit)
+	printer := message.NewPrinter(tag)
+	return strings.NewReplacer(
+		"{symbol}", printer.Sprint(currency.Symbol(unit)),
+		"{amount}", FormatNumber(locale, amount, scale),
+	).Replace(localeFormat(locale, "format.currency", "{symbol}{amount}")), nil
+}
+
+// messageArgs returns the named arguments of a message.
+func messageArgs(args []interface{}) map[string]interface{} {
+	if len(args) == 1 {
+		if named, ok := args[0].(map[string]interface{}); ok {
+			return named
+		}
+	}
+	named := make(map[string]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		named[cast.ToString(args[i])] = args[i+1]
+	}
+	return named
+}
+
+// pluralForm returns the CLDR plural category of count in locale.
+func pluralForm(locale string, count interface{}) string {
+	digits := strconv.FormatFloat(math.Abs(cast.ToFloat64(count)), 'f', -1, 64)
+	integer, fraction := digits, ""
+	if dot := strings.IndexByte(digits, '.'); dot != -1 {
+		integer, fraction = digits[:dot], digits[dot+1:]
+	}
+	trimmed := strings.TrimRight(fraction, "0")
+	i, _ := strconv.Atoi(integer)
+	f, _ := strconv.Atoi("0" + fraction)
+	t, _ := strconv.Atoi("0" + trimmed)
+	return pluralForms[plural.Cardinal.MatchPlural(localeTag(locale), i, len(fraction), len(trimmed), f, t)]
+}
+
+// localeCandidates returns the locales to look for the messages of locale.
+func localeCandidates(locale string) []string {
+	candidates := []string{}
+	if tag, err := language.Parse(locale); err == nil {
+		candidates = append(candidates, tag.String())
+		if base, confidence := tag.Base(); confidence != language.No && base.String() != tag.String() {
+			candidates = append(candidates, base.String())
+		}
+	}
+	if len(candidates) == 0 || candidates[0] != DefaultLocale {
+		candidates = append(candidates, DefaultLocale)
+	}
+	return candidates
+}
+
+func localeTag(locale string) language.Tag {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.English
+	}
+	return tag
+}
+
+// localeFormat returns the format of key in the messages of locale.
+func localeFormat(locale string, key string, defaultFormat string) string {
+	for _, candidate := range localeCandidates(locale) {
+		if format, ok := messages[candidate][key]; ok {
+			return format
+		}
+	}
+	return defaultFormat
+}
+
+// templateLocale returns the locale of the render arguments given as first
+// argument of an i18n template func, and the other arguments.
+func templateLocale(args []interface{}) (string, []interface{}) {
+	if len(args) > 0 {
+		if renderArgs, ok := args[0].(map[string]interface{}); ok {
+			return cast.ToString(renderArgs[CurrentLocaleRenderArg]), args[1:]
+		}
+	}
+	return DefaultLocale, args
+}
+
+// templateMessage is the "t" and "msg" template func:
+//
+//      {{t . "greeting" "name" .User.Name}}
+func templateMessage(renderArgs map[string]interface{}, key string, args ...interface{}) string {
+	locale, _ := templateLocale([]interface{}{renderArgs})
+	return Message(locale, key, args...)
+}
+
+// templateTime returns the "date" or "datetime" template funcs, given the
+// date and, optionally first, the render arguments: {{date . .Booking.CheckIn}}
+func templateTime(format func(string, time.Time) string) func(...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		locale, args := templateLocale(args)
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected a date, got %d arguments", len(args))
+		}
+		date, err := cast.ToTimeE(args[0])
+		if err != nil {
+			return "", err
+		}
+		return format(locale, date), nil
+	}
+}
+
+// templateNumber is the "number" template func, given the number, the
+// number of decimals if any and, optionally first, the render arguments:
+// {{number . .Total 2}}
+func templateNumber(args ...interface{}) (string, error) {
+	locale, args := templateLocale(args)
+	if len(args) == 0 || len(args) > 2 {
+		return "", fmt.Errorf("expected a number and its decimals, got %d arguments", len(args))
+	}
+	if len(args) == 2 {
+		return FormatNumber(locale, args[0], cast.ToInt(args[1])), nil
+	}
+	return FormatNumber(locale, args[0]), nil
+}
+
+// templateCurrency is the "currency" template func, given the amount, the
+// currency code and, optionally first, the render arguments:
+// {{currency . .Booking.Total "EUR"}}
+func templateCurrency(args ...interface{}) (string, error) {
+	locale, args := templateLocale(args)
+	if len(args) != 2 {
+		return "", fmt.Errorf("expected an amount and a currency, got %d arguments", len(args))
+	}
+	return FormatCurrency(locale, args[0], cast.ToString(args[1]))
+}
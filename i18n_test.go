@@ -0,0 +1,110 @@
+package egret
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMessages = map[string]string{
+	"en.yaml": `
+greeting: "Hello {name}"
+hotels:
+  count:
+    0: No hotel in {city}
+    one: One hotel in {city}
+    other: "{count} hotels in {city}"
+`,
+	"fr.yaml": `
+greeting: "Bonjour {name}"
+hotels:
+  count:
+    one: "{count} hôtel à {city}"
+    other: "{count} hôtels à {city}"
+format:
+  date: "02/01/2006"
+  currency: "{amount} {symbol}"
+`,
+	"ru.json": `{"hotels": {"count": {"one": "{count} отель", "few": "{count} отеля", "many": "{count} отелей"}}}`,
+}
+
+func loadTestMessages(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-messages")
+	defer os.RemoveAll(dir)
+	for name, content := range testMessages {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666)
+	}
+	Config, _ = conf.LoadContext("app", nil)
+	assert.Nil(t, loadMessages([]string{dir}))
+}
+
+func TestMessage(t *testing.T) {
+	loadTestMessages(t)
+	assert.ElementsMatch(t, []string{"en", "fr", "ru"}, MessageLocales())
+
+	tests := []struct {
+		locale, key string
+		args        []interface{}
+		expected    string
+	}{
+		{"en", "greeting", []interface{}{"name", "Bob"}, "Hello Bob"},
+		{"fr-CA", "greeting", []interface{}{map[string]interface{}{"name": "Bob"}}, "Bonjour Bob"},
+		{"de", "greeting", nil, "Hello {name}"},
+		{"en", "hotels.count", []interface{}{"count", 0, "city", "Paris"}, "No hotel in Paris"},
+		{"en", "hotels.count", []interface{}{"count", 1, "city", "Paris"}, "One hotel in Paris"},
+		{"en", "hotels.count", []interface{}{"count", 1200, "city", "Paris"}, "1,200 hotels in Paris"},
+		{"fr", "hotels.count", []interface{}{"count", 0, "city", "Paris"}, "0 hôtel à Paris"},
+		{"fr", "hotels.count", []interface{}{"count", 1.5, "city", "Paris"}, "1,5 hôtel à Paris"},
+		{"ru", "hotels.count", []interface{}{"count", 3}, "3 отеля"},
+		{"ru", "hotels.count", []interface{}{"count", 25}, "25 отелей"},
+		{"ru", "hotels.count", []interface{}{"count", 21}, "21 отель"},
+		{"en", "missing", nil, "??? missing ???"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Message(test.locale, test.key, test.args...), "%s %s %v", test.locale, test.key, test.args)
+	}
+}
+
+func TestResolveLocale(t *testing.T) {
+	loadTestMessages(t)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	assert.Equal(t, "en", ResolveLocale(NewRequest(r)))
+	r.Header.Set("Accept-Language", "de-DE, fr-CH;q=0.8, en;q=0.5")
+	assert.Equal(t, "fr", ResolveLocale(NewRequest(r)))
+	r.AddCookie(&http.Cookie{Name: CookiePrefix + "_LANG", Value: "ru"})
+	assert.Equal(t, "ru", ResolveLocale(NewRequest(r)))
+}
+
+func TestLocaleFormats(t *testing.T) {
+	loadTestMessages(t)
+	DateFormat = DefaultDateFormat
+	date := time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)
+	args := map[string]interface{}{CurrentLocaleRenderArg: "fr"}
+
+	result, err := templateTime(FormatDate)(args, date)
+	assert.Nil(t, err)
+	assert.Equal(t, "17/05/2020", result)
+	result, _ = templateTime(FormatDate)(date)
+	assert.Equal(t, "2020-05-17", result)
+
+	result, _ = templateNumber(args, 1234567.891)
+	assert.Equal(t, "1 234 567,891", result)
+	result, _ = templateNumber(1234.5, 2)
+	assert.Equal(t, "1,234.50", result)
+
+	result, _ = templateCurrency(args, 1234.5, "EUR")
+	assert.Equal(t, "1 234,50 €", result)
+	result, _ = templateCurrency(map[string]interface{}{CurrentLocaleRenderArg: "en"}, 1234, "JPY")
+	assert.Equal(t, "¥1,234", result)
+	_, err = templateCurrency(args, 1, "EURO")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, "Bonjour Ann", templateMessage(args, "greeting", "name", "Ann"))
+}
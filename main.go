@@ -7,6 +7,7 @@ import (
 	"go/build"
 	"html"
 	htmpl "html/template"
+	"io/fs"
 	"log"
 	"os"
 	"path"
@@ -15,13 +16,15 @@ import (
 	"regexp"
 	"sort"
 	"strings"
-	"time"
 
 	conf "github.com/kenorld/egret/conf"
 	"github.com/kenorld/egret/core/logging"
 	"github.com/kenorld/egret/core/serializer"
+	"github.com/kenorld/egret/core/serializer/hal"
+	"github.com/kenorld/egret/core/serializer/jsonapi"
 	"github.com/kenorld/egret/core/template"
 	"github.com/kenorld/egret/core/template/native"
+	"github.com/kenorld/egret/core/views"
 	"github.com/spf13/cast"
 	strcase "github.com/stoewer/go-strcase"
 
@@ -59,6 +62,10 @@ var (
 	CodePaths     []string
 	TemplatePaths []string
 
+	// EmbeddedFS holds the files of the application embedded in its binary by
+	// "egret build", its views are loaded from it rather than from the disk.
+	EmbeddedFS fs.FS
+
 	// ConfPaths where to look for configurations
 	// Config load order
 	// 1. framework (egret/conf/*)
@@ -112,13 +119,17 @@ var (
 
 	SharedTemplateFunc = map[string]interface{}{
 		"url": ReverseURL,
-		// Format a date according to the application's default date(time) format.
-		"date": func(date time.Time) string {
-			return date.Format(DateFormat)
-		},
-		"datetime": func(date time.Time) string {
-			return date.Format(DateTimeFormat)
-		},
+		// Returns the fingerprinted URL of a static file.
+		"asset": AssetURL,
+		// Translate a message in the request locale, see Message.
+		"t":   templateMessage,
+		"msg": templateMessage,
+		// Format a date according to the locale's, or by default the application's, date(time) format.
+		"date":     templateTime(FormatDate),
+		"datetime": templateTime(FormatDateTime),
+		// Format a number, or an amount of a currency, according to the locale.
+		"number":   templateNumber,
+		"currency": templateCurrency,
 
 		"set": func(renderArgs map[string]interface{}, key string, value interface{}) htmpl.JS {
 			renderArgs[key] = value
@@ -156,14 +167,6 @@ var (
 			return htmpl.HTML(html.EscapeString(str) + strings.Repeat("&nbsp;", width-len(str)))
 		},
 
-		// "msg": func(renderArgs map[string]interface{}, message string, args ...interface{}) htmpl.HTML {
-		// 	str, ok := renderArgs[CurrentLocaleRenderArg].(string)
-		// 	if !ok {
-		// 		return ""
-		// 	}
-		// 	return htmpl.HTML(MessageFunc(str, message, args...))
-		// },
-
 		// Replaces newlines with <br>
 		"nl2br": func(text string) htmpl.HTML {
 			return htmpl.HTML(strings.Replace(htmpl.HTMLEscapeString(text), "\n", "<br>", -1))
@@ -287,10 +290,18 @@ func Init(mode, importPath, appSrcPath string) {
 		Logger.Fatal("Failed to load app.yaml", zap.Error(err))
 	}
 
+	// Every key can be overridden by an EGRET_ environment variable,
+	// e.g. EGRET_SERVE_PORT, or EGRET_SECRET=secret_file:/run/secrets/egret
+	// for a mounted secret.
+	Config.SetEnvPrefix(conf.DefaultEnvPrefix)
+
 	// if !Config.IsSet(mode) {
 	// 	log.Fatalln("app.yaml: No mode found:", mode)
 	// }
 	Config.SetSection(mode)
+	if err := Config.Validate(); err != nil {
+		Logger.Fatal("Invalid app.yaml", zap.Error(err))
+	}
 
 	initLog()
 
@@ -342,11 +353,15 @@ func Init(mode, importPath, appSrcPath string) {
 		zap.Strings("ConfPaths", ConfPaths),
 		zap.Strings("TemplatePaths", TemplatePaths),
 	)
-	Logger.Info("Egret initialized", zap.String("version", Version), zap.String("build_date", BuildDate), zap.String("miniumn_go_version", MinimumGoVersion))
+	Logger.Info("Egret initialized", zap.String("version", Version), zap.String("build_date", BuildDate), zap.String("miniumn_go_version", MinimumGoVersion),
+		zap.String("app_version", AppVersion), zap.String("app_build_time", AppBuildTime))
 
+	initAssets()
 	initTemplate()
 	initSerializer()
+	initDataReaders()
 	loadModules()
+	initI18n()
 	Initialized = true
 	runStartupHooks()
 }
@@ -356,34 +371,56 @@ func initTemplate() {
 	if Config.GetBoolDefault("template.native.enabled", false) {
 		bpath := Config.GetStringDefault(filepath.Join(BasePath, "template.native.root"), filepath.Join(BasePath, "views"))
 		cfg := native.Config{Layout: Config.GetStringDefault("template.native.layout", template.NoLayout)}
-		tmpl := native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".html")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".json")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".xml")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".txt")
-
-		bpath = filepath.Join(EgretPath, "core", "views")
+		if embeddedViews() {
+			appViews, err := fs.Sub(EmbeddedFS, "views")
+			if err != nil {
+				Logger.Fatal("Failed to open the embedded views", zap.Error(err))
+			}
+			useNativeTemplates(cfg, appViews, ".")
+		} else {
+			useNativeTemplates(cfg, nil, bpath)
+		}
+
+		// The views of Egret are embedded, for the binaries deployed without them.
 		cfg = native.Config{Layout: template.NoLayout}
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".html")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".json")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".xml")
-		tmpl = native.New(cfg)
-		UseTemplate(tmpl).Register(bpath, ".txt")
-	}
-	MainTemplateManager.Refresh()
+		if bpath = filepath.Join(EgretPath, "core", "views"); DirExists(bpath) {
+			useNativeTemplates(cfg, nil, bpath)
+		} else {
+			useNativeTemplates(cfg, views.FS, ".")
+		}
+	}
+	if err := MainTemplateManager.Refresh(); err != nil {
+		Logger.Error("Failed to parse the templates", zap.Error(err))
+	}
+	if DevMode && Config.GetBoolDefault("watch.enabled", true) && Config.GetBoolDefault("watch.templates", true) {
+		watchTemplates()
+	}
+}
+
+// embeddedViews returns true if the views are embedded, egret build embedding
+// them unless they are left out of build.embed.
+func embeddedViews() bool {
+	if EmbeddedFS == nil {
+		return false
+	}
+	info, err := fs.Stat(EmbeddedFS, "views")
+	return err == nil && info.IsDir()
 }
 
 func initSerializer() {
 	MainSerializerManager = serializer.NewManager()
+	// the hypermedia serializers link the resources to their named routes
+	MainSerializerManager.For(jsonapi.ContentType, jsonapi.New(jsonapi.Config{Link: reverseLink}))
+	MainSerializerManager.For(hal.ContentType, hal.New(hal.Config{Link: reverseLink}))
 	serializer.RegisterDefaults(MainSerializerManager)
 }
 
+// reverseLink is the resource.LinkFunc of the serializers, reversing the
+// named routes of the routers.
+func reverseLink(route string, params map[string]interface{}) (string, error) {
+	return ReverseURL(route, params)
+}
+
 func initLog() {
 	rawConfig := Config.GetStringMap("logger")
 	if rawConfig["output_paths"] == nil {
@@ -423,6 +460,8 @@ func initLog() {
 	if err != nil {
 		panic(err)
 	}
+	// Keep the level, so it can be changed by reloading the configuration.
+	logLevel = cfg.Level
 	Logger.Sync()
 	Logger = logger
 }
@@ -540,6 +579,18 @@ func UseTemplate(tmpl template.Template) *template.Loader {
 	return MainTemplateManager.AddTemplate(tmpl)
 }
 
+// useNativeTemplates adds a native template engine for each of the template
+// extensions, loading from the directory of fsys, or of the disk if nil.
+func useNativeTemplates(cfg native.Config, fsys fs.FS, dir string) {
+	for _, ext := range []string{".html", ".json", ".xml", ".txt"} {
+		if fsys != nil {
+			UseTemplate(native.New(cfg)).RegisterFS(fsys, dir, ext)
+		} else {
+			UseTemplate(native.New(cfg)).Register(dir, ext)
+		}
+	}
+}
+
 // ResolveImportPath returns the filesystem path for the given import path.
 // Returns an error if the import path could not be found.
 func ResolveImportPath(importPath string) (string, error) {
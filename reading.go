@@ -5,10 +5,18 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/kenorld/egret/core/serializer"
+	ejson "github.com/kenorld/egret/core/serializer/json"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // DataReader is used by Context.Read() to read data from an HTTP request.
@@ -28,22 +36,193 @@ var (
 		"application/json":                  &JSONDataReader{},
 		"application/xml":                   &XMLDataReader{},
 		"text/xml":                          &XMLDataReader{},
+		"application/msgpack":               &MsgpackDataReader{},
+		"application/x-msgpack":             &MsgpackDataReader{},
+		"application/cbor":                  &CBORDataReader{},
 	}
 	// DefaultFormDataReader is the reader used when there is no matching reader in DataReaders
 	// or if the current request is a GET request.
 	DefaultFormDataReader DataReader = &FormDataReader{}
 )
 
-// JSONDataReader reads the request body as JSON-formatted data.
-type JSONDataReader struct{}
+// JSONDataReader reads the request body as JSON-formatted data, with
+// ejson.DefaultCodec. The default reader of DataReaders is configured by the
+// "read.json" section of app.yaml.
+//
+// The body errors are *Error with Status 400, and the line and column of the
+// error if known, to set as the error of the context:
+//
+//      if err := c.Read(&booking); err != nil {
+//          c.RenderError(err)
+//          return
+//      }
+type JSONDataReader struct {
+	// DisallowUnknownFields rejects the objects with keys which don't match
+	// any field of the data.
+	DisallowUnknownFields bool
+	// UseNumber decodes the numbers in an interface{} as json.Number instead
+	// of float64.
+	UseNumber bool
+	// MaxDepth rejects the bodies nesting more arrays and objects, 0 for no
+	// limit.
+	MaxDepth int
+	// MaxSize rejects the bodies bigger than it, in bytes, 0 for no limit.
+	MaxSize int
+}
 
 func readRequestBody(req *Request) io.Reader {
 	body, _ := ioutil.ReadAll(req.Body)
 	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 	return bytes.NewBuffer(body)
 }
+
 func (r *JSONDataReader) Read(req *Request, data interface{}) error {
-	return json.NewDecoder(readRequestBody(req)).Decode(data)
+	var reader io.Reader = req.Body
+	if r.MaxSize > 0 {
+		reader = io.LimitReader(req.Body, int64(r.MaxSize)+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	if r.MaxSize > 0 && len(body) > r.MaxSize {
+		return newBadRequestError(fmt.Sprintf("request body larger than %d bytes", r.MaxSize), nil, -1)
+	}
+	if r.MaxDepth > 0 {
+		if offset := jsonDepthOffset(body, r.MaxDepth); offset >= 0 {
+			return newBadRequestError(fmt.Sprintf("JSON nested deeper than %d levels", r.MaxDepth), body, offset)
+		}
+	}
+
+	dec := ejson.DefaultCodec.NewDecoder(bytes.NewReader(body))
+	if r.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if r.UseNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(data); err != nil {
+		return jsonBodyError(err, body)
+	}
+	return nil
+}
+
+// jsonBodyError returns the 400 error of a JSON body which couldn't be decoded.
+func jsonBodyError(err error, body []byte) *Error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// the offsets follow the byte of the error
+		return newBadRequestError(e.Error(), body, int(e.Offset)-1)
+	case *json.UnmarshalTypeError:
+		return newBadRequestError(e.Error(), body, int(e.Offset)-1)
+	}
+	if err == io.EOF {
+		return newBadRequestError("empty JSON body", nil, -1)
+	}
+	if err == io.ErrUnexpectedEOF {
+		return newBadRequestError("unexpected end of JSON input", body, len(body))
+	}
+	// the errors of DisallowUnknownFields don't tell where the field is
+	if strings.HasPrefix(err.Error(), unknownFieldError) {
+		if name, uerr := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldError)); uerr == nil {
+			return newBadRequestError(err.Error(), body, jsonKeyOffset(body, name))
+		}
+	}
+	return newBadRequestError(err.Error(), nil, -1)
+}
+
+// unknownFieldError is the prefix of the errors of DisallowUnknownFields.
+const unknownFieldError = "json: unknown field "
+
+// jsonKeyOffset returns the offset of the first key of an object named name
+// in body, -1 if there is none.
+func jsonKeyOffset(body []byte, name string) int {
+	type frame struct{ object, key bool }
+	var stack []frame
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return -1
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				// the next token of the parent object is a key
+				if n := len(stack); n > 0 && stack[n-1].object {
+					stack[n-1].key = true
+				}
+				stack = append(stack, frame{object: delim == '{', key: delim == '{'})
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if n := len(stack); n > 0 && stack[n-1].object {
+			if stack[n-1].key && token == name {
+				// the offset follows the key
+				return int(dec.InputOffset()) - len(strconv.Quote(name))
+			}
+			stack[n-1].key = !stack[n-1].key
+		}
+	}
+}
+
+// newBadRequestError returns the 400 error of a request body, at the byte of
+// the given offset in the body if it isn't negative.
+func newBadRequestError(summary string, body []byte, offset int) *Error {
+	e := &Error{
+		Status:  http.StatusBadRequest,
+		Name:    "bad_request",
+		Title:   "Bad Request",
+		Summary: summary,
+	}
+	if offset >= 0 && offset <= len(body) {
+		e.Line = bytes.Count(body[:offset], []byte("\n")) + 1
+		e.Column = offset - bytes.LastIndexByte(body[:offset], '\n')
+		e.Summary = fmt.Sprintf("%s (line %d, column %d)", summary, e.Line, e.Column)
+	}
+	return e
+}
+
+// jsonDepthOffset returns the offset of the first array or object nested
+// deeper than maxDepth in body, -1 if none is.
+func jsonDepthOffset(body []byte, maxDepth int) int {
+	depth, inString, escaped := 0, false, false
+	for i, b := range body {
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			if depth++; depth > maxDepth {
+				return i
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return -1
+}
+
+// initDataReaders configures the JSON data reader of DataReaders, unless the
+// application replaced it.
+func initDataReaders() {
+	if r, ok := DataReaders[ContentJSON].(*JSONDataReader); ok {
+		*r = JSONDataReader{
+			DisallowUnknownFields: Config.GetBoolDefault("read.json.disallow_unknown_fields", false),
+			UseNumber:             Config.GetBoolDefault("read.json.use_number", false),
+			MaxDepth:              Config.GetIntDefault("read.json.max_depth", 0),
+			MaxSize:               Config.GetIntDefault("read.json.max_size", 0),
+		}
+	}
 }
 
 // XMLDataReader reads the request body as XML-formatted data.
@@ -53,6 +232,43 @@ func (r *XMLDataReader) Read(req *Request, data interface{}) error {
 	return xml.NewDecoder(readRequestBody(req)).Decode(data)
 }
 
+// MsgpackDataReader reads the request body as MessagePack-formatted data.
+type MsgpackDataReader struct{}
+
+func (r *MsgpackDataReader) Read(req *Request, data interface{}) error {
+	return msgpack.NewDecoder(readRequestBody(req)).Decode(data)
+}
+
+// CBORDataReader reads the request body as CBOR-formatted data.
+type CBORDataReader struct{}
+
+func (r *CBORDataReader) Read(req *Request, data interface{}) error {
+	return cbor.NewDecoder(readRequestBody(req)).Decode(data)
+}
+
+// SerializerDataReader reads the request body with a serializer which also
+// reads its format, e.g. the JSON:API one reading the resource object of a
+// request document, see package resource for the resources. Context.Read()
+// uses it for the content types without a reader in DataReaders whose
+// serializer in MainSerializerManager is a serializer.Deserializer.
+//
+// The bodies which can't be read are *Error with Status 400.
+type SerializerDataReader struct {
+	Deserializer serializer.Deserializer
+}
+
+func (r *SerializerDataReader) Read(req *Request, data interface{}) error {
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	if err := r.Deserializer.Deserialize(body, data); err != nil {
+		return jsonBodyError(err, body)
+	}
+	return nil
+}
+
 // FormDataReader reads the query parameters and request body as form data.
 type FormDataReader struct{}
 
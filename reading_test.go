@@ -2,10 +2,14 @@ package egret
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"testing"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/kenorld/egret/core/serializer"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 type FA struct {
@@ -57,6 +61,8 @@ func TestReadForm(t *testing.T) {
 }
 
 func TestDefaultDataReader(t *testing.T) {
+	msgpackBody, _ := msgpack.Marshal(map[string]interface{}{"A1": "abc", "A2": 100})
+	cborBody, _ := cbor.Marshal(map[string]interface{}{"A1": "abc", "A2": 100})
 	tests := []struct {
 		tag         string
 		header      string
@@ -68,6 +74,8 @@ func TestDefaultDataReader(t *testing.T) {
 		{"t3", "application/x-www-form-urlencoded", "POST", "/test", "A1=abc&A2=100"},
 		{"t4", "application/json", "POST", "/test", `{"A1":"abc","A2":100}`},
 		{"t5", "application/xml", "POST", "/test", `<data><A1>abc</A1><A2>100</A2></data>`},
+		{"t6", "application/msgpack", "POST", "/test", string(msgpackBody)},
+		{"t7", "application/cbor", "POST", "/test", string(cborBody)},
 	}
 
 	expected := FA{
@@ -84,3 +92,65 @@ func TestDefaultDataReader(t *testing.T) {
 		assert.Equal(t, expected, data, test.tag)
 	}
 }
+
+func TestJSONDataReaderOptions(t *testing.T) {
+	type booking struct {
+		Hotel  string
+		Nights int
+		Extra  interface{}
+	}
+	tests := []struct {
+		reader   JSONDataReader
+		body     string
+		line     int
+		column   int
+		expected string
+	}{
+		{JSONDataReader{}, "{\n  \"Hotel\": \"Hilton\",\n  \"Nights\": \"two\"\n}", 3, 17, "cannot unmarshal string"},
+		{JSONDataReader{}, "{\"Hotel\": \"Hilton\",\n \"Nights\": 2,}", 2, 14, "invalid character '}'"},
+		{JSONDataReader{}, `{"Hotel": "Hil`, 1, 15, "unexpected end of JSON input"},
+		{JSONDataReader{}, ``, 0, 0, "empty JSON body"},
+		{JSONDataReader{DisallowUnknownFields: true}, `{"Hotel": "Hilton", "Room": 12}`, 1, 21, `unknown field "Room"`},
+		{JSONDataReader{DisallowUnknownFields: true}, "{\"Hotel\": \"Room\", \"Extra\": [\"Room\"],\n  \"Room\": 12}", 2, 3, `unknown field "Room"`},
+		{JSONDataReader{MaxSize: 10}, `{"Hotel": "Hilton"}`, 0, 0, "larger than 10 bytes"},
+		{JSONDataReader{MaxDepth: 2}, `{"Extra": {"a": "[{", "b": [[1]]}}`, 1, 28, "nested deeper than 2 levels"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("POST", "/bookings", bytes.NewBufferString(test.body))
+		var data booking
+		err := test.reader.Read(NewRequest(req), &data)
+		if assert.IsType(t, &Error{}, err, test.body) {
+			e := err.(*Error)
+			assert.Equal(t, http.StatusBadRequest, e.Status, test.body)
+			assert.Equal(t, test.line, e.Line, test.body)
+			assert.Equal(t, test.column, e.Column, test.body)
+			assert.Contains(t, e.Summary, test.expected, test.body)
+		}
+	}
+
+	var data booking
+	reader := JSONDataReader{DisallowUnknownFields: true, UseNumber: true, MaxDepth: 2, MaxSize: 100}
+	req, _ := http.NewRequest("POST", "/bookings", bytes.NewBufferString(`{"Hotel": "Hilton", "Extra": {"rate": 1.5}}`))
+	assert.Nil(t, reader.Read(NewRequest(req), &data))
+	assert.Equal(t, map[string]interface{}{"rate": json.Number("1.5")}, data.Extra)
+}
+
+func TestSerializerDataReader(t *testing.T) {
+	MainSerializerManager = serializer.NewManager()
+	serializer.RegisterDefaults(MainSerializerManager)
+	var reservation testReservation
+	req, _ := http.NewRequest("POST", "/reservations", bytes.NewBufferString(
+		`{"data": {"type": "reservations", "id": "7", "relationships": {"hotel": {"data": {"type": "hotels", "id": "3"}}}}}`))
+	req.Header.Set(ContentType, ContentJSONAPI)
+	c := NewContext(NewRequest(req), nil)
+	assert.Nil(t, c.Read(&reservation))
+	assert.Equal(t, testReservation{7, &testHotel{ID: 3}}, reservation)
+
+	req, _ = http.NewRequest("POST", "/reservations", bytes.NewBufferString(`{"data": {"type": "hotels"}}`))
+	req.Header.Set(ContentType, ContentJSONAPI)
+	err := NewContext(NewRequest(req), nil).Read(&reservation)
+	if assert.IsType(t, &Error{}, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*Error).Status)
+		assert.Equal(t, `resource: type "hotels" doesn't match "reservations"`, err.(*Error).Summary)
+	}
+}
@@ -188,13 +188,16 @@ func (r *Router) Match(method string, url *url.URL) (handlers []HandlerFunc, par
 
 //Reverse build url by route name and params.
 func (r *Router) Reverse(routeName string, pairsArgs ...map[string]interface{}) (string, error) {
-	zone, pairs := r.namedZones[routeName], pairsArgs[0]
+	zone, pairs := r.namedZones[routeName], map[string]interface{}{}
+	if len(pairsArgs) > 0 {
+		pairs = pairsArgs[0]
+	}
 	if zone != nil {
 		path := ""
 		for i := 0; i < len(zone.path); i++ {
 			if zone.path[i] == '<' {
 				pname, skipReset := "", false
-				for ; i < len(zone.path); i++ {
+				for i++; i < len(zone.path); i++ {
 					if zone.path[i] == '>' {
 						break
 					}
@@ -205,11 +208,21 @@ func (r *Router) Reverse(routeName string, pairsArgs ...map[string]interface{})
 						skipReset = true
 					}
 					if !skipReset {
-						pname += zone.path
+						pname += string(zone.path[i])
 					}
 				}
+				wildcard := strings.HasPrefix(pname, "*")
+				pname = strings.TrimPrefix(pname, "*")
 				if pairs[pname] != nil {
-					path += cast.ToString(pairs[pname])
+					// a wildcard matches several segments, its slashes are kept
+					segments := []string{cast.ToString(pairs[pname])}
+					if wildcard {
+						segments = strings.Split(segments[0], "/")
+					}
+					for j, segment := range segments {
+						segments[j] = url.PathEscape(segment)
+					}
+					path += strings.Join(segments, "/")
 				} else {
 					return "", errors.New("Missing argument: " + pname)
 				}
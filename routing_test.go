@@ -89,3 +89,33 @@ func TestMultiRoutes(t *testing.T) {
 		t.Errorf("GET: Not found same handler")
 	}
 }
+
+func TestReverse(t *testing.T) {
+	router := NewRouter()
+	router.Path("/users/<name>-<id:\\d+>.json").Get(handler0).Name("user")
+	router.Path("/files/<*path>").Get(handler0).Name("file")
+	router.Path("/about").Get(handler0).Name("about")
+
+	url, err := router.Reverse("user", map[string]interface{}{"name": "chris", "id": 123})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/chris-123.json", url)
+	url, err = router.Reverse("file", map[string]interface{}{"path": "a/b.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/files/a/b.txt", url)
+	url, err = router.Reverse("about")
+	assert.NoError(t, err)
+	assert.Equal(t, "/about", url)
+
+	// the params are escaped, but the slashes of the wildcards
+	url, err = router.Reverse("user", map[string]interface{}{"name": "a/b c?#", "id": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/a%2Fb%20c%3F%23-1.json", url)
+	url, err = router.Reverse("file", map[string]interface{}{"path": "a b/c.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/files/a%20b/c.txt", url)
+
+	_, err = router.Reverse("user", map[string]interface{}{"name": "chris"})
+	assert.EqualError(t, err, "Missing argument: id")
+	_, err = router.Reverse("missing")
+	assert.Error(t, err)
+}
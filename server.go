@@ -39,6 +39,12 @@ func handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Handler returns the handler of all the requests, serving the app without
+// listening to a port, e.g. in the tests of package egrettest.
+func Handler() http.Handler {
+	return http.HandlerFunc(handle)
+}
+
 func handleInternal(w http.ResponseWriter, r *http.Request, ws *websocket.Conn) {
 	start := time.Now()
 	var (
@@ -47,6 +53,7 @@ func handleInternal(w http.ResponseWriter, r *http.Request, ws *websocket.Conn)
 		c    = NewContext(req, resp)
 	)
 	req.Websocket = ws
+	req.Locale = ResolveLocale(req)
 	for _, router := range routers {
 		c.Handlers, c.Params = router.Match(req.Method, req.URL)
 		if len(c.Handlers) > 0 {
@@ -56,7 +63,11 @@ func handleInternal(w http.ResponseWriter, r *http.Request, ws *websocket.Conn)
 	if len(c.Handlers) == 0 {
 		c.NotFound("no handle found")
 	}
-	c.Next()
+	if MainWatcher != nil {
+		WatchHandler(c)
+	} else {
+		c.Next()
+	}
 
 	err := c.ExecuteRender()
 	if err != nil {
@@ -117,6 +128,7 @@ func Serve(port int) *Server {
 			WriteTimeout: time.Duration(Config.GetIntDefault("timeout.write", 0)) * time.Second,
 		},
 	}
+	watchConfig()
 	server.run()
 	return server
 }
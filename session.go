@@ -137,11 +137,13 @@ func SessionHandler(ctx *Context) {
 
 	// Make session vars available in templates as {{.session.xyz}}
 	ctx.RenderArgs["session"] = ctx.Session
-
-	// Store the signed session if it could have changed.
-	if len(ctx.Session) > 0 || !sessionWasEmpty {
-		ctx.SetCookie(ctx.Session.Cookie())
-	}
+	// Store the signed session if it could have changed, once the response
+	// is written, whether by the handlers or once they returned.
+	ctx.Response.OnBeforeWrite(func() {
+		if len(ctx.Session) > 0 || !sessionWasEmpty {
+			ctx.SetCookie(ctx.Session.Cookie())
+		}
+	})
 	ctx.Next()
 }
 
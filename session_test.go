@@ -2,6 +2,7 @@ package egret
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -62,3 +63,30 @@ func TestSessionExpire(t *testing.T) {
 		t.Error("expect expires", cookie.Expires, "before", expectExpire)
 	}
 }
+
+func TestSessionAndFlashCookiesOfWrittenResponses(t *testing.T) {
+	write := func(c *Context) {
+		c.Session["user"] = "Tom"
+		c.Flash.Success("saved")
+		c.Response.Write([]byte("written"))
+	}
+	redirect := func(c *Context) {
+		c.Session["user"] = "Tom"
+		c.Flash.Success("saved")
+		c.Redirect("/bookings")
+	}
+	for name, handler := range map[string]HandlerFunc{"write": write, "redirect": redirect} {
+		req, _ := http.NewRequest("POST", "/bookings", nil)
+		w := serveHandlers(req, SessionHandler, FlashHandler, handler)
+		cookies := map[string]string{}
+		for _, cookie := range w.Result().Cookies() {
+			cookies[cookie.Name] = cookie.Value
+		}
+		if session := cookies[CookiePrefix+"_SESSION"]; !strings.Contains(session, "user%3ATom") {
+			t.Errorf("%s: expected the session cookie, got %q", name, session)
+		}
+		if flash := cookies[CookiePrefix+"_FLASH"]; !strings.Contains(flash, "success%3Asaved") {
+			t.Errorf("%s: expected the flash cookie, got %q", name, flash)
+		}
+	}
+}
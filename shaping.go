@@ -0,0 +1,60 @@
+package egret
+
+import (
+	"reflect"
+
+	"github.com/spf13/cast"
+)
+
+// OmitField returns true for the fields of the serialized objects which the
+// current request may not see, e.g. according to the roles of its user:
+//
+//      egret.OmitField = func(c *egret.Context, field reflect.StructField) bool {
+//          role, ok := field.Tag.Lookup("role")
+//          return ok && !auth.HasRole(c, role)
+//      }
+//
+// See also Context.SetView and the "render.fields" query parameter, which
+// select the serialized fields as well.
+var OmitField func(c *Context, field reflect.StructField) bool
+
+// SetView selects the fields of the rendered object by their view tag, e.g.
+// `view:"public,admin"`, the fields without view tag belonging to every view.
+func (c *Context) SetView(view string) *Context {
+	c.RenderArgs["serializer.view"] = view
+	return c
+}
+
+// serializerOptions returns the options of the serializers rendering the
+// object, the options of the render along with the sparse fieldset of the
+// "render.fields" query parameter, e.g. ?fields=id,hotel.name, the related
+// resources of the "render.include" query parameter, the view and OmitField.
+func (c *Context) serializerOptions() map[string]interface{} {
+	options := map[string]interface{}{}
+	for k, v := range cast.ToStringMap(c.RenderArgs["serializer.options"]) {
+		options[k] = v
+	}
+	if _, ok := options["fields"]; !ok {
+		if param := Config.GetStringDefault("render.fields", "fields"); param != "" && c.Request.Request != nil {
+			if fields := c.Request.URL.Query().Get(param); fields != "" {
+				options["fields"] = fields
+			}
+		}
+	}
+	if _, ok := options["include"]; !ok {
+		if param := Config.GetStringDefault("render.include", "include"); param != "" && c.Request.Request != nil {
+			if include := c.Request.URL.Query().Get(param); include != "" {
+				options["include"] = include
+			}
+		}
+	}
+	if view := cast.ToString(c.RenderArgs["serializer.view"]); view != "" {
+		options["view"] = view
+	}
+	if OmitField != nil {
+		options["omit"] = func(field reflect.StructField) bool {
+			return OmitField(c, field)
+		}
+	}
+	return options
+}
@@ -1,11 +1,17 @@
 package egret
 
 import (
-	"io/ioutil"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -26,12 +32,21 @@ import (
 // Examples:
 // Serving a directory
 // egret.Static(router.Path("/**"), []string{"/public"}, egret.StaticOptions{"listing": true})
+// Serving embedded assets
+// egret.StaticFS(router.Path("/assets/<*path>"), assets, egret.StaticOptions{"precompressed": true})
 
 // Static Options
 // map[string]string{
 //	indexes: "index.html,index.htm"
 //	listing: false
 //	stripPath: true
+//	file: "" // always serve this file
+//	fs: nil // an fs.FS (or []fs.FS) searched after the root paths
+//	precompressed: false // serve "name.br"/"name.gz" siblings when accepted
+//	cache_control: "" // Cache-Control header of the served files
+//	immutable: false // far-future Cache-Control for file names matching FingerprintPattern
+//	fallback: "" // file served for unknown paths, e.g. "index.html" for SPAs
+//	assets: false // serve the fingerprinted names of the asset manifest, set for the "assets.roots"
 //}
 type StaticOptions map[string]interface{}
 type staticFileInfo struct {
@@ -42,13 +57,92 @@ type staticFileInfo struct {
 	Size    int64
 }
 
+const (
+	// ImmutableCacheControl is the Cache-Control header of fingerprinted files.
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+var (
+	// FingerprintPattern matches file names containing a content hash,
+	// e.g. "app.3f2a9c1d.css" or "app-3f2a9c1d.css".
+	FingerprintPattern = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[^./]+$`)
+
+	// precompressedEncodings lists the precompressed siblings looked for,
+	// by order of preference.
+	precompressedEncodings = []struct{ encoding, extension string }{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+type staticHandler struct {
+	roots         []fs.FS
+	indexes       []string
+	listing       bool
+	file          string
+	precompressed bool
+	cacheControl  string
+	immutable     bool
+	fallback      string
+	// assets the handler serves the fingerprinted names of the asset manifest
+	assets bool
+	// fingerprints caches whether the files served for fingerprinted names
+	// still match their fingerprint, by name, modification time and size
+	fingerprints sync.Map
+}
+
 func Static(zone *Zone, rootPaths []string, options ...map[string]interface{}) {
-	var indexes []string
 	opts := map[string]interface{}{}
 	if len(options) > 0 {
 		opts = options[0]
 	}
-	listing := cast.ToBool(opts["listing"])
+	roots, assets := []fs.FS{}, false
+	for _, rpath := range rootPaths {
+		assets = assets || isAssetRoot(rpath)
+		if !filepath.IsAbs(rpath) {
+			// the roots embedded by egret build, when they aren't deployed along with the binary
+			if embedded := embeddedRoot(rpath); embedded != nil {
+				roots = append(roots, embedded)
+				continue
+			}
+			rpath = filepath.Join(BasePath, rpath)
+		}
+		roots = append(roots, os.DirFS(rpath))
+	}
+	h := newStaticHandler(roots, opts)
+	h.assets = h.assets || assets
+	zone.Get(h.serve)
+}
+
+// embeddedRoot returns the directory of EmbeddedFS of a root path relative
+// to the application, nil if it exists on the disk or isn't embedded.
+func embeddedRoot(rpath string) fs.FS {
+	if EmbeddedFS == nil || DirExists(filepath.Join(BasePath, rpath)) {
+		return nil
+	}
+	name := path.Clean(filepath.ToSlash(rpath))
+	if info, err := fs.Stat(EmbeddedFS, name); err != nil || !info.IsDir() {
+		return nil
+	}
+	sub, err := fs.Sub(EmbeddedFS, name)
+	if err != nil {
+		return nil
+	}
+	return sub
+}
+
+// StaticFS serves the files of fsys, e.g. an embed.FS, so the assets can be
+// shipped inside the application binary. It accepts the same options as Static.
+func StaticFS(zone *Zone, fsys fs.FS, options ...map[string]interface{}) {
+	opts := map[string]interface{}{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	zone.Get(newStaticHandler([]fs.FS{fsys}, opts).serve)
+}
+
+func newStaticHandler(roots []fs.FS, opts map[string]interface{}) *staticHandler {
+	var indexes []string
 	oi := opts["indexes"]
 	if oi != nil {
 		if ois, ok := oi.(string); ok {
@@ -63,85 +157,201 @@ func Static(zone *Zone, rootPaths []string, options ...map[string]interface{}) {
 			Logger.Warn("Error satic option indexes value and ignored")
 		}
 	}
-
-	for i, rpath := range rootPaths {
-		if !filepath.IsAbs(rpath) {
-			rootPaths[i] = filepath.Join(BasePath, rpath)
-		}
+	switch fsys := opts["fs"].(type) {
+	case fs.FS:
+		roots = append(roots, fsys)
+	case []fs.FS:
+		roots = append(roots, fsys...)
 	}
 	file, _ := opts["file"].(string)
-	zone.Get(getHandler(rootPaths, indexes, listing, file))
+	return &staticHandler{
+		roots:         roots,
+		indexes:       indexes,
+		listing:       cast.ToBool(opts["listing"]),
+		file:          file,
+		precompressed: cast.ToBool(opts["precompressed"]),
+		cacheControl:  cast.ToString(opts["cache_control"]),
+		immutable:     cast.ToBool(opts["immutable"]),
+		fallback:      cast.ToString(opts["fallback"]),
+		assets:        cast.ToBool(opts["assets"]),
+	}
 }
 
-func getHandler(rootPaths []string, indexes []string, listing bool, file string) HandlerFunc {
-	return func(ctx *Context) {
-		vpath := ""
-		if file != "" {
-			vpath = file
-		} else {
-			for key, path := range ctx.Params {
-				if key[0] == '*' {
-					vpath = path
-					break
-				}
+// fsPath turns a request path into a valid fs.FS path.
+func fsPath(vpath string) string {
+	name := path.Clean("/" + filepath.ToSlash(vpath))[1:]
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (h *staticHandler) serve(ctx *Context) {
+	vpath := ""
+	if h.file != "" {
+		vpath = h.file
+	} else {
+		for key, path := range ctx.Params {
+			if key[0] == '*' {
+				vpath = path
+				break
 			}
 		}
-		for _, rpath := range rootPaths {
-			fname := filepath.Join(rpath, vpath)
-			finfo, err := os.Stat(fname)
-			if err != nil {
-				if os.IsNotExist(err) || err.(*os.PathError).Err == syscall.ENOTDIR {
-					if RunMode == "dev" {
-						Logger.Warn("File not found", zap.String("path", vpath), zap.Error(err))
-					}
-					ctx.NotFound("File not found")
-					return
-				}
-				Logger.Error("Error trying to get file info", zap.String("path", vpath), zap.Error(err))
-				ctx.RenderError(err)
-				return
+	}
+	name := fsPath(vpath)
+	// Fingerprinted names of the asset manifest are served from the original
+	// files, and can be cached forever as their content never changes.
+	requested := name
+	original, fingerprinted := assetOriginals[name]
+	fingerprinted = fingerprinted && h.assets
+	if fingerprinted {
+		name = original
+	}
+	for _, root := range h.roots {
+		finfo, err := fs.Stat(root, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) || isNotDirError(err) {
+				continue
 			}
+			Logger.Error("Error trying to get file info", zap.String("path", vpath), zap.Error(err))
+			ctx.RenderError(err)
+			return
+		}
 
-			if finfo.Mode().IsDir() {
-				if ctx.Request.URL.Path[len(ctx.Request.URL.Path)-1] != '/' {
-					ctx.Request.URL.Path += "/"
-					ctx.Redirect(ctx.Request.URL.String())
-					return
-				}
-				if !indexDir(ctx, vpath, rootPaths, indexes) {
-					if listing {
-						listDir(ctx, vpath, rootPaths)
-						return
-					}
-					// Disallow directory listing
-					Logger.Warn("Attempted directory listing", zap.String("path", vpath))
-					ctx.Forbidden("Directory listing not allowed.")
+		if finfo.IsDir() {
+			if ctx.Request.URL.Path[len(ctx.Request.URL.Path)-1] != '/' {
+				ctx.Request.URL.Path += "/"
+				ctx.Redirect(ctx.Request.URL.String())
+				return
+			}
+			if !h.indexDir(ctx, name) {
+				if h.listing {
+					listDir(ctx, vpath, h.roots)
 					return
 				}
+				// Disallow directory listing
+				Logger.Warn("Attempted directory listing", zap.String("path", vpath))
+				ctx.Forbidden("Directory listing not allowed.")
 				return
 			}
-			renderFile(ctx, fname)
-			ctx.Next()
 			return
 		}
+		stale := fingerprinted && !h.matchesFingerprint(root, name, requested, finfo)
+		h.renderFile(ctx, root, name, fingerprinted && !stale)
+		if stale {
+			// the file changed since the manifest was built, its content
+			// mustn't be cached under the fingerprint of the former one
+			Logger.Warn("Outdated asset manifest", zap.String("path", name), zap.String("fingerprinted", requested))
+			ctx.Response.SetHeader(cacheControlHeaderKey, "no-cache")
+		}
+		ctx.Next()
+		return
+	}
+
+	if h.fallback != "" && path.Ext(name) == "" {
+		for _, root := range h.roots {
+			if finfo, err := fs.Stat(root, fsPath(h.fallback)); err == nil && !finfo.IsDir() {
+				h.renderFile(ctx, root, fsPath(h.fallback), false)
+				// The fallback page answers for any route; never cache it as immutable.
+				ctx.Response.SetHeader(cacheControlHeaderKey, "no-cache")
+				ctx.Next()
+				return
+			}
+		}
 	}
+	if RunMode == "dev" {
+		Logger.Warn("File not found", zap.String("path", vpath))
+	}
+	ctx.NotFound("File not found")
+}
+
+// matchesFingerprint returns true if the content of the file name of root has
+// the hash of its fingerprinted name.
+func (h *staticHandler) matchesFingerprint(root fs.FS, name, fingerprinted string, finfo fs.FileInfo) bool {
+	key := fingerprinted + "\x00" + finfo.ModTime().String() + "\x00" + strconv.FormatInt(finfo.Size(), 10)
+	if matches, ok := h.fingerprints.Load(key); ok {
+		return matches.(bool)
+	}
+	content, err := fs.ReadFile(root, name)
+	if err != nil {
+		return false
+	}
+	matches := FingerprintName(name, content) == fingerprinted
+	h.fingerprints.Store(key, matches)
+	return matches
+}
+
+// isNotDirError reports whether err is caused by a path element being a file.
+func isNotDirError(err error) bool {
+	var perr *fs.PathError
+	return errors.As(err, &perr) && strings.Contains(perr.Err.Error(), "not a directory")
 }
-func renderFile(ctx *Context, fname string) {
+
+func (h *staticHandler) renderFile(ctx *Context, root fs.FS, name string, fingerprinted bool) {
+	contentType := ContentTypeByFilename(name)
+	servedName := name
+	if h.precompressed {
+		ctx.Response.Header().Add(varyHeaderKey, AcceptEncodingHeader)
+		accepted := ctx.Request.Header.Get(AcceptEncodingHeader)
+		for _, pc := range precompressedEncodings {
+			if encodingQuality(accepted, pc.encoding) <= 0 {
+				continue
+			}
+			if finfo, err := fs.Stat(root, name+pc.extension); err == nil && !finfo.IsDir() {
+				servedName = name + pc.extension
+				ctx.Response.SetHeader(contentEncodingHeaderKey, pc.encoding)
+				break
+			}
+		}
+	}
+
 	// Open request file path
-	file, err := os.Open(fname)
+	file, err := root.Open(servedName)
 	if err != nil {
-		if os.IsNotExist(err) {
-			Logger.Warn("File not found", zap.String("path", fname), zap.Error(err))
+		if errors.Is(err, fs.ErrNotExist) {
+			Logger.Warn("File not found", zap.String("path", servedName), zap.Error(err))
 			ctx.NotFound("File not found")
 			return
 		}
-		Logger.Error("Error opening", zap.String("path", fname), zap.Error(err))
+		Logger.Error("Error opening", zap.String("path", servedName), zap.Error(err))
 		ctx.RenderError(err)
 		return
 	}
-	ctx.RenderFile(file, "inline")
+	finfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		Logger.Error("Error trying to get file info", zap.String("path", servedName), zap.Error(err))
+		ctx.RenderError(err)
+		return
+	}
+
+	// http.ServeContent needs to seek for Range requests; files of an fs.FS
+	// which can't are read in memory.
+	reader, ok := file.(io.ReadSeeker)
+	if !ok {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			ctx.RenderError(err)
+			return
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	ctx.Response.SetHeader(ContentType, contentType)
+	if fingerprinted || (h.immutable && FingerprintPattern.MatchString(name)) {
+		ctx.Response.SetHeader(cacheControlHeaderKey, ImmutableCacheControl)
+	} else if h.cacheControl != "" {
+		ctx.Response.SetHeader(cacheControlHeaderKey, h.cacheControl)
+	}
+	ctx.Response.ContentType = contentType
+	ctx.RenderBinary(struct {
+		io.ReadSeeker
+		io.Closer
+	}{reader, file}, path.Base(name), "inline", finfo.ModTime())
 }
-func listDir(ctx *Context, webpath string, rootPaths []string) {
+
+func listDir(ctx *Context, webpath string, roots []fs.FS) {
 	if webpath == "" || webpath[0] != '/' {
 		webpath = "/" + webpath
 	}
@@ -150,27 +360,30 @@ func listDir(ctx *Context, webpath string, rootPaths []string) {
 	}
 	ctx.RenderTemplate("directory-list.html", map[string]interface{}{
 		"Base":  webpath,
-		"Files": getDirList(webpath, rootPaths),
+		"Files": getDirList(webpath, roots),
 	}, nil)
 }
-func indexDir(ctx *Context, webpath string, rootPaths []string, indexes []string) bool {
-	for _, rpath := range rootPaths {
-		for _, idx := range indexes {
-			fname := filepath.Join(rpath, webpath, idx)
-			if _, err := os.Stat(fname); err == nil {
-				renderFile(ctx, fname)
+func (h *staticHandler) indexDir(ctx *Context, name string) bool {
+	for _, root := range h.roots {
+		for _, idx := range h.indexes {
+			fname := path.Join(name, idx)
+			if finfo, err := fs.Stat(root, fname); err == nil && !finfo.IsDir() {
+				h.renderFile(ctx, root, fname, false)
 				return true
 			}
 		}
 	}
 	return false
 }
-func getDirList(webpath string, rootPaths []string) []*staticFileInfo {
+func getDirList(webpath string, roots []fs.FS) []*staticFileInfo {
 	files := []*staticFileInfo{}
-	for _, rpath := range rootPaths {
-		fname := filepath.Join(rpath, webpath)
-		infos, _ := ioutil.ReadDir(fname)
-		for _, info := range infos {
+	for _, root := range roots {
+		entries, _ := fs.ReadDir(root, fsPath(webpath))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
 			finfo := &staticFileInfo{
 				Name:    info.Name(),
 				ModTime: info.ModTime(),
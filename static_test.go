@@ -0,0 +1,94 @@
+package egret
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var staticTestFS = fstest.MapFS{
+	"index.html":           {Data: []byte("<html>app</html>")},
+	"app.3f2a9c1d.js":      {Data: []byte("console.log('app')")},
+	"app.3f2a9c1d.js.br":   {Data: []byte("brotli")},
+	"app.3f2a9c1d.js.gz":   {Data: []byte("gzip")},
+	"docs/readme.txt":      {Data: []byte("0123456789")},
+	"docs/sub/nested.html": {Data: []byte("nested")},
+}
+
+func serveStatic(fsys fs.FS, opts StaticOptions, vpath string, header http.Header) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/"+vpath, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return serveHandlers(req, func(c *Context) {
+		c.Params = map[string]string{"*path": vpath}
+		c.Next()
+	}, newStaticHandler([]fs.FS{fsys}, opts).serve)
+}
+
+func TestStaticFS(t *testing.T) {
+	w := serveStatic(staticTestFS, StaticOptions{}, "docs/readme.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get(ContentType))
+
+	w = serveStatic(staticTestFS, StaticOptions{}, "docs/readme.txt", http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+
+	w = serveStatic(staticTestFS, StaticOptions{}, "../docs/readme.txt", nil)
+	assert.Equal(t, "0123456789", w.Body.String(), "paths can't escape the root")
+
+	w = serveStatic(staticTestFS, StaticOptions{"indexes": "index.html"}, "missing.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	opts := StaticOptions{"precompressed": true, "immutable": true, "cache_control": "public, max-age=60"}
+	w := serveStatic(staticTestFS, opts, "app.3f2a9c1d.js", http.Header{AcceptEncodingHeader: {"gzip, br"}})
+	assert.Equal(t, "brotli", w.Body.String())
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get(ContentType), "javascript", "the type of the original file is sent")
+	assert.Equal(t, ImmutableCacheControl, w.Header().Get("Cache-Control"))
+
+	w = serveStatic(staticTestFS, opts, "app.3f2a9c1d.js", http.Header{AcceptEncodingHeader: {"gzip, br;q=0"}})
+	assert.Equal(t, "gzip", w.Body.String())
+
+	w = serveStatic(staticTestFS, opts, "app.3f2a9c1d.js", nil)
+	assert.Equal(t, "console.log('app')", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+
+	w = serveStatic(staticTestFS, opts, "docs/readme.txt", nil)
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+}
+
+func TestStaticFallback(t *testing.T) {
+	opts := StaticOptions{"fallback": "index.html"}
+	w := serveStatic(staticTestFS, opts, "users/42", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>app</html>", w.Body.String())
+
+	w = serveStatic(staticTestFS, opts, "missing.js", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "missing assets are not served the fallback")
+}
+
+func TestStaticEmbeddedRoot(t *testing.T) {
+	defer func(basePath string, embedded fs.FS) { BasePath, EmbeddedFS = basePath, embedded }(BasePath, EmbeddedFS)
+	BasePath, EmbeddedFS = t.TempDir(), fstest.MapFS{"public/css/app.css": {Data: []byte("body{}")}}
+
+	root := embeddedRoot("public")
+	if assert.NotNil(t, root) {
+		w := serveStatic(root, StaticOptions{}, "css/app.css", nil)
+		assert.Equal(t, "body{}", w.Body.String())
+	}
+	assert.Nil(t, embeddedRoot("assets"), "the roots not embedded are read from the disk")
+
+	assert.NoError(t, os.Mkdir(filepath.Join(BasePath, "public"), 0777))
+	assert.Nil(t, embeddedRoot("public"), "the roots deployed along with the binary are read from the disk")
+}
@@ -0,0 +1,130 @@
+package egret
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kenorld/egret/core/template"
+	"go.uber.org/zap"
+)
+
+// templateListener parses again the templates of a MainTemplateManager entry
+// when one of its files changes, leaving the other entries alone.
+type templateListener struct {
+	entry *template.Entry
+}
+
+func (l templateListener) Refresh() *Error {
+	if err := l.entry.LoadTemplate(); err != nil {
+		Logger.Error("Failed to parse the templates", zap.String("directory", l.entry.Loader.Directory), zap.Error(err))
+		return newTemplateError(err)
+	}
+	return nil
+}
+
+func (l templateListener) WatchDir(info os.FileInfo) bool {
+	return !strings.HasPrefix(info.Name(), ".")
+}
+
+func (l templateListener) WatchFile(fpath string) bool {
+	return filepath.Ext(fpath) == l.entry.Loader.Extension
+}
+
+// watchTemplates registers the template directories with MainWatcher, so
+// the templates edited in DevMode are parsed again on the next request.
+func watchTemplates() {
+	if MainWatcher == nil {
+		MainWatcher = NewWatcher()
+	}
+	for _, entry := range MainTemplateManager.Entries {
+		if entry.Loader.IsBinary() || !DirExists(entry.Loader.Directory) {
+			continue
+		}
+		// Not eagerly, whatever the watch mode: the errors are shown by the
+		// request following the change.
+		MainWatcher.listen(templateListener{entry}, false, []string{entry.Loader.Directory})
+	}
+}
+
+// newTemplateError returns the error page of a template which does not
+// parse, showing its source around the line of the error.
+func newTemplateError(err error) *Error {
+	perr, ok := err.(*template.ParseError)
+	if !ok {
+		return &Error{
+			Status:  http.StatusInternalServerError,
+			Name:    "template_error",
+			Title:   "Template Error",
+			Summary: err.Error(),
+		}
+	}
+
+	e := &Error{
+		Status:     http.StatusInternalServerError,
+		Name:       "template_compilation_error",
+		Title:      "Template Compilation Error",
+		SourceType: "template",
+		Path:       perr.Name,
+		Line:       perr.Line,
+		Summary:    perr.Description,
+	}
+	if perr.Path != "" {
+		e.SourceLines, _ = ReadLines(perr.Path)
+	}
+	if errorLink := Config.GetStringDefault("error.link", ""); errorLink != "" {
+		e.SetLink(errorLink)
+	}
+	return e
+}
+
+// templateWriter buffers the output of a template, so a template failing
+// before anything is sent is replaced by the error page. Streaming, it sends
+// the output every "render.chunk_size" bytes or "render.flush_interval",
+// flushing the response; else the whole output once the template executed.
+type templateWriter struct {
+	resp     *Response
+	buf      bytes.Buffer
+	stream   bool
+	size     int
+	interval time.Duration
+	last     time.Time
+	// flushed is set once the status and some output are sent
+	flushed bool
+}
+
+func newTemplateWriter(resp *Response, stream bool) *templateWriter {
+	return &templateWriter{
+		resp:     resp,
+		stream:   stream,
+		size:     Config.GetIntDefault("render.chunk_size", 32*1024),
+		interval: Config.GetDurationDefault("render.flush_interval", time.Second),
+		last:     time.Now(),
+	}
+}
+
+func (w *templateWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	if w.stream && (w.buf.Len() >= w.size || time.Since(w.last) >= w.interval) {
+		// an error, e.g. the client went away, stops the execution
+		return n, w.Flush()
+	}
+	return n, nil
+}
+
+// Flush sends the buffered output, and flushes the response when streaming.
+func (w *templateWriter) Flush() error {
+	w.flushed = true
+	if _, err := w.resp.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	w.buf.Reset()
+	w.last = time.Now()
+	if f, ok := w.resp.Writer.(http.Flusher); ok && w.stream {
+		f.Flush()
+	}
+	return nil
+}
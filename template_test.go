@@ -0,0 +1,159 @@
+package egret
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kenorld/egret/conf"
+	"github.com/kenorld/egret/core/template"
+	"github.com/kenorld/egret/core/template/native"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTemplateReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-views")
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "hotels", "show.html")
+	os.MkdirAll(filepath.Dir(fpath), 0777)
+	ioutil.WriteFile(fpath, []byte("<h1>{{.Name}}</h1>\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "index.txt"), []byte("{{.Name}}\n"), 0666)
+
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", nil)
+	MainTemplateManager = template.NewManager(nil)
+	UseTemplate(native.New(native.Config{Layout: template.NoLayout})).Register(dir, ".html")
+	UseTemplate(native.New(native.Config{Layout: template.NoLayout})).Register(dir, ".txt")
+	assert.Nil(t, MainTemplateManager.Refresh())
+
+	html := templateListener{MainTemplateManager.Entries[0]}
+	assert.True(t, html.WatchFile(fpath))
+	assert.False(t, html.WatchFile(filepath.Join(dir, "index.txt")))
+
+	ioutil.WriteFile(fpath, []byte("<h1>\n{{.Name}</h1>\n"), 0666)
+	err := html.Refresh()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "template", err.SourceType)
+		assert.Equal(t, "hotels/show.html", err.Path)
+		assert.Equal(t, 2, err.Line)
+		assert.Equal(t, "{{.Name}</h1>", err.SourceLines[1])
+		assert.Contains(t, err.Summary, "bad character")
+	}
+
+	ioutil.WriteFile(fpath, []byte("<h2>{{.Name}}</h2>\n"), 0666)
+	assert.Nil(t, html.Refresh())
+	out := &bytes.Buffer{}
+	assert.Nil(t, MainTemplateManager.ExecuteWriter(out, "hotels/show.html", map[string]string{"Name": "Hilton"}, nil))
+	assert.Equal(t, "<h2>Hilton</h2>\n", out.String())
+}
+
+func TestWatchHandlerServesTemplateErrors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-views")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("{{if}}"), 0666)
+
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", nil)
+	MainTemplateManager = template.NewManager(nil)
+	UseTemplate(native.New()).Register(dir, ".html")
+	assert.NotNil(t, MainTemplateManager.Refresh())
+
+	MainWatcher = nil
+	watchTemplates()
+	defer func() {
+		MainWatcher.Close()
+		MainWatcher = nil
+	}()
+
+	called := false
+	c := NewContext(nil, nil)
+	c.Handlers = []HandlerFunc{func(c *Context) { called = true }}
+	WatchHandler(c)
+	assert.False(t, called)
+	if assert.IsType(t, &Error{}, c.Error) {
+		assert.Equal(t, "index.html", c.Error.(*Error).Path)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("{{if .}}ok{{end}}"), 0666)
+	c = NewContext(nil, nil)
+	c.Handlers = []HandlerFunc{func(c *Context) { called = true }}
+	WatchHandler(c)
+	assert.Nil(t, c.Error)
+	assert.True(t, called)
+}
+
+func TestEmbeddedTemplates(t *testing.T) {
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", []string{"core/conf"})
+	EmbeddedFS = fstest.MapFS{"views/hello.html": {Data: []byte("Hello {{.}}")}}
+	basePath, egretPath := BasePath, EgretPath
+	BasePath, EgretPath = "missing", "missing"
+	defer func() {
+		EmbeddedFS, BasePath, EgretPath = nil, basePath, egretPath
+	}()
+
+	initTemplate()
+	result, err := MainTemplateManager.ExecuteString("hello.html", "world", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello world", result)
+	result, err = MainTemplateManager.ExecuteString("errors/404.txt", map[string]interface{}{"Error": &Error{Title: "Missing"}}, nil)
+	assert.Nil(t, err, "the views of Egret are embedded")
+	assert.Contains(t, result, "Missing")
+}
+
+func TestStreamTemplate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "egret-views")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "errors"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "report.html"), []byte("{{range .Entity}}<p>{{.}}</p>{{end}}{{index .Entity -1}}"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "errors", "500.html"), []byte("<h1>{{.Error.Title}}</h1>"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "errors", "404.html"), []byte("<h1>{{.Error.Title}} ({{.currentLocale}})</h1>"), 0666)
+
+	Logger = zap.NewNop()
+	Config, _ = conf.LoadContext("app", nil)
+	MainTemplateManager = template.NewManager(nil)
+	UseTemplate(native.New(native.Config{Layout: template.NoLayout})).Register(dir, ".html")
+	assert.Nil(t, MainTemplateManager.Refresh())
+
+	render := func(rows int, options map[string]interface{}) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/report", nil)
+		c := NewContext(NewRequest(r), NewResponse(w))
+		c.RenderTemplate("report.html", make([]int, rows), options)
+		return w, c.ExecuteRender()
+	}
+
+	// failing before the first flush, the page is replaced by the error page
+	w, err := render(10, map[string]interface{}{"stream": true})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "<h1>Template Error</h1>", w.Body.String())
+
+	w, err = render(10000, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// failing after, the page is cut short
+	w, err = render(10000, map[string]interface{}{"stream": true})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "<p>0</p><p>0</p>"))
+	assert.True(t, w.Body.Len() >= 32*1024)
+
+	// the error pages are in the locale of the request
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/report", nil)
+	c := NewContext(NewRequest(r), NewResponse(w))
+	c.Request.Locale = "fr"
+	c.NotFound("no report")
+	assert.Nil(t, c.ExecuteRender())
+	assert.Equal(t, "<h1>Not Found (fr)</h1>", w.Body.String())
+}
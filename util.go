@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -110,7 +111,13 @@ func ContentTypeByFilename(filename string) string {
 	}
 
 	extension := filename[dot+1:]
-	contentType := mimeConfig.GetString(extension)
+	contentType := ""
+	if mimeConfig != nil {
+		contentType = mimeConfig.GetString(extension)
+	} else {
+		// The mime-types config is not loaded, e.g. in tests.
+		contentType = strings.SplitN(mime.TypeByExtension(filename[dot:]), ";", 2)[0]
+	}
 	if contentType == "" {
 		return DefaultFileContentType
 	}
@@ -10,3 +10,12 @@ const (
 	// Minimum required Go version
 	MinimumGoVersion = ">= go1.11.2"
 )
+
+var (
+	// AppVersion the version of the application, set by egret build from
+	// the APP_VERSION environment variable, else git describe
+	AppVersion string
+
+	// AppBuildTime the time the application was built at, set by egret build
+	AppBuildTime string
+)
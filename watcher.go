@@ -28,9 +28,11 @@ type DiscerningListener interface {
 // Watcher allows listeners to register to be notified of changes under a given
 // directory.
 type Watcher struct {
-	// Parallel arrays of watcher/listener pairs.
+	// Parallel arrays of watcher/listener pairs, and the buffered events of
+	// the watchers.
 	watchers     []*fsnotify.Watcher
 	listeners    []Listener
+	events       []chan fsnotify.Event
 	forceRefresh bool
 	lastError    int
 	notifyMutex  sync.Mutex
@@ -45,18 +47,22 @@ func NewWatcher() *Watcher {
 
 // Listen registers for events within the given root directories (recursively).
 func (w *Watcher) Listen(listener Listener, roots ...string) {
+	w.listen(listener, w.eagerRebuildEnabled(), roots)
+}
+
+// ListenEagerly registers for events within the given root directories
+// (recursively), the listener being refreshed as soon as they happen rather
+// than by Notify, whatever the watch mode.
+func (w *Watcher) ListenEagerly(listener Listener, roots ...string) {
+	w.listen(listener, true, roots)
+}
+
+func (w *Watcher) listen(listener Listener, eager bool, roots []string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		Logger.Fatal("Fatal error", zap.Error(err))
 	}
 
-	// Replace the unbuffered Event channel with a buffered one.
-	// Otherwise multiple change events only come out one at a time, across
-	// multiple page views.  (There appears no way to "pump" the events out of
-	// the watcher)
-	watcher.Events = make(chan fsnotify.Event, 100)
-	watcher.Errors = make(chan error, 10)
-
 	// Walk through all files / directories under the root, adding each to watcher.
 	for _, p := range roots {
 		// is the directory / file a symlink?
@@ -114,28 +120,69 @@ func (w *Watcher) Listen(listener Listener, roots ...string) {
 		}
 	}
 
-	if w.eagerRebuildEnabled() {
+	// The events are buffered, otherwise multiple change events only come
+	// out one at a time, across multiple page views.
+	events := make(chan fsnotify.Event, 100)
+	if eager {
 		// Create goroutine to notify file changes in real time
 		go w.NotifyWhenUpdated(listener, watcher)
+	} else {
+		go bufferEvents(watcher, events)
 	}
 
 	w.watchers = append(w.watchers, watcher)
 	w.listeners = append(w.listeners, listener)
+	w.events = append(w.events, events)
+}
+
+// bufferEvents pumps the events of watcher into events, and drains its
+// errors, until it is closed.
+func bufferEvents(watcher *fsnotify.Watcher, events chan<- fsnotify.Event) {
+	defer close(events)
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			events <- ev
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// Close stops watching the directories of the listeners.
+func (w *Watcher) Close() error {
+	var first error
+	for _, watcher := range w.watchers {
+		if err := watcher.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
 
 // NotifyWhenUpdated notifies the watcher when a file event is received.
 func (w *Watcher) NotifyWhenUpdated(listener Listener, watcher *fsnotify.Watcher) {
 	for {
 		select {
-		case ev := <-watcher.Events:
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
 			if w.rebuildRequired(ev, listener) {
 				// Serialize listener.Refresh() calls.
 				w.notifyMutex.Lock()
 				listener.Refresh()
 				w.notifyMutex.Unlock()
 			}
-		case <-watcher.Errors:
-			continue
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
 		}
 	}
 }
@@ -147,20 +194,22 @@ func (w *Watcher) Notify() error {
 	w.notifyMutex.Lock()
 	defer w.notifyMutex.Unlock()
 
-	for i, watcher := range w.watchers {
+	for i, events := range w.events {
 		listener := w.listeners[i]
 
-		// Pull all pending events / errors from the watcher.
+		// Pull all pending events from the watcher, the eager listeners
+		// being refreshed as they come.
 		refresh := false
 		for {
 			select {
-			case ev := <-watcher.Events:
+			case ev, ok := <-events:
+				if !ok {
+					break
+				}
 				if w.rebuildRequired(ev, listener) {
 					refresh = true
 				}
 				continue
-			case <-watcher.Errors:
-				continue
 			default:
 				// No events left to pull
 			}
@@ -204,7 +253,9 @@ func (w *Watcher) rebuildRequired(ev fsnotify.Event, listener Listener) bool {
 	return true
 }
 
-//WatchHandler
+// WatchHandler notifies MainWatcher of the changes since the last request,
+// before calling the next handlers. An error returned by a listener, like a
+// template which does not parse, is served instead.
 var WatchHandler = func(c *Context) {
 	if MainWatcher != nil {
 		err := MainWatcher.Notify()
@@ -213,4 +264,5 @@ var WatchHandler = func(c *Context) {
 			return
 		}
 	}
+	c.Next()
 }